@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"corporate-directory/pkg/client"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/transport"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+//
+// dirctl queries and administers the directory, either through a running server or offline against an org file
+// loaded into an in-process service.
+//
+
+const usage = `Usage: dirctl [flags] <command> [args]
+
+Commands:
+  common <first> <second>   closest common manager of two employees
+  get <id>                  single employee
+  chain <id>                management chain from the employee up to Claire
+  setup <file>              replace the org on the server with the one from file
+  validate <file>           check that file contains a valid org, always offline
+  export [--format f]       dump the whole org as json or dot
+
+Org files may be JSON in the form of setup request, CSV with id, name, manager_id, title and mail columns, or LDIF.
+
+Flags:
+`
+
+var errUsage = errors.New(`invalid arguments`)
+
+type options struct {
+	server string
+	token  string
+	file   string
+	output string
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, "dirctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := flag.NewFlagSet("dirctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	defaultServer := os.Getenv("DIRCTL_SERVER")
+	if defaultServer == "" {
+		defaultServer = "localhost:80"
+	}
+	flags.StringVar(&opts.server, "server", defaultServer, "address of the server, defaults to $DIRCTL_SERVER")
+	flags.StringVar(&opts.token, "token", os.Getenv("DIRCTL_TOKEN"),
+		"API key or JWT for the server, defaults to $DIRCTL_TOKEN")
+	flags.StringVar(&opts.file, "file", "", "work offline against the org from this file instead of the server")
+	flags.StringVar(&opts.output, "output", "table", "output format, table or json")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if opts.output != "table" && opts.output != "json" {
+		flags.Usage()
+		return errUsage
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "validate":
+		return runValidate(ctx, args, stdout)
+	case "setup":
+		if opts.file != "" {
+			return errors.New(`setup requires a server, use validate to check a file offline`)
+		}
+	}
+
+	dir, err := openDirectory(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "common":
+		return runCommon(ctx, dir, args, opts, stdout)
+	case "get":
+		return runGet(ctx, dir, args, opts, stdout)
+	case "chain":
+		return runChain(ctx, dir, args, opts, stdout)
+	case "setup":
+		return runSetup(ctx, dir, args, stdout)
+	case "export":
+		return runExport(ctx, dir, args, stdout, stderr)
+	default:
+		flags.Usage()
+		return errUsage
+	}
+}
+
+// Remote client or, in offline mode, in-process service set up with the org from file
+func openDirectory(ctx context.Context, opts options) (service.CorporateDirectory, error) {
+	if opts.file == "" {
+		return client.New(opts.server, client.WithToken(opts.token))
+	}
+	employees, err := readOrgFile(opts.file)
+	if err != nil {
+		return nil, err
+	}
+	dir := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := dir.Setup(ctx, employees); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+func parseIds(args []string, count int) ([]int, error) {
+	if len(args) != count {
+		return nil, fmt.Errorf("expected %d employee ids, got %d arguments", count, len(args))
+	}
+	ids := make([]int, count)
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("employee id must be an integer, got %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func runCommon(ctx context.Context, dir service.CorporateDirectory, args []string, opts options, w io.Writer) error {
+	ids, err := parseIds(args, 2)
+	if err != nil {
+		return err
+	}
+	common, err := dir.GetCommonManager(ctx, ids[0], ids[1])
+	if err != nil {
+		return err
+	}
+	return writeEmployee(w, opts.output, common)
+}
+
+func runGet(ctx context.Context, dir service.CorporateDirectory, args []string, opts options, w io.Writer) error {
+	ids, err := parseIds(args, 1)
+	if err != nil {
+		return err
+	}
+	employee, err := dir.GetEmployee(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	return writeEmployee(w, opts.output, employee)
+}
+
+func runChain(ctx context.Context, dir service.CorporateDirectory, args []string, opts options, w io.Writer) error {
+	ids, err := parseIds(args, 1)
+	if err != nil {
+		return err
+	}
+	employee, err := dir.GetEmployee(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	chain := []*service.Employee{employee}
+	for employee.ManagerID != nil {
+		if employee, err = dir.GetEmployee(ctx, *employee.ManagerID); err != nil {
+			return err
+		}
+		chain = append(chain, employee)
+	}
+	return writeEmployees(w, opts.output, chain)
+}
+
+func runSetup(ctx context.Context, dir service.CorporateDirectory, args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(`setup expects a single org file`)
+	}
+	employees, err := readOrgFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := dir.Setup(ctx, employees); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%d employees set up\n", len(employees))
+	return err
+}
+
+// Validation goes through the same Setup as on the server, so the result is what the server would say
+func runValidate(ctx context.Context, args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(`validate expects a single org file`)
+	}
+	employees, err := readOrgFile(args[0])
+	if err != nil {
+		return err
+	}
+	dir := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := dir.Setup(ctx, employees); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s: %d employees, valid\n", args[0], len(employees))
+	return err
+}
+
+func runExport(ctx context.Context, dir service.CorporateDirectory, args []string, w, stderr io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "json", "export format, json or dot")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	employees, err := dir.GetEmployees(ctx)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		return writeJson(w, transport.SetupRequest{Employees: employees})
+	case "dot":
+		return writeDot(w, employees)
+	default:
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/transport"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func runDirctl(t *testing.T, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestOfflineQueries(t *testing.T) {
+	out, err := runDirctl(t, "-file", "testdata/org.csv", "common", "4", "3")
+	if err != nil || !strings.Contains(out, "Claire") {
+		t.Errorf("unexpected common output %q, %v", out, err)
+	}
+
+	out, err = runDirctl(t, "-file", "testdata/org.json", "-output", "json", "chain", "4")
+	if err != nil {
+		t.Fatalf("chain failed: %v", err)
+	}
+	var chain []*service.Employee
+	if err := json.Unmarshal([]byte(out), &chain); err != nil {
+		t.Fatalf("chain output is not json: %v", err)
+	}
+	if len(chain) != 3 || chain[0].ID != 4 || chain[1].ID != 2 || chain[2].ID != 1 {
+		t.Errorf("unexpected chain %s", out)
+	}
+
+	if _, err = runDirctl(t, "-file", "testdata/org.csv", "get", "10"); err != service.ErrInvalidEmployee {
+		t.Errorf("expected ErrInvalidEmployee, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	out, err := runDirctl(t, "validate", "testdata/org.csv")
+	if err != nil || !strings.Contains(out, "4 employees") {
+		t.Errorf("unexpected validate output %q, %v", out, err)
+	}
+
+	_, err = runDirctl(t, "validate", "testdata/dangling.csv")
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("expected error pointing to line 4, got %v", err)
+	}
+}
+
+func TestExportDot(t *testing.T) {
+	out, err := runDirctl(t, "-file", "testdata/org.csv", "export", "--format", "dot")
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	for _, expected := range []string{`1 [label="Claire\nCEO"];`, "1 -> 2;", "1 -> 3;", "2 -> 4;"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("%q is missing in export:\n%s", expected, out)
+		}
+	}
+}
+
+func TestServerMode(t *testing.T) {
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := httptest.NewServer(transport.SetupHttpTransport(svc, config.Default()).Handler)
+	defer server.Close()
+
+	if _, err := runDirctl(t, "-server", server.URL, "setup", "testdata/org.csv"); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	out, err := runDirctl(t, "-server", server.URL, "get", "2")
+	if err != nil || !strings.Contains(out, "Alice") || !strings.Contains(out, "Engineer") {
+		t.Errorf("unexpected get output %q, %v", out, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"corporate-directory/pkg/ldif"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/transport"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Columns recognized in CSV files, id and name are mandatory
+var csvColumns = map[string]bool{
+	"id":         true,
+	"name":       true,
+	"manager_id": true,
+	"title":      true,
+	"mail":       true,
+}
+
+// Read org file, the format is chosen by extension and defaults to JSON
+func readOrgFile(path string) ([]*service.Employee, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readCsv(f)
+	case ".ldif":
+		return ldif.Read(f)
+	default:
+		var request transport.SetupRequest
+		if err := json.NewDecoder(f).Decode(&request); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return request.Employees, nil
+	}
+}
+
+// CSV with a header row, columns may go in any order. Empty manager_id marks Claire. Errors refer to line numbers
+// of the file, so they can be fixed by hand, multiline quoted values are not supported
+func readCsv(r io.Reader) ([]*service.Employee, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for idx, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !csvColumns[name] {
+			return nil, fmt.Errorf("line 1: unknown column %q", name)
+		}
+		columns[name] = idx
+	}
+	for _, name := range []string{"id", "name"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("line 1: column %q is missing", name)
+		}
+	}
+
+	var employees []*service.Employee
+	seen := make(map[int]int)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if idx, ok := columns[name]; ok {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+
+		id, err := strconv.Atoi(value("id"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: id must be an integer, got %q", line, value("id"))
+		}
+		if previous, ok := seen[id]; ok {
+			return nil, fmt.Errorf("line %d: id %d is already used on line %d", line, id, previous)
+		}
+		seen[id] = line
+
+		employee := &service.Employee{
+			ID:    id,
+			Name:  value("name"),
+			Title: value("title"),
+			Mail:  value("mail"),
+		}
+		if manager := value("manager_id"); manager != "" {
+			managerId, err := strconv.Atoi(manager)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: manager_id must be an integer, got %q", line, manager)
+			}
+			employee.ManagerID = &managerId
+		}
+		employees = append(employees, employee)
+	}
+
+	// Report dangling managers with the line, service would only say that some edge is invalid
+	for _, employee := range employees {
+		if employee.ManagerID != nil {
+			if _, ok := seen[*employee.ManagerID]; !ok {
+				return nil, fmt.Errorf("line %d: manager_id %d does not match any employee",
+					seen[employee.ID], *employee.ManagerID)
+			}
+		}
+	}
+	return employees, nil
+}
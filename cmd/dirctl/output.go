@@ -0,0 +1,80 @@
+package main
+
+import (
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func writeJson(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func writeEmployee(w io.Writer, format string, employee *service.Employee) error {
+	if format == "json" {
+		return writeJson(w, employee)
+	}
+	return writeTable(w, []*service.Employee{employee})
+}
+
+func writeEmployees(w io.Writer, format string, employees []*service.Employee) error {
+	if format == "json" {
+		return writeJson(w, employees)
+	}
+	return writeTable(w, employees)
+}
+
+func writeTable(w io.Writer, employees []*service.Employee) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTITLE\tMANAGER\tREPORTS")
+	for _, employee := range employees {
+		manager := "-"
+		if employee.ManagerID != nil {
+			manager = strconv.Itoa(*employee.ManagerID)
+		}
+		reports := make([]string, len(employee.Subordinates))
+		for i, id := range employee.Subordinates {
+			reports[i] = strconv.Itoa(id)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", employee.ID, employee.Name, employee.Title, manager,
+			strings.Join(reports, ","))
+	}
+	return tw.Flush()
+}
+
+// Graphviz digraph with edges from managers to their reports, ordered by ID so exports are diffable
+func writeDot(w io.Writer, employees []*service.Employee) error {
+	sorted := make([]*service.Employee, len(employees))
+	copy(sorted, employees)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	var b strings.Builder
+	b.WriteString("digraph directory {\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, employee := range sorted {
+		label := employee.Name
+		if employee.Title != "" {
+			label += "\n" + employee.Title
+		}
+		fmt.Fprintf(&b, "  %d [label=%s];\n", employee.ID, strconv.Quote(label))
+	}
+	for _, employee := range sorted {
+		reports := append([]int(nil), employee.Subordinates...)
+		sort.Ints(reports)
+		for _, id := range reports {
+			fmt.Fprintf(&b, "  %d -> %d;\n", employee.ID, id)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -1,22 +1,216 @@
 package main
 
 import (
+	"context"
+	"corporate-directory/pkg/audit"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/events"
 	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/policy"
 	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/trace"
 	"corporate-directory/pkg/transport"
-	"log"
+	"corporate-directory/pkg/webhook"
+	"github.com/go-kit/kit/log"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Prepare solver
-	solver := &lca.OnlineLCASolver{}
+	os.Exit(run())
+}
+
+// Run the servers until a termination signal and return the exit code, so deferred cleanups run before exiting
+func run() int {
+	// Load configuration from flags, environment and config file
+	var logger log.Logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if err != nil {
+		_ = logger.Log("msg", "invalid configuration", "err", err)
+		return 2
+	}
+	if cfg.LogFormat == "json" {
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	}
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	_ = logger.Log("msg", "starting", "config", cfg)
+	if cfg.TraceExporter == "log" {
+		trace.SetExporter(trace.NewLogExporter(log.With(logger, "component", "trace")))
+	}
+
+	// Prepare metrics, exposed by HTTP transport at /metrics
+	requests := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "directory",
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Number of requests received.",
+	}, []string{"method"})
+	requestErrors := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "directory",
+		Subsystem: "api",
+		Name:      "errors_total",
+		Help:      "Number of requests failed with an error.",
+	}, []string{"method"})
+	requestDuration := kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "directory",
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Request duration in seconds.",
+	}, []string{"method", "success"})
+	setupDuration := kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "directory",
+		Name:      "setup_duration_seconds",
+		Help:      "Duration of setups in seconds, including validation and solver preprocessing.",
+		Buckets:   []float64{.001, .01, .1, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"success"})
+	preprocessing := kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "directory",
+		Name:      "solver_preprocessing_seconds",
+		Help:      "Duration of LCA solver preprocessing in seconds.",
+		Buckets:   []float64{.001, .01, .1, .5, 1, 2.5, 5, 10},
+	}, []string{})
+	employees := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "directory",
+		Name:      "employees",
+		Help:      "Number of employees in the directory.",
+	}, []string{})
+	depth := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "directory",
+		Name:      "tree_depth",
+		Help:      "Length of the longest management chain.",
+	}, []string{})
+
+	// Prepare service, restoring the org from the last snapshot if persistence is enabled
+	newSolver := lca.InstrumentingSolverFactory(cfg.SolverFactory(), preprocessing, employees, depth)
+	var svc service.CorporateDirectory = service.NewCorporateDirectoryService(newSolver)
+	svc = service.InstrumentingMiddleware(setupDuration)(svc)
+	svc = service.LoggingMiddleware(log.With(logger, "component", "service"))(svc)
+	if cfg.PersistenceDir != "" {
+		if svc, err = service.WithSnapshots(context.Background(), svc, cfg.PersistenceDir,
+			log.With(logger, "component", "snapshot")); err != nil {
+			_ = logger.Log("msg", "failed to restore snapshot", "err", err)
+			return 1
+		}
+	}
+	// Audit goes before visibility, so changes are recorded with all fields
+	var auditLog *audit.Log
+	if cfg.AuditLog != "" {
+		if auditLog, err = audit.Open(cfg.AuditLog, cfg.AuditRetention); err != nil {
+			_ = logger.Log("msg", "failed to open audit log", "err", err)
+			return 1
+		}
+		defer auditLog.Close()
+		svc = audit.Middleware(auditLog, log.With(logger, "component", "audit"))(svc)
+	}
+	// Events go before visibility too, as webhooks receive employees with all fields. Event streams redact them
+	// themselves for every client
+	webhookOptions := []webhook.Option{
+		webhook.WithAttempts(cfg.WebhookAttempts),
+		webhook.WithBackoff(cfg.WebhookBackoff, 5*time.Minute),
+		webhook.WithTimeout(cfg.WebhookTimeout),
+		webhook.WithLogger(log.With(logger, "component", "webhook")),
+	}
+	if cfg.PersistenceDir != "" {
+		webhookOptions = append(webhookOptions, webhook.WithFile(filepath.Join(cfg.PersistenceDir, "webhooks.json")))
+	}
+	webhooks, err := webhook.NewDispatcher(webhookOptions...)
+	if err != nil {
+		_ = logger.Log("msg", "failed to load webhooks", "err", err)
+		return 1
+	}
+	defer webhooks.Close()
+	stream := events.NewStream(cfg.EventBufferSize)
+	svc = events.Middleware(webhooks, stream)(svc)
+	// Visibility goes after snapshots, which must save all fields, and before tracing, so its checks aren't traced
+	visibility, err := cfg.VisibilityPolicy()
+	if err != nil {
+		_ = logger.Log("msg", "failed to load visibility policy", "err", err)
+		return 2
+	}
+	if visibility != nil {
+		svc = policy.Middleware(visibility)(svc)
+	}
+	svc = service.TracingMiddleware()(svc)
+
+	// Prepare servers, authentication comes last so rejected requests are still logged and counted
+	middlewares := []transport.Middleware{
+		transport.LoggingMiddleware(log.With(logger, "component", "transport")),
+		transport.InstrumentingMiddleware(requests, requestErrors, requestDuration),
+	}
+	authenticator, err := cfg.Authenticator()
+	if err != nil {
+		_ = logger.Log("msg", "failed to load credentials", "err", err)
+		return 2
+	}
+	if authenticator != nil {
+		middlewares = append(middlewares, transport.AuthMiddleware(authenticator))
+	} else {
+		_ = logger.Log("msg", "authentication is disabled, configure api-keys-file or jwt-secret to enable it")
+	}
+	httpOptions := []transport.Option{
+		transport.WithMiddlewares(middlewares...),
+		transport.WithWebhooks(webhooks),
+		transport.WithEventStream(stream),
+	}
+	if visibility != nil {
+		httpOptions = append(httpOptions, transport.WithVisibilityPolicy(visibility))
+	}
+	if auditLog != nil {
+		httpOptions = append(httpOptions, transport.WithAuditLog(auditLog))
+	}
+	server := transport.SetupHttpTransport(svc, cfg, httpOptions...)
+	grpcServer := transport.SetupGrpcTransport(svc, middlewares...)
 
-	// Prepare service
-	svc := service.NewCorporateDirectoryService(solver)
+	// Run until either server fails or a termination signal is received
+	errs := make(chan error, 2)
+	go func() {
+		listener, err := net.Listen("tcp", cfg.GrpcAddr)
+		if err != nil {
+			errs <- err
+			return
+		}
+		errs <- grpcServer.Serve(listener)
+	}()
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
 
-	// Prepare server
-	server := transport.SetupHttpTransport(svc)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-errs:
+		_ = logger.Log("msg", "server failed", "err", err)
+		return 1
+	case sig := <-signals:
+		_ = logger.Log("msg", "shutting down", "signal", sig)
+	}
 
-	// Run
-	log.Fatalln(server.ListenAndServe())
+	// Drain in-flight requests of both servers within the same deadline
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	if err := server.Shutdown(ctx); err != nil {
+		_ = logger.Log("msg", "http shutdown failed", "err", err)
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		_ = logger.Log("msg", "grpc shutdown failed", "err", ctx.Err())
+		grpcServer.Stop()
+	}
+	_ = logger.Log("msg", "stopped")
+	return 0
 }
@@ -3,7 +3,13 @@ module corporate-directory
 go 1.12
 
 require (
+	github.com/VividCortex/gohistogram v1.0.0 // indirect
 	github.com/go-kit/kit v0.9.0
-	github.com/go-logfmt/logfmt v0.4.0 // indirect
+	github.com/golang/protobuf v1.3.2
+	github.com/graphql-go/graphql v0.7.8
 	github.com/julienschmidt/httprouter v1.2.0
+	github.com/prometheus/client_golang v1.2.1
+	github.com/vmihailenco/msgpack v4.0.4+incompatible
+	google.golang.org/grpc v1.25.1
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//
+// Audit log of directory changes, stored as JSON lines in a local file. Entries are only ever appended, except for
+// entries older than the retention period, which are dropped by rewriting the file at most once a day.
+//
+
+// How often the file is checked for expired entries
+const compactionInterval = 24 * time.Hour
+
+// Actor of changes made without authentication
+const Anonymous = "anonymous"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Subject of the authenticated caller or Anonymous
+	Actor     string `json:"actor"`
+	Source    string `json:"source,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
+	// Service method, e.g. setup or update_employee
+	Action     string `json:"action"`
+	EmployeeID *int   `json:"employee_id,omitempty"`
+	// Counts of changes made by setup
+	Summary *Summary `json:"summary,omitempty"`
+	// Changed fields of single employee mutations
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+	// Changed fields of other employees by ID, e.g. reports moved to the manager of a removed employee
+	Related map[int]map[string]FieldChange `json:"related,omitempty"`
+	Outcome string                         `json:"outcome"`
+	Error   string                         `json:"error,omitempty"`
+}
+
+type Summary struct {
+	Before  int `json:"before"`
+	After   int `json:"after"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+// Old and new value of a field, absent on additions and removals respectively
+type FieldChange struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+type Log struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	// Entries older than that are dropped, zero keeps them forever
+	retention      time.Duration
+	lastCompaction time.Time
+	// Clock, replaced in tests
+	now func() time.Time
+}
+
+// Open the log at path for appending, creating it if needed, and drop expired entries
+func Open(path string, retention time.Duration) (*Log, error) {
+	l := &Log{path: path, retention: retention, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.retention > 0 && l.now().Sub(l.lastCompaction) >= compactionInterval {
+		if err := l.compact(); err != nil {
+			return err
+		}
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Query entries recorded at or after since, limited to the actor unless it is empty, oldest first
+func (l *Log) Query(since time.Time, actor string) ([]Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entries := make([]Entry, 0)
+	err := l.read(func(entry Entry) {
+		if !entry.Time.Before(since) && (actor == "" || entry.Actor == actor) {
+			entries = append(entries, entry)
+		}
+	})
+	return entries, err
+}
+
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+func (l *Log) read(fn func(Entry)) error {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry Entry
+		// A line torn by a crash is skipped rather than making the whole log unreadable
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			fn(entry)
+		}
+	}
+	return scanner.Err()
+}
+
+// Rewrite the file without expired entries and reopen it for appending. Must be called with mutex held
+func (l *Log) compact() error {
+	l.lastCompaction = l.now()
+	if l.retention > 0 {
+		cutoff := l.now().Add(-l.retention)
+		var kept []Entry
+		expired := false
+		if err := l.read(func(entry Entry) {
+			if entry.Time.Before(cutoff) {
+				expired = true
+			} else {
+				kept = append(kept, entry)
+			}
+		}); err != nil {
+			return err
+		}
+		if expired {
+			if err := l.rewrite(kept); err != nil {
+				return err
+			}
+		}
+	}
+	if l.file != nil {
+		_ = l.file.Close()
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	return nil
+}
+
+func (l *Log) rewrite(entries []Entry) error {
+	tmp := l.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+type sourceKey struct{}
+
+// NewSourceContext carries the address of the caller, set by transports
+func NewSourceContext(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+func SourceFromContext(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func tempLog(t *testing.T, retention time.Duration) (*Log, func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	l, err := Open(filepath.Join(dir, "audit.log"), retention)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	return l, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	l, cleanup := tempLog(t, 0)
+	defer cleanup()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, actor := range []string{"alice", "bob", "alice"} {
+		entry := Entry{Time: start.Add(time.Duration(i) * time.Hour), Actor: actor, Action: "setup"}
+		if err := l.Append(entry); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		since    time.Time
+		actor    string
+		expected int
+	}{
+		{time.Time{}, "", 3},
+		{start.Add(time.Hour), "", 2},
+		{time.Time{}, "alice", 2},
+		{start.Add(time.Hour), "alice", 1},
+		{time.Time{}, "carol", 0},
+	}
+	for _, test := range tests {
+		entries, err := l.Query(test.since, test.actor)
+		if err != nil || len(entries) != test.expected {
+			t.Errorf("since %v actor %q: expected %d entries, got %d %v", test.since, test.actor, test.expected,
+				len(entries), err)
+		}
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	l, cleanup := tempLog(t, 48*time.Hour)
+	defer cleanup()
+
+	now := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.lastCompaction = now
+	_ = l.Append(Entry{Time: now.Add(-72 * time.Hour), Actor: "old"})
+	_ = l.Append(Entry{Time: now.Add(-time.Hour), Actor: "recent"})
+
+	// Expired entries are dropped by the next compaction, at most a day later
+	now = now.Add(compactionInterval)
+	_ = l.Append(Entry{Time: now, Actor: "new"})
+	entries, _ := l.Query(time.Time{}, "")
+	if len(entries) != 2 || entries[0].Actor != "recent" || entries[1].Actor != "new" {
+		t.Errorf("unexpected entries after compaction %+v", entries)
+	}
+
+	// Reopened log keeps appending to the same file
+	l.Close()
+	reopened, err := Open(l.path, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen log: %v", err)
+	}
+	defer reopened.Close()
+	_ = reopened.Append(Entry{Time: time.Now(), Actor: "reopened"})
+	if entries, _ := reopened.Query(time.Time{}, ""); len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %+v", entries)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, cleanup := tempLog(t, 0)
+	defer cleanup()
+	var buf bytes.Buffer
+	dir := Middleware(l, log.NewLogfmtLogger(&buf))(service.NewCorporateDirectoryService(lca.NewOnlineLCASolver))
+
+	ctx := auth.NewContext(NewSourceContext(context.Background(), "10.0.0.1"),
+		auth.Identity{Subject: "hr-sync", Role: auth.RoleAdmin})
+	_ = dir.Setup(ctx, []*service.Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1)},
+	})
+	_ = dir.Setup(ctx, []*service.Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1), Title: "Engineer"},
+		{ID: 3, Name: "Bob", ManagerID: intPtr(2)},
+		{ID: 4, Name: "Dave", ManagerID: intPtr(2)},
+	})
+	_, _ = dir.UpdateEmployee(ctx, &service.Employee{ID: 3, Name: "Bob", ManagerID: intPtr(1), Title: "Sales"})
+	_ = dir.RemoveEmployee(ctx, 2)
+	_ = dir.RemoveEmployee(context.Background(), 1)
+
+	entries, err := l.Query(time.Time{}, "")
+	if err != nil || len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %+v %v", entries, err)
+	}
+	if e := entries[0]; e.Actor != "hr-sync" || e.Source != "10.0.0.1" || e.Outcome != OutcomeSuccess ||
+		*e.Summary != (Summary{Before: 0, After: 2, Added: 2}) {
+		t.Errorf("unexpected first setup entry %+v %+v", e, e.Summary)
+	}
+	if e := entries[1]; *e.Summary != (Summary{Before: 2, After: 4, Added: 2, Changed: 1}) {
+		t.Errorf("unexpected second setup summary %+v", e.Summary)
+	}
+	changes := entries[2].Changes
+	if len(changes) != 2 || changes["title"] != (FieldChange{New: "Sales"}) ||
+		changes["manager_id"] != (FieldChange{Old: 2.0, New: 1.0}) {
+		t.Errorf("unexpected update changes %+v", changes)
+	}
+	if e := entries[3]; e.Outcome != OutcomeSuccess || e.Changes["name"] != (FieldChange{Old: "Alice"}) ||
+		len(e.Related) != 1 || len(e.Related[4]) != 1 || e.Related[4]["manager_id"] != (FieldChange{Old: 2.0, New: 1.0}) {
+		t.Errorf("unexpected remove entry %+v", e)
+	}
+	if e := entries[4]; e.Actor != Anonymous || e.Outcome != OutcomeFailure || e.Error != service.ErrRemoveBoss.Error() ||
+		*e.EmployeeID != 1 {
+		t.Errorf("unexpected remove entry %+v", e)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected log output %s", buf.String())
+	}
+}
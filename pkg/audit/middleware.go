@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"reflect"
+	"time"
+)
+
+type auditMiddleware struct {
+	service.CorporateDirectory
+	log    *Log
+	logger log.Logger
+}
+
+// Middleware records every setup and mutation in the audit log, whether it succeeded or not. Changes are described by
+// the change set of the service, so it must wrap the service returning employees with all fields. Failures to write
+// the log are reported to logger, as the change has already been made by then
+func Middleware(l *Log, logger log.Logger) service.Middleware {
+	return func(next service.CorporateDirectory) service.CorporateDirectory {
+		return &auditMiddleware{CorporateDirectory: next, log: l, logger: logger}
+	}
+}
+
+func (mw *auditMiddleware) record(ctx context.Context, entry Entry, err error) {
+	entry.Time = time.Now().UTC()
+	entry.Actor = Anonymous
+	if identity, ok := auth.FromContext(ctx); ok {
+		entry.Actor = identity.Subject
+	}
+	entry.Source = SourceFromContext(ctx)
+	entry.RequestId = requestid.FromContext(ctx)
+	entry.Outcome = OutcomeSuccess
+	if err != nil {
+		entry.Outcome = OutcomeFailure
+		entry.Error = err.Error()
+	}
+	if logErr := mw.log.Append(entry); logErr != nil {
+		_ = mw.logger.Log("msg", "failed to write audit log", "action", entry.Action, "err", logErr)
+	}
+}
+
+func (mw *auditMiddleware) Setup(ctx context.Context, employees []*service.Employee) error {
+	ctx, changes := service.NewChangeSetContext(ctx)
+	err := mw.CorporateDirectory.Setup(ctx, employees)
+	mw.record(ctx, Entry{Action: "setup", Summary: summarize(changes)}, err)
+	return err
+}
+
+func (mw *auditMiddleware) AddEmployee(ctx context.Context, employee *service.Employee) (*service.Employee, error) {
+	ctx, changes := service.NewChangeSetContext(ctx)
+	res, err := mw.CorporateDirectory.AddEmployee(ctx, employee)
+	entry := Entry{Action: "add_employee"}
+	if res != nil {
+		entry.EmployeeID = &res.ID
+		describe(&entry, changes)
+	} else if employee.ID != 0 {
+		entry.EmployeeID = &employee.ID
+	}
+	mw.record(ctx, entry, err)
+	return res, err
+}
+
+func (mw *auditMiddleware) UpdateEmployee(ctx context.Context, employee *service.Employee) (*service.Employee, error) {
+	ctx, changes := service.NewChangeSetContext(ctx)
+	res, err := mw.CorporateDirectory.UpdateEmployee(ctx, employee)
+	entry := Entry{Action: "update_employee", EmployeeID: &employee.ID}
+	describe(&entry, changes)
+	mw.record(ctx, entry, err)
+	return res, err
+}
+
+func (mw *auditMiddleware) RemoveEmployee(ctx context.Context, id int) error {
+	ctx, changes := service.NewChangeSetContext(ctx)
+	err := mw.CorporateDirectory.RemoveEmployee(ctx, id)
+	entry := Entry{Action: "remove_employee", EmployeeID: &id}
+	describe(&entry, changes)
+	mw.record(ctx, entry, err)
+	return err
+}
+
+// Fill in changed fields of the employee of the entry and of others changed along, both taken from the states the
+// service changed between, so concurrent changes can't get mixed in
+func describe(entry *Entry, changes *service.ChangeSet) {
+	if !changes.Done() {
+		return
+	}
+	for _, change := range changes.Changes() {
+		employee := change.After
+		if employee == nil {
+			employee = change.Before
+		}
+		if employee.ID == *entry.EmployeeID {
+			entry.Changes = diff(change.Before, change.After)
+			continue
+		}
+		if entry.Related == nil {
+			entry.Related = make(map[int]map[string]FieldChange)
+		}
+		entry.Related[employee.ID] = diff(change.Before, change.After)
+	}
+}
+
+// Count employees added, removed and changed by setup
+func summarize(changes *service.ChangeSet) *Summary {
+	summary := &Summary{}
+	summary.Before, summary.After = changes.Sizes()
+	summary.Added, summary.Removed, summary.Changed = changes.Counts()
+	return summary
+}
+
+// Fields that differ between two versions of an employee as they appear in JSON, nil stands for no employee
+func diff(before, after *service.Employee) map[string]FieldChange {
+	old, updated := fields(before), fields(after)
+	changes := make(map[string]FieldChange)
+	for name, value := range old {
+		if !reflect.DeepEqual(value, updated[name]) {
+			changes[name] = FieldChange{Old: value, New: updated[name]}
+		}
+	}
+	for name, value := range updated {
+		if _, ok := old[name]; !ok {
+			changes[name] = FieldChange{New: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func fields(employee *service.Employee) map[string]interface{} {
+	res := make(map[string]interface{})
+	if employee == nil {
+		return res
+	}
+	data, _ := json.Marshal(employee)
+	_ = json.Unmarshal(data, &res)
+	delete(res, "subordinates")
+	return res
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUnauthenticated = errors.New(`missing or invalid credentials`)
+	ErrForbidden       = errors.New(`caller is not allowed to perform this operation`)
+	ErrUnknownRole     = errors.New(`role must be reader or hr_admin`)
+)
+
+// Role of the caller, every role includes permissions of the roles before it
+type Role string
+
+const (
+	// May only query the directory
+	RoleReader Role = "reader"
+	// May additionally set up and change the directory
+	RoleAdmin Role = "hr_admin"
+)
+
+var roleLevels = map[Role]int{
+	RoleReader: 1,
+	RoleAdmin:  2,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Includes reports whether role r grants everything other grants
+func (r Role) Includes(other Role) bool {
+	return r.Valid() && roleLevels[r] >= roleLevels[other]
+}
+
+// Authenticated caller
+type Identity struct {
+	// Name of the key owner or sub claim of the token
+	Subject string
+	Role    Role
+	// Employee the caller is, if any, used to decide what of the org the caller may see
+	EmployeeID *int
+}
+
+// Authenticator resolves credentials sent by the caller, i.e. an API key or a bearer token, to an identity.
+// Unknown credentials are reported as ErrUnauthenticated
+type Authenticator interface {
+	Authenticate(ctx context.Context, credentials string) (Identity, error)
+}
+
+type chain []Authenticator
+
+// Chain tries authenticators in order and returns the first identity found
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
+
+func (c chain) Authenticate(ctx context.Context, credentials string) (Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(ctx, credentials)
+		if err != ErrUnauthenticated {
+			return identity, err
+		}
+	}
+	return Identity{}, ErrUnauthenticated
+}
+
+type identityKey struct{}
+
+type credentialsKey struct{}
+
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns identity of the authenticated caller, false when authentication is disabled
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// NewCredentialsContext carries credentials taken from the request by transport until they are authenticated
+func NewCredentialsContext(ctx context.Context, credentials string) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, credentials)
+}
+
+func CredentialsFromContext(ctx context.Context) string {
+	credentials, _ := ctx.Value(credentialsKey{}).(string)
+	return credentials
+}
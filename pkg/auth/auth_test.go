@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJwtAuthenticator(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	authenticator := NewJwtAuthenticator([]byte("secret"))
+	authenticator.now = func() time.Time { return now }
+	other := NewJwtAuthenticator([]byte("other"))
+	other.now = authenticator.now
+
+	admin := Identity{Subject: "hr-sync", Role: RoleAdmin}
+	valid, _ := authenticator.NewToken(admin, time.Hour)
+	expired, _ := authenticator.NewToken(admin, -time.Second)
+	foreign, _ := other.NewToken(admin, time.Hour)
+	noRole, _ := authenticator.NewToken(Identity{Subject: "nobody"}, time.Hour)
+	parts := strings.Split(valid, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"sub":"hr-sync","role":"hr_admin","exp":9999999999}`)) + "." + parts[2]
+
+	identity, err := authenticator.Authenticate(context.Background(), valid)
+	if err != nil || identity != admin {
+		t.Errorf("expected %v, got %v %v", admin, identity, err)
+	}
+	for name, token := range map[string]string{
+		"expired": expired, "foreign": foreign, "no role": noRole, "none": none, "tampered": tampered, "garbage": "a.b",
+	} {
+		if _, err := authenticator.Authenticate(context.Background(), token); err != ErrUnauthenticated {
+			t.Errorf("%s: expected %v, got %v", name, ErrUnauthenticated, err)
+		}
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	keys, err := LoadApiKeys("testdata/keys.yaml")
+	if err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	identity, err := keys.Authenticate(context.Background(), "admin-key")
+	if err != nil || identity.Subject != "hr-sync" || identity.Role != RoleAdmin {
+		t.Errorf("unexpected identity %v %v", identity, err)
+	}
+	if _, err := keys.Authenticate(context.Background(), "unknown"); err != ErrUnauthenticated {
+		t.Errorf("expected %v, got %v", ErrUnauthenticated, err)
+	}
+	if _, err := LoadApiKeys("testdata/invalid_role.yaml"); err == nil {
+		t.Errorf("expected error for unknown role")
+	}
+}
+
+func TestChain(t *testing.T) {
+	keys := make(ApiKeys)
+	keys.Add("reader-key", Identity{Subject: "ui", Role: RoleReader})
+	jwt := NewJwtAuthenticator([]byte("secret"))
+	token, _ := jwt.NewToken(Identity{Subject: "hr-sync", Role: RoleAdmin}, 0)
+	authenticator := Chain(keys, jwt)
+
+	if identity, err := authenticator.Authenticate(context.Background(), "reader-key"); err != nil ||
+		identity.Subject != "ui" {
+		t.Errorf("API key was not accepted: %v %v", identity, err)
+	}
+	if identity, err := authenticator.Authenticate(context.Background(), token); err != nil ||
+		identity.Subject != "hr-sync" {
+		t.Errorf("token was not accepted: %v %v", identity, err)
+	}
+	if _, err := authenticator.Authenticate(context.Background(), "unknown"); err != ErrUnauthenticated {
+		t.Errorf("expected %v, got %v", ErrUnauthenticated, err)
+	}
+}
+
+func TestRoleIncludes(t *testing.T) {
+	if !RoleAdmin.Includes(RoleReader) || RoleReader.Includes(RoleAdmin) || Role("root").Includes(RoleReader) {
+		t.Errorf("unexpected role hierarchy")
+	}
+}
@@ -0,0 +1,490 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/trace"
+	"corporate-directory/pkg/transport"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//
+// Client for the HTTP transport implementing CorporateDirectory, so it can be used in place of the in-process service.
+// Every call is bounded by a timeout covering all of its attempts, idempotent calls are retried on transport failures
+// and 5xx responses after an exponentially growing, randomized delay.
+//
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultRetries    = 3
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+type clientOptions struct {
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	httpClient httptransport.HTTPClient
+	token      string
+}
+
+type Option func(*clientOptions)
+
+// Overall time limit of a single call including retries, context deadline applies as well
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *clientOptions) {
+		c.timeout = timeout
+	}
+}
+
+// Maximum number of attempts for idempotent calls, 1 disables retries
+func WithRetries(retries int) Option {
+	return func(c *clientOptions) {
+		c.retries = retries
+	}
+}
+
+// Upper bound of the delay before the first retry, doubled for each next one up to max. Actual delay is picked at
+// random below the bound, so clients failing together don't retry together
+func WithBackoff(initial, max time.Duration) Option {
+	return func(c *clientOptions) {
+		c.backoff, c.maxBackoff = initial, max
+	}
+}
+
+func WithHttpClient(client httptransport.HTTPClient) Option {
+	return func(c *clientOptions) {
+		c.httpClient = client
+	}
+}
+
+// API key or JWT sent as bearer token with every call
+func WithToken(token string) Option {
+	return func(c *clientOptions) {
+		c.token = token
+	}
+}
+
+type Client struct {
+	setup          endpoint.Endpoint
+	commonManager  endpoint.Endpoint
+	commonBatch    endpoint.Endpoint
+	getEmployee    endpoint.Endpoint
+	getEmployees   endpoint.Endpoint
+	addEmployee    endpoint.Endpoint
+	updateEmployee endpoint.Endpoint
+	removeEmployee endpoint.Endpoint
+	ready          endpoint.Endpoint
+}
+
+var _ service.CorporateDirectory = (*Client)(nil)
+
+// New creates a client for the service at instance, given either as host:port or as a base URL
+func New(instance string, options ...Option) (*Client, error) {
+	if !strings.HasPrefix(instance, "http://") && !strings.HasPrefix(instance, "https://") {
+		instance = "http://" + instance
+	}
+	base, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	cfg := clientOptions{
+		timeout:    defaultTimeout,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+		httpClient: http.DefaultClient,
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	makeEndpoint := func(method string, encode httptransport.EncodeRequestFunc,
+		decode httptransport.DecodeResponseFunc, retries int) endpoint.Endpoint {
+		e := httptransport.NewClient(method, base, encode, decode, httptransport.SetClient(cfg.httpClient),
+			httptransport.ClientBefore(injectTraceparent, setToken(cfg.token))).Endpoint()
+		balancer := lb.NewRoundRobin(sd.FixedEndpointer{delayRetries(cfg.backoff, cfg.maxBackoff, e)})
+		return countAttempts(unwrapRetryError(lb.RetryWithCallback(cfg.timeout, balancer, retryCallback(retries))))
+	}
+
+	return &Client{
+		setup:          makeEndpoint("POST", encodeSetupRequest, decodeSetupResponse, cfg.retries),
+		commonManager:  makeEndpoint("GET", encodeCommonManagerRequest, decodeCommonManagerResponse, cfg.retries),
+		commonBatch:    makeEndpoint("POST", encodeCommonManagerBatchRequest, decodeCommonManagerBatchResponse, cfg.retries),
+		getEmployee:    makeEndpoint("GET", encodeGetEmployeeRequest, decodeGetEmployeeResponse, cfg.retries),
+		getEmployees:   makeEndpoint("GET", encodeGetEmployeesRequest, decodeGetEmployeesResponse, cfg.retries),
+		updateEmployee: makeEndpoint("PUT", encodeUpdateEmployeeRequest, decodeGetEmployeeResponse, cfg.retries),
+		// Adding without ID is not idempotent and a retried delete would fail with not found, so both are sent once
+		addEmployee:    makeEndpoint("POST", encodeAddEmployeeRequest, decodeGetEmployeeResponse, 1),
+		removeEmployee: makeEndpoint("DELETE", encodeRemoveEmployeeRequest, decodeRemoveEmployeeResponse, 1),
+		ready:          makeEndpoint("GET", encodeReadyRequest, decodeReadyResponse, 1),
+	}, nil
+}
+
+// Propagate the trace of ctx, so calls show up in the server's trace as children of the caller's span
+func injectTraceparent(ctx context.Context, r *http.Request) context.Context {
+	if traceparent := trace.Traceparent(ctx); traceparent != "" {
+		r.Header.Set(trace.TraceparentHeader, traceparent)
+	}
+	return ctx
+}
+
+func setToken(token string) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return ctx
+	}
+}
+
+func (c *Client) Setup(ctx context.Context, employees []*service.Employee) error {
+	_, err := c.setup(ctx, transport.SetupRequest{Employees: employees})
+	return err
+}
+
+func (c *Client) GetCommonManager(ctx context.Context, first, second int) (*service.Employee, error) {
+	res, err := c.commonManager(ctx, transport.CommonManagerRequest{First: first, Second: second})
+	if err != nil {
+		return nil, err
+	}
+	return res.(transport.CommonManagerResponse).Common, nil
+}
+
+// Errors of single pairs are mapped back to service errors as errors of whole calls are
+func (c *Client) GetCommonManagers(ctx context.Context, pairs []service.EmployeePair) (
+	[]service.CommonManagerResult, error) {
+	res, err := c.commonBatch(ctx, transport.CommonManagerBatchRequest{Pairs: pairs})
+	if err != nil {
+		return nil, err
+	}
+	results := res.(transport.CommonManagerBatchResponse).Results
+	managers := make([]service.CommonManagerResult, len(results))
+	for idx, result := range results {
+		managers[idx].Manager = result.Common
+		if result.Error != nil {
+			managers[idx].Err = transport.FromApiError(result.Error)
+		}
+	}
+	return managers, nil
+}
+
+func (c *Client) GetEmployee(ctx context.Context, id int) (*service.Employee, error) {
+	res, err := c.getEmployee(ctx, transport.GetEmployeeRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return res.(transport.GetEmployeeResponse).Employee, nil
+}
+
+func (c *Client) GetEmployees(ctx context.Context) ([]*service.Employee, error) {
+	res, err := c.getEmployees(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.(transport.GetEmployeesResponse).Employees, nil
+}
+
+// Pages without a sort come in ID order, as they do from the service. Of custom attributes only department can be
+// filtered by
+func (c *Client) ListEmployees(ctx context.Context, query service.EmployeeQuery) (*service.EmployeePage, error) {
+	res, err := c.getEmployees(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	response := res.(transport.GetEmployeesResponse)
+	page := &service.EmployeePage{Employees: response.Employees}
+	if response.NextCursor != "" {
+		if _, page.Next, err = transport.DecodeCursor(response.NextCursor); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func (c *Client) AddEmployee(ctx context.Context, employee *service.Employee) (*service.Employee, error) {
+	res, err := c.addEmployee(ctx, transport.AddEmployeeRequest{Employee: employee})
+	if err != nil {
+		return nil, err
+	}
+	return res.(transport.GetEmployeeResponse).Employee, nil
+}
+
+func (c *Client) UpdateEmployee(ctx context.Context, employee *service.Employee) (*service.Employee, error) {
+	res, err := c.updateEmployee(ctx, transport.UpdateEmployeeRequest{Employee: employee})
+	if err != nil {
+		return nil, err
+	}
+	return res.(transport.GetEmployeeResponse).Employee, nil
+}
+
+func (c *Client) RemoveEmployee(ctx context.Context, id int) error {
+	_, err := c.removeEmployee(ctx, transport.RemoveEmployeeRequest{Id: id})
+	return err
+}
+
+// Server is considered not ready when it can't be reached as well
+func (c *Client) Ready(ctx context.Context) bool {
+	_, err := c.ready(ctx, nil)
+	return err == nil
+}
+
+// Version is taken from the readiness probe, zero when the server is not ready or can't be reached
+func (c *Client) Version(ctx context.Context) uint64 {
+	res, err := c.ready(ctx, nil)
+	if err != nil {
+		return 0
+	}
+	return res.(transport.HealthResponse).Version
+}
+
+func encodeSetupRequest(_ context.Context, r *http.Request, request interface{}) error {
+	r.URL.Path += "/setup"
+	return setJsonBody(r, request.(transport.SetupRequest))
+}
+
+func encodeCommonManagerRequest(_ context.Context, r *http.Request, request interface{}) error {
+	req := request.(transport.CommonManagerRequest)
+	r.URL.Path += "/common"
+	query := url.Values{}
+	query.Set("first", strconv.Itoa(req.First))
+	query.Set("second", strconv.Itoa(req.Second))
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
+func encodeCommonManagerBatchRequest(_ context.Context, r *http.Request, request interface{}) error {
+	r.URL.Path += "/common/batch"
+	return setJsonBody(r, request.(transport.CommonManagerBatchRequest).Pairs)
+}
+
+func encodeGetEmployeeRequest(_ context.Context, r *http.Request, request interface{}) error {
+	r.URL.Path += employeePath(request.(transport.GetEmployeeRequest).Id)
+	return nil
+}
+
+func encodeGetEmployeesRequest(_ context.Context, r *http.Request, request interface{}) error {
+	r.URL.Path += "/employees"
+	req, ok := request.(service.EmployeeQuery)
+	if !ok {
+		return nil
+	}
+	query := url.Values{}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+	sort := req.Sort
+	if sort == "" && (req.Limit > 0 || req.After != nil) {
+		sort = service.SortByID
+	}
+	if sort != "" {
+		query.Set("sort", sort)
+		if cursor := transport.EncodeCursor(sort, req.After); cursor != "" {
+			query.Set("cursor", cursor)
+		}
+	}
+	if req.ManagerID != nil {
+		query.Set("manager", strconv.Itoa(*req.ManagerID))
+	}
+	for key, value := range req.Custom {
+		if key != "department" {
+			return fmt.Errorf("custom attribute %q can not be filtered by", key)
+		}
+		query.Set("department", value)
+	}
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
+func encodeAddEmployeeRequest(_ context.Context, r *http.Request, request interface{}) error {
+	r.URL.Path += "/employees"
+	return setJsonBody(r, request.(transport.AddEmployeeRequest).Employee)
+}
+
+func encodeUpdateEmployeeRequest(_ context.Context, r *http.Request, request interface{}) error {
+	employee := request.(transport.UpdateEmployeeRequest).Employee
+	r.URL.Path += employeePath(employee.ID)
+	return setJsonBody(r, employee)
+}
+
+func encodeRemoveEmployeeRequest(_ context.Context, r *http.Request, request interface{}) error {
+	r.URL.Path += employeePath(request.(transport.RemoveEmployeeRequest).Id)
+	return nil
+}
+
+func encodeReadyRequest(_ context.Context, r *http.Request, _ interface{}) error {
+	r.URL.Path += "/readyz"
+	return nil
+}
+
+func employeePath(id int) string {
+	return "/employees/" + strconv.Itoa(id)
+}
+
+func setJsonBody(r *http.Request, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.ContentLength = int64(len(data))
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return nil
+}
+
+func decodeSetupResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.SetupResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeCommonManagerResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.CommonManagerResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeCommonManagerBatchResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.CommonManagerBatchResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetEmployeeResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.GetEmployeeResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeGetEmployeesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.GetEmployeesResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeRemoveEmployeeResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.RemoveEmployeeResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeReadyResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response transport.HealthResponse
+	if err := decodeJsonBody(resp, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Decode successful response into v, any other status is turned into *transport.ApiError. Responses not coming from
+// the service, e.g. from a proxy in front of it, get a generic error with the received status.
+func decodeJsonBody(resp *http.Response, v interface{}) error {
+	if resp.StatusCode == http.StatusOK {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	var response transport.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error == nil {
+		return &transport.ApiError{Status: resp.StatusCode, Message: fmt.Sprintf("unexpected response %s", resp.Status)}
+	}
+	response.Error.Status = resp.StatusCode
+	return response.Error
+}
+
+// Errors reported by the service are final, anything else like connection failures or 5xx from a proxy is retried
+func retryCallback(max int) lb.Callback {
+	return func(n int, err error) (bool, error) {
+		if n >= max {
+			return false, nil
+		}
+		if apiErr, ok := err.(*transport.ApiError); ok {
+			return apiErr.Status >= http.StatusInternalServerError, nil
+		}
+		return true, nil
+	}
+}
+
+type attemptsKey struct{}
+
+// Count attempts of every call, so delayRetries knows which one it is making
+func countAttempts(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return next(context.WithValue(ctx, attemptsKey{}, new(int32)), request)
+	}
+}
+
+// Wait before every attempt except the first one, giving up when ctx is done
+func delayRetries(backoff, maxBackoff time.Duration, next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if attempts, ok := ctx.Value(attemptsKey{}).(*int32); ok {
+			if attempt := atomic.AddInt32(attempts, 1); attempt > 1 {
+				timer := time.NewTimer(retryDelay(backoff, maxBackoff, int(attempt)))
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+		return next(ctx, request)
+	}
+}
+
+// Random delay before the given attempt, up to backoff doubled for every retry before it and capped by maxBackoff
+func retryDelay(backoff, maxBackoff time.Duration, attempt int) time.Duration {
+	bound := backoff
+	for i := 2; i < attempt && bound < maxBackoff; i++ {
+		bound *= 2
+	}
+	if bound > maxBackoff {
+		bound = maxBackoff
+	}
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// Callers get the error of the last attempt instead of lb.RetryError, mapped back to service errors where possible
+func unwrapRetryError(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		res, err := next(ctx, request)
+		if retryErr, ok := err.(lb.RetryError); ok {
+			err = retryErr.Final
+		}
+		if apiErr, ok := err.(*transport.ApiError); ok {
+			err = transport.FromApiError(apiErr)
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/transport"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func setupClient(t *testing.T) (*Client, *httptest.Server) {
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := httptest.NewServer(transport.SetupHttpTransport(svc, config.Default()).Handler)
+	client, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	employees := []*service.Employee{
+		{ID: 1, Name: "Claire", Title: "CEO"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1)},
+		{ID: 3, Name: "Bob", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Carol", ManagerID: intPtr(2)},
+	}
+	if err := client.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return client, server
+}
+
+func TestClient(t *testing.T) {
+	client, server := setupClient(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	common, err := client.GetCommonManager(ctx, 4, 3)
+	if err != nil || common.ID != 1 {
+		t.Errorf("unexpected common manager %+v, %v", common, err)
+	}
+
+	batch, err := client.GetCommonManagers(ctx, []service.EmployeePair{{First: 4, Second: 3}, {First: 4, Second: 9}})
+	if err != nil || len(batch) != 2 || batch[0].Manager.ID != 1 || batch[1].Err != service.ErrInvalidEmployee {
+		t.Errorf("unexpected common managers %+v, %v", batch, err)
+	}
+
+	employee, err := client.GetEmployee(ctx, 2)
+	if err != nil || employee.Name != "Alice" || len(employee.Subordinates) != 1 || employee.Subordinates[0] != 4 {
+		t.Errorf("unexpected employee %+v, %v", employee, err)
+	}
+
+	added, err := client.AddEmployee(ctx, &service.Employee{Name: "Dave", ManagerID: intPtr(3)})
+	if err != nil || added.ID != 5 {
+		t.Fatalf("unexpected added employee %+v, %v", added, err)
+	}
+
+	updated, err := client.UpdateEmployee(ctx, &service.Employee{ID: 5, Name: "Dave", ManagerID: intPtr(4)})
+	if err != nil || *updated.ManagerID != 4 {
+		t.Errorf("unexpected updated employee %+v, %v", updated, err)
+	}
+
+	if err := client.RemoveEmployee(ctx, 4); err != nil {
+		t.Errorf("remove failed: %v", err)
+	}
+	employees, err := client.GetEmployees(ctx)
+	if err != nil || len(employees) != 4 {
+		t.Errorf("unexpected employees %+v, %v", employees, err)
+	}
+	page, err := client.ListEmployees(ctx, service.EmployeeQuery{Limit: 2, Sort: service.SortByName})
+	if err != nil || len(page.Employees) != 2 || page.Employees[0].Name != "Alice" || page.Next == nil {
+		t.Fatalf("unexpected page %+v, %v", page, err)
+	}
+	page, err = client.ListEmployees(ctx, service.EmployeeQuery{Limit: 2, Sort: service.SortByName, After: page.Next})
+	if err != nil || len(page.Employees) != 2 || page.Employees[1].Name != "Dave" || page.Next != nil {
+		t.Errorf("unexpected page %+v, %v", page, err)
+	}
+	if !client.Ready(ctx) {
+		t.Errorf("expected set up directory to be ready")
+	}
+	if version := client.Version(ctx); version != 4 {
+		t.Errorf("expected version 4 after setup and three mutations, got %d", version)
+	}
+}
+
+func TestClientPagesWithoutSort(t *testing.T) {
+	client, server := setupClient(t)
+	defer server.Close()
+
+	var ids []int
+	query := service.EmployeeQuery{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("paging did not end, got %v", ids)
+		}
+		page, err := client.ListEmployees(context.Background(), query)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		for _, employee := range page.Employees {
+			ids = append(ids, employee.ID)
+		}
+		if page.Next == nil {
+			break
+		}
+		query.After = page.Next
+	}
+	if len(ids) != 4 || ids[0] != 1 || ids[3] != 4 {
+		t.Errorf("unexpected employees %v", ids)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	client, server := setupClient(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	if _, err := client.GetEmployee(ctx, 10); err != service.ErrInvalidEmployee {
+		t.Errorf("expected ErrInvalidEmployee, got %v", err)
+	}
+	if err := client.RemoveEmployee(ctx, 1); err != service.ErrRemoveBoss {
+		t.Errorf("expected ErrRemoveBoss, got %v", err)
+	}
+	if err := client.Setup(ctx, []*service.Employee{{ID: 1, Name: "Alice"}}); err != service.ErrBossNotFound {
+		t.Errorf("expected ErrBossNotFound, got %v", err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	keys := make(auth.ApiKeys)
+	keys.Add("admin-key", auth.Identity{Subject: "hr-sync", Role: auth.RoleAdmin})
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := httptest.NewServer(transport.SetupHttpTransport(svc, config.Default(),
+		transport.WithMiddlewares(transport.AuthMiddleware(keys))).Handler)
+	defer server.Close()
+	ctx := context.Background()
+
+	anonymous, _ := New(server.URL)
+	if err := anonymous.Setup(ctx, []*service.Employee{{ID: 1, Name: "Claire"}}); err != auth.ErrUnauthenticated {
+		t.Errorf("expected ErrUnauthenticated, got %v", err)
+	}
+	admin, _ := New(server.URL, WithToken("admin-key"))
+	if err := admin.Setup(ctx, []*service.Employee{{ID: 1, Name: "Claire"}}); err != nil {
+		t.Errorf("setup failed: %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"employees":[]}`))
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL, WithRetries(3))
+	if _, err := client.GetEmployees(context.Background()); err != nil || calls != 3 {
+		t.Errorf("expected success after 3 attempts, got %d attempts, %v", calls, err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client, _ = New(server.URL, WithRetries(2))
+	if _, err := client.GetEmployees(context.Background()); err == nil || calls != 2 {
+		t.Errorf("expected failure after 2 attempts, got %d attempts, %v", calls, err)
+	}
+
+	// Not idempotent calls are never retried
+	atomic.StoreInt32(&calls, 0)
+	client, _ = New(server.URL, WithRetries(3))
+	if _, err := client.AddEmployee(context.Background(), &service.Employee{Name: "Dave"}); err == nil || calls != 1 {
+		t.Errorf("expected single failed attempt, got %d attempts, %v", calls, err)
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	var calls int32
+	var last time.Time
+	var gaps []time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			gaps = append(gaps, time.Since(last))
+		}
+		last = time.Now()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL, WithRetries(4), WithBackoff(20*time.Millisecond, 40*time.Millisecond))
+	if _, err := client.GetEmployees(context.Background()); err == nil || calls != 4 {
+		t.Fatalf("expected failure after 4 attempts, got %d attempts, %v", calls, err)
+	}
+	for i, gap := range gaps {
+		if gap > time.Second {
+			t.Errorf("retry %d waited %v, above the backoff bound", i+1, gap)
+		}
+	}
+
+	// Waiting for the next attempt stops with the caller's context
+	atomic.StoreInt32(&calls, 0)
+	client, _ = New(server.URL, WithRetries(3), WithBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.GetEmployees(ctx); err != context.DeadlineExceeded || calls != 1 {
+		t.Errorf("expected deadline exceeded after 1 attempt, got %d attempts, %v", calls, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("backoff did not honor the context")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, bound := range []time.Duration{2: 10, 3: 20, 4: 40, 5: 50, 10: 50} {
+		if bound == 0 {
+			continue
+		}
+		for i := 0; i < 100; i++ {
+			if delay := retryDelay(10, 50, attempt); delay < 0 || delay > bound {
+				t.Fatalf("attempt %d: delay %v out of [0, %v]", attempt, delay, bound)
+			}
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL, WithTimeout(50*time.Millisecond))
+	start := time.Now()
+	if _, err := client.GetEmployees(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("timeout was not respected")
+	}
+
+	// Deadline of the caller's context applies as well
+	client, _ = New(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetEmployees(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"bytes"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/policy"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownSolver = errors.New(`unknown solver`)
+	ErrUnknownOption = errors.New(`unknown configuration option`)
+	ErrInvalidLimit  = errors.New(`size limits must be positive`)
+	ErrLogFormat     = errors.New(`log format must be logfmt or json`)
+	ErrTraceExporter = errors.New(`trace exporter must be none or log`)
+	ErrRetention     = errors.New(`audit retention must not be negative`)
+	ErrWebhookRetry  = errors.New(`webhook attempts, backoff and timeout must be positive`)
+)
+
+// Prefix of environment variables, e.g. DIRECTORY_HTTP_ADDR for -http-addr
+const envPrefix = "DIRECTORY_"
+
+// Options never written out in full, e.g. when logging effective configuration
+var secretOptions = map[string]bool{
+	"jwt-secret": true,
+}
+
+// Available LCA solvers by name
+var solvers = map[string]lca.SolverFactory{
+	"online": lca.NewOnlineLCASolver,
+}
+
+// Server configuration. Every option can be given as a flag, as an environment variable or in the config file under
+// the flag name, in order of precedence.
+type Config struct {
+	// Optional YAML or JSON file, format is chosen by extension
+	ConfigFile string
+
+	HttpAddr       string
+	GrpcAddr       string
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	MaxHeaderBytes int
+	// Time given to in-flight requests to finish on SIGTERM or SIGINT
+	ShutdownTimeout time.Duration
+	// Limit of POST /setup body, larger requests are rejected with 413
+	MaxSetupBodyBytes int64
+	// Most pairs of POST /common/batch, larger batches are rejected with 413
+	MaxBatchSize int
+
+	Solver string
+	// Directory for org snapshots, persistence is disabled when empty
+	PersistenceDir string
+
+	// Either logfmt or json
+	LogFormat string
+	// Where finished spans go, none disables tracing and log writes them to the log
+	TraceExporter string
+
+	// YAML file with API keys, see auth.LoadApiKeys
+	ApiKeysFile string
+	// Shared secret of HS256 JWT bearer tokens. Authentication is disabled when neither keys nor secret are given
+	JwtSecret string
+	// YAML file with visibility rules of employee fields, see policy.Load. All fields are public when empty
+	VisibilityPolicyFile string
+
+	// File of the audit log, auditing is disabled when empty
+	AuditLog string
+	// How long audit entries are kept, zero keeps them forever
+	AuditRetention time.Duration
+
+	// Events kept for clients of GET /events resuming with Last-Event-ID
+	EventBufferSize int
+	// Delivery attempts of every webhook event, including the first one
+	WebhookAttempts int
+	// Bound of the random delay before the first retry of a webhook delivery, doubled for each next one
+	WebhookBackoff time.Duration
+	// Timeout of a single webhook delivery attempt
+	WebhookTimeout time.Duration
+}
+
+func Default() *Config {
+	return &Config{
+		HttpAddr:          ":80",
+		GrpcAddr:          ":9090",
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   15 * time.Second,
+		MaxSetupBodyBytes: 64 << 20,
+		MaxBatchSize:      1000,
+		Solver:            "online",
+		LogFormat:         "logfmt",
+		TraceExporter:     "none",
+		EventBufferSize:   1024,
+		WebhookAttempts:   5,
+		WebhookBackoff:    time.Second,
+		WebhookTimeout:    10 * time.Second,
+	}
+}
+
+// Flags bound to the fields of cfg, also used to set options coming from environment and config file
+func (cfg *Config) flagSet(output io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "YAML or JSON config file")
+	flags.StringVar(&cfg.HttpAddr, "http-addr", cfg.HttpAddr, "HTTP listen address")
+	flags.StringVar(&cfg.GrpcAddr, "grpc-addr", cfg.GrpcAddr, "gRPC listen address")
+	flags.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "HTTP read timeout")
+	flags.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "HTTP write timeout")
+	flags.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", cfg.MaxHeaderBytes, "maximum size of HTTP request headers")
+	flags.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout,
+		"time to drain in-flight requests on shutdown")
+	flags.Int64Var(&cfg.MaxSetupBodyBytes, "max-setup-body-bytes", cfg.MaxSetupBodyBytes,
+		"maximum size of setup request body")
+	flags.IntVar(&cfg.MaxBatchSize, "max-batch-size", cfg.MaxBatchSize, "maximum pairs of a common manager batch")
+	flags.StringVar(&cfg.Solver, "solver", cfg.Solver, "LCA solver, one of: "+strings.Join(solverNames(), ", "))
+	flags.StringVar(&cfg.PersistenceDir, "persistence-dir", cfg.PersistenceDir,
+		"directory for org snapshots, empty disables persistence")
+	flags.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format, logfmt or json")
+	flags.StringVar(&cfg.TraceExporter, "trace-exporter", cfg.TraceExporter, "trace exporter, none or log")
+	flags.StringVar(&cfg.ApiKeysFile, "api-keys-file", cfg.ApiKeysFile, "YAML file with API keys")
+	flags.StringVar(&cfg.JwtSecret, "jwt-secret", cfg.JwtSecret, "secret of HS256 JWT bearer tokens")
+	flags.StringVar(&cfg.VisibilityPolicyFile, "visibility-policy-file", cfg.VisibilityPolicyFile,
+		"YAML file with visibility rules of employee fields")
+	flags.StringVar(&cfg.AuditLog, "audit-log", cfg.AuditLog, "file of the audit log, empty disables auditing")
+	flags.DurationVar(&cfg.AuditRetention, "audit-retention", cfg.AuditRetention,
+		"how long audit entries are kept, 0 keeps them forever")
+	flags.IntVar(&cfg.EventBufferSize, "event-buffer-size", cfg.EventBufferSize,
+		"events kept for resuming event streams")
+	flags.IntVar(&cfg.WebhookAttempts, "webhook-attempts", cfg.WebhookAttempts,
+		"delivery attempts of every webhook event")
+	flags.DurationVar(&cfg.WebhookBackoff, "webhook-backoff", cfg.WebhookBackoff,
+		"bound of the random delay before the first retry of a webhook delivery, doubled for each next one")
+	flags.DurationVar(&cfg.WebhookTimeout, "webhook-timeout", cfg.WebhookTimeout,
+		"timeout of a single webhook delivery attempt")
+	return flags
+}
+
+// Load configuration from command line arguments, environment and the config file. Flags take precedence over
+// environment, which takes precedence over the file
+func Load(args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	cfg := Default()
+	flags := cfg.flagSet(output)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	if !explicit["config"] {
+		cfg.ConfigFile = getenv(envName("config"))
+	}
+
+	if cfg.ConfigFile != "" {
+		options, err := readFile(cfg.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range options {
+			if flags.Lookup(name) == nil || name == "config" {
+				return nil, fmt.Errorf("%s: %v %q", cfg.ConfigFile, ErrUnknownOption, name)
+			}
+			if explicit[name] {
+				continue
+			}
+			if err := flags.Set(name, value); err != nil {
+				return nil, fmt.Errorf("%s: invalid value of %s: %v", cfg.ConfigFile, name, err)
+			}
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value := getenv(envName(f.Name))
+		if err != nil || explicit[f.Name] || f.Name == "config" || value == "" {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value of %s: %v", envName(f.Name), setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func (cfg *Config) Validate() error {
+	if _, ok := solvers[cfg.Solver]; !ok {
+		return fmt.Errorf("%v %q", ErrUnknownSolver, cfg.Solver)
+	}
+	if cfg.MaxHeaderBytes <= 0 || cfg.MaxSetupBodyBytes <= 0 || cfg.EventBufferSize <= 0 ||
+		cfg.MaxBatchSize <= 0 {
+		return ErrInvalidLimit
+	}
+	if cfg.AuditRetention < 0 {
+		return ErrRetention
+	}
+	if cfg.WebhookAttempts <= 0 || cfg.WebhookBackoff <= 0 || cfg.WebhookTimeout <= 0 {
+		return ErrWebhookRetry
+	}
+	if cfg.LogFormat != "logfmt" && cfg.LogFormat != "json" {
+		return ErrLogFormat
+	}
+	if cfg.TraceExporter != "none" && cfg.TraceExporter != "log" {
+		return ErrTraceExporter
+	}
+	return nil
+}
+
+func (cfg *Config) SolverFactory() lca.SolverFactory {
+	return solvers[cfg.Solver]
+}
+
+// Authenticator accepting configured API keys and JWTs, nil when authentication is disabled
+func (cfg *Config) Authenticator() (auth.Authenticator, error) {
+	var authenticators []auth.Authenticator
+	if cfg.ApiKeysFile != "" {
+		keys, err := auth.LoadApiKeys(cfg.ApiKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, keys)
+	}
+	if cfg.JwtSecret != "" {
+		authenticators = append(authenticators, auth.NewJwtAuthenticator([]byte(cfg.JwtSecret)))
+	}
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return auth.Chain(authenticators...), nil
+}
+
+// Visibility policy from the configured file, nil when all fields are public
+func (cfg *Config) VisibilityPolicy() (*policy.Policy, error) {
+	if cfg.VisibilityPolicyFile == "" {
+		return nil, nil
+	}
+	return policy.Load(cfg.VisibilityPolicyFile)
+}
+
+// Effective configuration in flag form, for logging on startup
+func (cfg *Config) String() string {
+	copied := *cfg
+	var options []string
+	copied.flagSet(ioutil.Discard).VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretOptions[f.Name] && value != "" {
+			value = "redacted"
+		}
+		options = append(options, fmt.Sprintf("%s=%q", f.Name, value))
+	})
+	return strings.Join(options, " ")
+}
+
+// Options from the file as strings, so they are parsed the same way as flags
+func readFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	default:
+		return nil, fmt.Errorf("%s: config file must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	options := make(map[string]string, len(raw))
+	for name, value := range raw {
+		options[name] = fmt.Sprint(value)
+	}
+	return options, nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+func solverNames() []string {
+	names := make([]string, 0, len(solvers))
+	for name := range solvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
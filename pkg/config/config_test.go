@@ -0,0 +1,104 @@
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func environment(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, environment(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if *cfg != *Default() {
+		t.Errorf("expected defaults, got %v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	env := environment(map[string]string{
+		"DIRECTORY_CONFIG":       "testdata/server.yaml",
+		"DIRECTORY_READ_TIMEOUT": "7s",
+		"DIRECTORY_HTTP_ADDR":    ":8081",
+	})
+	cfg, err := Load([]string{"-http-addr", ":8082"}, env, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.HttpAddr != ":8082" {
+		t.Errorf("flag should take precedence, got %s", cfg.HttpAddr)
+	}
+	if cfg.ReadTimeout != 7*time.Second {
+		t.Errorf("environment should take precedence over file, got %v", cfg.ReadTimeout)
+	}
+	if cfg.MaxSetupBodyBytes != 1<<20 || cfg.PersistenceDir != "/var/lib/directory" {
+		t.Errorf("file options were not applied: %v", cfg)
+	}
+	if cfg.WriteTimeout != 10*time.Second {
+		t.Errorf("default should be kept, got %v", cfg.WriteTimeout)
+	}
+}
+
+func TestLoadJson(t *testing.T) {
+	cfg, err := Load([]string{"-config", "testdata/server.json"}, environment(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.GrpcAddr != ":9191" || cfg.WriteTimeout != 30*time.Second || cfg.MaxHeaderBytes != 4096 {
+		t.Errorf("file options were not applied: %v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		env  map[string]string
+	}{
+		{[]string{"-solver", "naive"}, nil},
+		{[]string{"-max-setup-body-bytes", "0"}, nil},
+		{[]string{"-max-batch-size", "-1"}, nil},
+		{[]string{"-config", "testdata/unknown.yaml"}, nil},
+		{[]string{"-config", "testdata/missing.yaml"}, nil},
+		{nil, map[string]string{"DIRECTORY_READ_TIMEOUT": "10"}},
+		{[]string{"-unknown"}, nil},
+		{nil, map[string]string{"DIRECTORY_LOG_FORMAT": "text"}},
+		{[]string{"-trace-exporter", "jaeger"}, nil},
+		{[]string{"-webhook-attempts", "0"}, nil},
+	}
+	for _, test := range tests {
+		if _, err := Load(test.args, environment(test.env), ioutil.Discard); err == nil {
+			t.Errorf("expected error for %v %v", test.args, test.env)
+		}
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	cfg := Default()
+	if authenticator, err := cfg.Authenticator(); authenticator != nil || err != nil {
+		t.Errorf("authentication should be disabled by default, got %v %v", authenticator, err)
+	}
+
+	cfg, err := Load(nil, environment(map[string]string{"DIRECTORY_JWT_SECRET": "s3cr3t"}), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if authenticator, err := cfg.Authenticator(); authenticator == nil || err != nil {
+		t.Errorf("expected authenticator, got %v %v", authenticator, err)
+	}
+	if strings.Contains(cfg.String(), "s3cr3t") {
+		t.Errorf("secret was written out: %s", cfg)
+	}
+
+	cfg.ApiKeysFile = "testdata/missing.yaml"
+	if _, err := cfg.Authenticator(); err == nil {
+		t.Errorf("expected error for missing API keys file")
+	}
+}
@@ -0,0 +1,196 @@
+package events
+
+import (
+	"context"
+	"corporate-directory/pkg/service"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+//
+// Change events derived from the change set of each setup or mutation, so consumers learn what changed however it was
+// changed. Events are handed to sinks, e.g. webhook deliveries.
+//
+
+type Type string
+
+const (
+	EmployeeAdded   Type = "employee.added"
+	EmployeeUpdated Type = "employee.updated"
+	EmployeeMoved   Type = "employee.moved"
+	EmployeeRemoved Type = "employee.removed"
+	// Sent after every successful setup, following events of the employees it changed
+	DirectoryReplaced Type = "directory.replaced"
+)
+
+// All event types, in the order they are documented
+var Types = []Type{EmployeeAdded, EmployeeUpdated, EmployeeMoved, EmployeeRemoved, DirectoryReplaced}
+
+// Setups changing more employees than that only send directory.replaced, consumers are expected to read the whole
+// directory then instead of applying changes one by one
+const MaxSetupEvents = 1000
+
+type Event struct {
+	ID   string    `json:"id"`
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Employee after the change, or before it for removals
+	Employee *service.Employee `json:"employee,omitempty"`
+	// Manager before the change, only for moves
+	PreviousManagerID *int `json:"previous_manager_id,omitempty"`
+	// Counts of changes, only for directory.replaced
+	Summary *Summary `json:"summary,omitempty"`
+	// Version of the directory after the change
+	Version uint64 `json:"version"`
+	// IDs of managers above the employee before and after the change, so subtrees can be watched
+	Chain []int `json:"-"`
+}
+
+type Summary struct {
+	Employees int `json:"employees"`
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Changed   int `json:"changed"`
+}
+
+// Sink receives events of every change, in the order changes were made. Publish must not block, slow work such
+// as deliveries over the network has to be queued
+type Sink interface {
+	Publish(events []Event)
+}
+
+// Diff returns events of employees added, moved, updated or removed by the change, ordered by ID. A change of
+// manager is reported as a move even when other fields changed too
+func Diff(changes *service.ChangeSet) []Event {
+	now := time.Now().UTC()
+	var events []Event
+	for _, change := range changes.Changes() {
+		event := Event{ID: newId(), Time: now, Employee: change.After}
+		switch {
+		case change.Before == nil:
+			event.Type = EmployeeAdded
+			event.Chain = changes.ChainAfter(change.After.ID)
+		case change.After == nil:
+			event.Type = EmployeeRemoved
+			event.Employee = change.Before
+			event.Chain = changes.ChainBefore(change.Before.ID)
+		case change.Moved():
+			event.Type = EmployeeMoved
+			event.PreviousManagerID = change.Before.ManagerID
+			event.Chain = append(changes.ChainBefore(change.Before.ID), changes.ChainAfter(change.After.ID)...)
+		default:
+			event.Type = EmployeeUpdated
+			event.Chain = changes.ChainAfter(change.After.ID)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// InSubtree reports whether the event concerns the subtree of root, either before or after the change. Replacement of
+// the whole directory concerns every subtree
+func (e Event) InSubtree(root int) bool {
+	if e.Type == DirectoryReplaced {
+		return true
+	}
+	if e.Employee != nil && e.Employee.ID == root {
+		return true
+	}
+	for _, id := range e.Chain {
+		if id == root {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaced returns events of a setup, changes of single employees are left out when there are too many of them
+func Replaced(changes *service.ChangeSet) []Event {
+	summary := &Summary{}
+	_, summary.Employees = changes.Sizes()
+	summary.Added, summary.Removed, summary.Changed = changes.Counts()
+	var events []Event
+	if summary.Added+summary.Removed+summary.Changed <= MaxSetupEvents {
+		events = Diff(changes)
+	}
+	return append(events, Event{ID: newId(), Type: DirectoryReplaced, Time: time.Now().UTC(), Summary: summary})
+}
+
+// Random event ID, 32 hex characters
+func newId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type eventsMiddleware struct {
+	service.CorporateDirectory
+	sinks []Sink
+	// Changes are made one at a time anyway, holding it publishes their events in the same order
+	mutex sync.Mutex
+}
+
+// Middleware publishes events of every successful setup and mutation to sinks. Events are derived from the change set
+// of the service, so it must wrap the service returning employees with all fields
+func Middleware(sinks ...Sink) service.Middleware {
+	return func(next service.CorporateDirectory) service.CorporateDirectory {
+		return &eventsMiddleware{CorporateDirectory: next, sinks: sinks}
+	}
+}
+
+// Run change and publish events derived from its change set
+func (mw *eventsMiddleware) change(ctx context.Context, derive func(*service.ChangeSet) []Event,
+	change func(ctx context.Context) error) error {
+	mw.mutex.Lock()
+	defer mw.mutex.Unlock()
+	ctx, changes := service.NewChangeSetContext(ctx)
+	if err := change(ctx); err != nil {
+		return err
+	}
+	if !changes.Done() {
+		return nil
+	}
+	if events := derive(changes); len(events) > 0 {
+		version := changes.Version()
+		for idx := range events {
+			events[idx].Version = version
+		}
+		for _, sink := range mw.sinks {
+			sink.Publish(events)
+		}
+	}
+	return nil
+}
+
+func (mw *eventsMiddleware) Setup(ctx context.Context, employees []*service.Employee) error {
+	return mw.change(ctx, Replaced, func(ctx context.Context) error {
+		return mw.CorporateDirectory.Setup(ctx, employees)
+	})
+}
+
+func (mw *eventsMiddleware) AddEmployee(ctx context.Context, employee *service.Employee) (*service.Employee, error) {
+	var res *service.Employee
+	err := mw.change(ctx, Diff, func(ctx context.Context) (err error) {
+		res, err = mw.CorporateDirectory.AddEmployee(ctx, employee)
+		return err
+	})
+	return res, err
+}
+
+func (mw *eventsMiddleware) UpdateEmployee(ctx context.Context, employee *service.Employee) (*service.Employee,
+	error) {
+	var res *service.Employee
+	err := mw.change(ctx, Diff, func(ctx context.Context) (err error) {
+		res, err = mw.CorporateDirectory.UpdateEmployee(ctx, employee)
+		return err
+	})
+	return res, err
+}
+
+func (mw *eventsMiddleware) RemoveEmployee(ctx context.Context, id int) error {
+	return mw.change(ctx, Diff, func(ctx context.Context) error {
+		return mw.CorporateDirectory.RemoveEmployee(ctx, id)
+	})
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"context"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"testing"
+)
+
+type recordingSink struct {
+	events []Event
+}
+
+func (s *recordingSink) Publish(events []Event) {
+	s.events = append(s.events, events...)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func types(events []Event) []Type {
+	res := make([]Type, len(events))
+	for idx, event := range events {
+		res[idx] = event.Type
+	}
+	return res
+}
+
+func equalTypes(a, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// Change set of setting up after over before
+func changeSet(t *testing.T, before, after []*service.Employee) *service.ChangeSet {
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if before != nil {
+		if err := svc.Setup(context.Background(), before); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	ctx, changes := service.NewChangeSetContext(context.Background())
+	if err := svc.Setup(ctx, after); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return changes
+}
+
+func TestDiff(t *testing.T) {
+	before := []*service.Employee{
+		{ID: 1, Name: "Claire", Subordinates: []int{2, 3}},
+		{ID: 2, Name: "Bob", ManagerID: intPtr(1), Subordinates: []int{4}},
+		{ID: 3, Name: "Alice", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Dave", ManagerID: intPtr(2)},
+	}
+	after := []*service.Employee{
+		{ID: 1, Name: "Claire", Subordinates: []int{3}},
+		{ID: 3, Name: "Alice", ManagerID: intPtr(1), Title: "CTO", Subordinates: []int{4, 5}},
+		{ID: 4, Name: "Dave", ManagerID: intPtr(3)},
+		{ID: 5, Name: "Eve", ManagerID: intPtr(3)},
+	}
+	events := Diff(changeSet(t, before, after))
+	expected := []Type{EmployeeRemoved, EmployeeUpdated, EmployeeMoved, EmployeeAdded}
+	if !equalTypes(types(events), expected) {
+		t.Fatalf("expected %v, got %v", expected, types(events))
+	}
+	if events[0].Employee.ID != 2 || events[2].Employee.ID != 4 || *events[2].PreviousManagerID != 2 {
+		t.Errorf("unexpected events %+v", events)
+	}
+	if events[0].ID == "" || events[0].ID == events[1].ID {
+		t.Errorf("events need unique IDs")
+	}
+	// Dave moved from Bob's subtree to Alice's, Bob left Claire's
+	for _, test := range []struct {
+		event    int
+		root     int
+		expected bool
+	}{
+		{2, 2, true},
+		{2, 3, true},
+		{2, 1, true},
+		{2, 5, false},
+		{0, 1, true},
+		{0, 3, false},
+		{3, 5, true},
+	} {
+		if actual := events[test.event].InSubtree(test.root); actual != test.expected {
+			t.Errorf("%s of %d in subtree of %d: expected %v", events[test.event].Type,
+				events[test.event].Employee.ID, test.root, test.expected)
+		}
+	}
+}
+
+func TestReplaced(t *testing.T) {
+	after := []*service.Employee{{ID: 1, Name: "Claire"}}
+	for id := 2; id <= MaxSetupEvents+1; id++ {
+		after = append(after, &service.Employee{ID: id, ManagerID: intPtr(1)})
+	}
+	events := Replaced(changeSet(t, nil, after))
+	if len(events) != 1 || events[0].Type != DirectoryReplaced {
+		t.Fatalf("expected only directory.replaced, got %d events", len(events))
+	}
+	if summary := events[0].Summary; summary.Employees != MaxSetupEvents+1 || summary.Added != MaxSetupEvents+1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	events = Replaced(changeSet(t, after[:1], after[:2]))
+	if !equalTypes(types(events), []Type{EmployeeAdded, DirectoryReplaced}) {
+		t.Errorf("unexpected events %v", types(events))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := &recordingSink{}
+	svc := Middleware(sink)(service.NewCorporateDirectoryService(lca.NewOnlineLCASolver))
+	ctx := context.Background()
+	employees := []*service.Employee{{ID: 1, Name: "Claire"}, {ID: 2, Name: "Bob", ManagerID: intPtr(1)}}
+	if err := svc.Setup(ctx, employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if _, err := svc.AddEmployee(ctx, &service.Employee{ID: 3, Name: "Alice", ManagerID: intPtr(2)}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := svc.RemoveEmployee(ctx, 2); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	// Failed changes publish nothing
+	_ = svc.RemoveEmployee(ctx, 42)
+	_ = svc.Setup(ctx, []*service.Employee{{ID: 1, Name: "Bob"}})
+
+	// Removing Bob moves Alice up to Claire
+	expected := []Type{EmployeeAdded, EmployeeAdded, DirectoryReplaced, EmployeeAdded, EmployeeRemoved, EmployeeMoved}
+	if !equalTypes(types(sink.events), expected) {
+		t.Fatalf("expected %v, got %v", expected, types(sink.events))
+	}
+	if moved := sink.events[5]; moved.Employee.ID != 3 || *moved.Employee.ManagerID != 1 || moved.Version != 3 {
+		t.Errorf("unexpected move %+v of version %d", moved.Employee, moved.Version)
+	}
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"sync"
+)
+
+// Events buffered for a single subscriber before it is considered too slow and dropped
+const subscriberBuffer = 256
+
+// Stream fans events out to live subscribers and keeps the most recent ones in a ring buffer, so subscribers coming
+// back after a disconnect can catch up on what they missed
+type Stream struct {
+	mutex sync.Mutex
+	// Ring buffer of recent events, next is where the following one goes
+	buffer []Event
+	next   int
+	full   bool
+
+	subscribers map[*Subscription]bool
+	closed      bool
+}
+
+type Subscription struct {
+	// Events published after the one the subscriber resumed from, to be sent before live ones
+	Missed []Event
+	// Live events, closed when the subscriber falls behind or the stream is closed
+	Events <-chan Event
+
+	events chan Event
+	stream *Stream
+}
+
+// NewStream keeps the last size events for resuming subscribers
+func NewStream(size int) *Stream {
+	return &Stream{
+		buffer:      make([]Event, size),
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+func (s *Stream) Publish(events []Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, event := range events {
+		if len(s.buffer) > 0 {
+			s.buffer[s.next] = event
+			s.next = (s.next + 1) % len(s.buffer)
+			s.full = s.full || s.next == 0
+		}
+		for sub := range s.subscribers {
+			select {
+			case sub.events <- event:
+			default:
+				// The subscriber resumes from the buffer once it reconnects
+				s.drop(sub)
+			}
+		}
+	}
+}
+
+// Subscribe to events published from now on. When lastId is given, events published after it are returned as missed
+// first. Resumed is false when lastId is not in the buffer anymore, the subscriber should then reload the directory
+func (s *Stream) Subscribe(lastId string) (sub *Subscription, resumed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	events := make(chan Event, subscriberBuffer)
+	sub = &Subscription{Events: events, events: events, stream: s}
+	if s.closed {
+		close(events)
+		return sub, false
+	}
+	s.subscribers[sub] = true
+	if lastId == "" {
+		return sub, true
+	}
+	buffered := s.buffered()
+	for idx, event := range buffered {
+		if event.ID == lastId {
+			sub.Missed = append([]Event{}, buffered[idx+1:]...)
+			return sub, true
+		}
+	}
+	return sub, false
+}
+
+// Close stops delivery to the subscriber
+func (sub *Subscription) Close() {
+	sub.stream.mutex.Lock()
+	defer sub.stream.mutex.Unlock()
+	if sub.stream.subscribers[sub] {
+		sub.stream.drop(sub)
+	}
+}
+
+// Close ends all subscriptions, e.g. on shutdown, so streaming responses finish
+func (s *Stream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sub := range s.subscribers {
+		s.drop(sub)
+	}
+	s.closed = true
+}
+
+// Must be called with mutex held
+func (s *Stream) drop(sub *Subscription) {
+	delete(s.subscribers, sub)
+	close(sub.events)
+}
+
+// Buffered events, oldest first. Must be called with mutex held
+func (s *Stream) buffered() []Event {
+	if !s.full {
+		return s.buffer[:s.next]
+	}
+	return append(append([]Event{}, s.buffer[s.next:]...), s.buffer[:s.next]...)
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"strconv"
+	"testing"
+)
+
+func numbered(from, to int) []Event {
+	var res []Event
+	for i := from; i <= to; i++ {
+		res = append(res, Event{ID: strconv.Itoa(i), Type: EmployeeUpdated})
+	}
+	return res
+}
+
+func ids(events []Event) string {
+	res := ""
+	for _, event := range events {
+		res += event.ID + " "
+	}
+	return res
+}
+
+func TestStreamResume(t *testing.T) {
+	stream := NewStream(3)
+	stream.Publish(numbered(1, 5))
+
+	for _, test := range []struct {
+		lastId   string
+		resumed  bool
+		expected string
+	}{
+		{"", true, ""},
+		{"3", true, "4 5 "},
+		{"5", true, ""},
+		// Dropped out of the buffer already
+		{"2", false, ""},
+		{"unknown", false, ""},
+	} {
+		sub, resumed := stream.Subscribe(test.lastId)
+		if resumed != test.resumed || ids(sub.Missed) != test.expected {
+			t.Errorf("%q: expected %v %q, got %v %q", test.lastId, test.resumed, test.expected, resumed,
+				ids(sub.Missed))
+		}
+		sub.Close()
+	}
+}
+
+func TestStreamSubscribers(t *testing.T) {
+	stream := NewStream(10)
+	slow, _ := stream.Subscribe("")
+	live, _ := stream.Subscribe("")
+	stream.Publish(numbered(1, 2))
+	if event := <-live.Events; event.ID != "1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event := <-live.Events; event.ID != "2" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	live.Close()
+
+	// Subscribers falling behind are dropped, they resume from the buffer on reconnect
+	stream.Publish(numbered(3, 2+subscriberBuffer))
+	count := 0
+	for range slow.Events {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("expected %d events before the subscriber was dropped, got %d", subscriberBuffer, count)
+	}
+
+	sub, _ := stream.Subscribe("")
+	stream.Close()
+	if _, ok := <-sub.Events; ok {
+		t.Errorf("subscription should end with the stream")
+	}
+	sub.Close()
+}
@@ -0,0 +1,58 @@
+package lca
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"time"
+)
+
+type instrumentingSolver struct {
+	LCASolver
+	preprocessing metrics.Histogram
+	nodes         metrics.Gauge
+	depth         metrics.Gauge
+}
+
+// InstrumentingSolverFactory wraps solvers made by next, observing preprocessing time in seconds. Size and depth of
+// the tree are reported for every successful setup, so gauges describe the tree currently in use
+func InstrumentingSolverFactory(next SolverFactory, preprocessing metrics.Histogram,
+	nodes, depth metrics.Gauge) SolverFactory {
+	return func() LCASolver {
+		return &instrumentingSolver{
+			LCASolver:     next(),
+			preprocessing: preprocessing,
+			nodes:         nodes,
+			depth:         depth,
+		}
+	}
+}
+
+func (solver *instrumentingSolver) Setup(nodes [][]int) error {
+	begin := time.Now()
+	if err := solver.LCASolver.Setup(nodes); err != nil {
+		return err
+	}
+	solver.preprocessing.Observe(time.Since(begin).Seconds())
+	solver.nodes.Set(float64(len(nodes)))
+	solver.depth.Set(float64(treeDepth(nodes)))
+	return nil
+}
+
+// Number of edges on the longest path from the root, tree is already known to be valid
+func treeDepth(nodes [][]int) int {
+	if len(nodes) == 0 {
+		return 0
+	}
+	depth := 0
+	level := []int{0}
+	for {
+		var next []int
+		for _, node := range level {
+			next = append(next, nodes[node]...)
+		}
+		if len(next) == 0 {
+			return depth
+		}
+		depth++
+		level = next
+	}
+}
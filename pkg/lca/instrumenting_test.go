@@ -0,0 +1,39 @@
+package lca
+
+import (
+	"github.com/go-kit/kit/metrics/generic"
+	"testing"
+)
+
+func TestInstrumentingSolverFactory(t *testing.T) {
+	preprocessing := generic.NewHistogram("preprocessing", 10)
+	nodes := generic.NewGauge("nodes")
+	depth := generic.NewGauge("depth")
+	newSolver := InstrumentingSolverFactory(NewOnlineLCASolver, preprocessing, nodes, depth)
+
+	solver := newSolver()
+	err := solver.Setup([][]int{
+		{1, 2},
+		{3},
+		{},
+		{4},
+		{},
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if nodes.Value() != 5 || depth.Value() != 3 {
+		t.Errorf("expected 5 nodes with depth 3, got %v and %v", nodes.Value(), depth.Value())
+	}
+	if lca, _ := solver.SolveLCA(4, 2); lca != 0 {
+		t.Errorf("instrumented solver returned wrong LCA %d", lca)
+	}
+
+	// Invalid trees leave gauges of the previous one
+	if err := newSolver().Setup([][]int{{1}, {}, {3}, {}}); err != ErrInvalidTree {
+		t.Errorf("disjoint graph not detected")
+	}
+	if nodes.Value() != 5 || depth.Value() != 3 {
+		t.Errorf("gauges changed after failed setup: %v and %v", nodes.Value(), depth.Value())
+	}
+}
@@ -16,6 +16,9 @@ type LCASolver interface {
 	SolveLCA(first, second int) (int, error)
 }
 
+// Constructor of solvers, so that users can prepare a new solver while another one is still in use
+type SolverFactory func() LCASolver
+
 // Solver implementation. Implementation includes preprocessing, in which we build orderVisited array during
 // a DFS down the tree. Node is added to the array once algorithm reaches it for the first time and each time
 // algorithm returns to the node from it's children. Also we build firstVisit array in which we keep first occurence
@@ -37,6 +40,10 @@ type OnlineLCASolver struct {
 	blockLen int
 }
 
+func NewOnlineLCASolver() LCASolver {
+	return &OnlineLCASolver{}
+}
+
 // Setup solver with nodes, may be called multiple times on the same structure
 func (solver *OnlineLCASolver) Setup(nodes [][]int) error {
 	if len(nodes) == 0 {
@@ -123,7 +130,7 @@ func (solver *OnlineLCASolver) prepareRmq() {
 	// simply iterate over all vertices and update RMQ for corresponding block
 	solver.sqrts = make([]util.ArgMinResult, 1+len(solver.orderVisited)/solver.blockLen)
 	for i, vertex := range solver.orderVisited {
-		argmin := util.ArgMinResult{vertex, solver.heights[vertex]}
+		argmin := util.ArgMinResult{Pos: vertex, Value: solver.heights[vertex]}
 		solver.sqrts[i/solver.blockLen] = util.ArgMin(solver.sqrts[i/solver.blockLen], argmin)
 	}
 }
@@ -131,7 +138,7 @@ func (solver *OnlineLCASolver) prepareRmq() {
 // Prepare a response for an online request. Iterating from left to right and take aggregated result from entire block
 // in case our request covers an entire block
 func (solver *OnlineLCASolver) solve(left, right int) int {
-	min := util.ArgMinResult{-1, int(math.MaxInt32)}
+	min := util.ArgMinResult{Pos: -1, Value: int(math.MaxInt32)}
 	// get first visits of vertices and swap them if necessary
 	left = solver.firstVisit[left]
 	right = solver.firstVisit[right]
@@ -146,7 +153,7 @@ func (solver *OnlineLCASolver) solve(left, right int) int {
 			i += solver.blockLen
 		} else { // Update one by one otherwise
 			vertex := solver.orderVisited[i]
-			argmin := util.ArgMinResult{vertex, solver.heights[vertex]}
+			argmin := util.ArgMinResult{Pos: vertex, Value: solver.heights[vertex]}
 			min = util.ArgMin(min, argmin)
 			i++
 		}
@@ -0,0 +1,414 @@
+package ldif
+
+import (
+	"bufio"
+	"context"
+	"corporate-directory/pkg/service"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMalformedLine      = errors.New(`ldif line is not an attribute-value pair`)
+	ErrMissingDn          = errors.New(`ldif entry has no dn`)
+	ErrDuplicateDn        = errors.New(`multiple ldif entries with same dn`)
+	ErrUnsupportedChange  = errors.New(`only content records and changetype add are supported`)
+	ErrInvalidEmployeeNum = errors.New(`employeeNumber must be an integer`)
+	ErrUnknownManager     = errors.New(`manager dn does not match any entry`)
+	ErrMalformedDn        = errors.New(`dn must start with an attribute-value pair`)
+)
+
+// Line length used for folding on export, as recommended by RFC 2849
+const foldWidth = 76
+
+// Single LDIF record. Attribute names are lowercased as LDAP treats them case insensitively
+type entry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func (e *entry) first(name string) string {
+	if values := e.attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Read parses LDIF content and maps each entry to an employee. dn, cn, sn, mail and title are taken as is, manager is
+// resolved from the manager's dn into ManagerID. Employee IDs are taken from employeeNumber, entries without it get
+// IDs above the largest one present in the file, in order of appearance.
+func Read(r io.Reader) ([]*service.Employee, error) {
+	entries, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve explicit IDs first so generated ones don't collide with them
+	employees := make([]*service.Employee, len(entries))
+	dnToIndex := make(map[string]int, len(entries))
+	maxId := 0
+	for idx, e := range entries {
+		key := normalizeDn(e.dn)
+		if _, ok := dnToIndex[key]; ok {
+			return nil, ErrDuplicateDn
+		}
+		dnToIndex[key] = idx
+
+		employees[idx] = &service.Employee{
+			DN:      e.dn,
+			Name:    e.first("cn"),
+			Mail:    e.first("mail"),
+			Title:   e.first("title"),
+			Surname: e.first("sn"),
+		}
+		if num := e.first("employeenumber"); num != "" {
+			id, err := strconv.Atoi(num)
+			if err != nil {
+				return nil, ErrInvalidEmployeeNum
+			}
+			employees[idx].ID = id
+			if id > maxId {
+				maxId = id
+			}
+		}
+	}
+	for idx, e := range entries {
+		if e.first("employeenumber") == "" {
+			maxId++
+			employees[idx].ID = maxId
+		}
+	}
+
+	// Now when all IDs are known link employees to their managers
+	for idx, e := range entries {
+		manager := e.first("manager")
+		if manager == "" {
+			continue
+		}
+		managerIdx, ok := dnToIndex[normalizeDn(manager)]
+		if !ok {
+			return nil, ErrUnknownManager
+		}
+		managerId := employees[managerIdx].ID
+		employees[idx].ManagerID = &managerId
+	}
+	return employees, nil
+}
+
+// Import reads LDIF and replaces the directory contents with it, so the tree goes through the usual Setup validation
+func Import(ctx context.Context, r io.Reader, dir service.CorporateDirectory) error {
+	employees, err := Read(r)
+	if err != nil {
+		return err
+	}
+	return dir.Setup(ctx, employees)
+}
+
+// Write exports employees as inetOrgPerson entries that can be loaded with ldapadd. Employees without a dn are placed
+// under baseDN as uid=<ID>, which must already exist in the target directory. Attributes of the RDN are written as
+// well, as LDAP requires entries to contain their naming attributes.
+func Write(w io.Writer, employees []*service.Employee, baseDN string) error {
+	dns := make(map[int]string, len(employees))
+	for _, employee := range employees {
+		dns[employee.ID] = employeeDn(employee, baseDN)
+	}
+
+	// Managers may be known either from ManagerID or from subordinates lists
+	managers := make(map[int]int, len(employees))
+	for _, employee := range employees {
+		for _, child := range employee.Subordinates {
+			managers[child] = employee.ID
+		}
+	}
+	for _, employee := range employees {
+		if employee.ManagerID != nil {
+			managers[employee.ID] = *employee.ManagerID
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	writeLine(bw, "version", "1")
+	for _, employee := range employees {
+		bw.WriteString("\n")
+		writeLine(bw, "dn", dns[employee.ID])
+		for _, class := range []string{"top", "person", "organizationalPerson", "inetOrgPerson"} {
+			writeLine(bw, "objectClass", class)
+		}
+		rdn, err := parseRdn(dns[employee.ID])
+		if err != nil {
+			return err
+		}
+		attributes := employeeAttributes(employee, rdn)
+		for _, attribute := range rdn {
+			if !containsAttribute(attributes, attribute) {
+				writeLine(bw, attribute.name, attribute.value)
+			}
+		}
+		for _, attribute := range attributes {
+			writeLine(bw, attribute.name, attribute.value)
+		}
+		if managerId, ok := managers[employee.ID]; ok {
+			managerDn, ok := dns[managerId]
+			if !ok {
+				return service.ErrInvalidEdge
+			}
+			writeLine(bw, "manager", managerDn)
+		}
+	}
+	return bw.Flush()
+}
+
+// Split input into records, unfolding continuation lines and decoding base64 values
+func parse(r io.Reader) ([]*entry, error) {
+	var entries []*entry
+	var lines []string
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		e := &entry{attributes: make(map[string][]string)}
+		for _, line := range lines {
+			name, value, err := splitLine(line)
+			if err != nil {
+				return err
+			}
+			switch name {
+			case "dn":
+				e.dn = value
+			case "changetype":
+				if strings.ToLower(value) != "add" {
+					return ErrUnsupportedChange
+				}
+			default:
+				e.attributes[name] = append(e.attributes[name], value)
+			}
+		}
+		lines = lines[:0]
+
+		// Version line forms a record of its own at the beginning of the file
+		if e.dn == "" && len(e.attributes) == 1 && e.first("version") != "" && len(entries) == 0 {
+			return nil
+		}
+		if e.dn == "" {
+			return ErrMissingDn
+		}
+		entries = append(entries, e)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	comment := false
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, " "):
+			// Continuation of the previous line, comments may be folded as well
+			if comment {
+				continue
+			}
+			if len(lines) == 0 {
+				return nil, ErrMalformedLine
+			}
+			lines[len(lines)-1] += line[1:]
+		case strings.HasPrefix(line, "#"):
+			comment = true
+		case line == "":
+			comment = false
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		default:
+			comment = false
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Parse "name: value" or "name:: base64value" line
+func splitLine(line string) (string, string, error) {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return "", "", ErrMalformedLine
+	}
+	name := strings.ToLower(line[:colon])
+	// Attribute options such as ;lang-en are not interesting for us
+	if semicolon := strings.IndexByte(name, ';'); semicolon >= 0 {
+		name = name[:semicolon]
+	}
+	value := line[colon+1:]
+
+	switch {
+	case strings.HasPrefix(value, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", ErrMalformedLine
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(value, "<"):
+		// URL values would require fetching external content
+		return "", "", ErrMalformedLine
+	default:
+		return name, strings.TrimLeft(value, " "), nil
+	}
+}
+
+// Write "name: value" line, switching to base64 for unsafe values and folding long lines
+func writeLine(w *bufio.Writer, name, value string) {
+	var line string
+	if isSafe(value) {
+		line = name + ": " + value
+	} else {
+		line = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	for len(line) > foldWidth {
+		w.WriteString(line[:foldWidth])
+		w.WriteString("\n ")
+		line = line[foldWidth:]
+	}
+	w.WriteString(line)
+	w.WriteString("\n")
+}
+
+// SAFE-STRING from RFC 2849: ASCII without NUL, CR and LF, not starting with space, colon or less-than sign
+// and not ending with a space
+func isSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+	if value[0] == ' ' || value[0] == ':' || value[0] == '<' || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// DNs are compared case insensitively and ignoring spaces around separators
+func normalizeDn(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		pair := strings.SplitN(part, "=", 2)
+		for j := range pair {
+			pair[j] = strings.TrimSpace(pair[j])
+		}
+		parts[i] = strings.ToLower(strings.Join(pair, "="))
+	}
+	return strings.Join(parts, ",")
+}
+
+func employeeDn(employee *service.Employee, baseDN string) string {
+	if employee.DN != "" {
+		return employee.DN
+	}
+	return fmt.Sprintf("uid=%d,%s", employee.ID, baseDN)
+}
+
+type attribute struct {
+	name  string
+	value string
+}
+
+// Attributes of the exported entry in the order they are written, except for the RDN ones. cn and sn are mandatory
+// for person object class, an employee without name is named after the RDN instead
+func employeeAttributes(employee *service.Employee, rdn []attribute) []attribute {
+	cn := employee.Name
+	if cn == "" {
+		cn = rdn[0].value
+	}
+	sn := employee.Surname
+	if sn == "" {
+		sn = surname(cn)
+	}
+	attributes := []attribute{
+		{"cn", cn},
+		{"sn", sn},
+		{"employeeNumber", strconv.Itoa(employee.ID)},
+	}
+	if employee.Mail != "" {
+		attributes = append(attributes, attribute{"mail", employee.Mail})
+	}
+	if employee.Title != "" {
+		attributes = append(attributes, attribute{"title", employee.Title})
+	}
+	return attributes
+}
+
+// Attribute names are case insensitive, values are compared as is
+func containsAttribute(attributes []attribute, a attribute) bool {
+	for _, other := range attributes {
+		if strings.EqualFold(other.name, a.name) && other.value == a.value {
+			return true
+		}
+	}
+	return false
+}
+
+// Attributes of the first RDN of dn, e.g. uid=claire or multivalued cn=Claire+employeeNumber=1. Escaped
+// characters in values are unescaped
+func parseRdn(dn string) ([]attribute, error) {
+	var rdn []attribute
+	var name string
+	var value []byte
+	inValue := false
+	for i := 0; i <= len(dn); i++ {
+		if i == len(dn) || (inValue && (dn[i] == ',' || dn[i] == '+')) {
+			if !inValue || name == "" {
+				return nil, ErrMalformedDn
+			}
+			rdn = append(rdn, attribute{name, strings.TrimSpace(string(value))})
+			if i == len(dn) || dn[i] == ',' {
+				return rdn, nil
+			}
+			name, value, inValue = "", nil, false
+			continue
+		}
+		c := dn[i]
+		switch {
+		case !inValue && c == '=':
+			name = strings.TrimSpace(name)
+			inValue = true
+		case !inValue:
+			name += string(c)
+		case c == '\\' && i+2 < len(dn) && isHex(dn[i+1]) && isHex(dn[i+2]):
+			decoded, _ := strconv.ParseUint(dn[i+1:i+3], 16, 8)
+			value = append(value, byte(decoded))
+			i += 2
+		case c == '\\' && i+1 < len(dn):
+			value = append(value, dn[i+1])
+			i++
+		default:
+			value = append(value, c)
+		}
+	}
+	return nil, ErrMalformedDn
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// Fallback for entries without imported sn, the last word of the name
+func surname(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return name
+	}
+	return fields[len(fields)-1]
+}
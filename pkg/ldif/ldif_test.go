@@ -0,0 +1,168 @@
+package ldif
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("failed to open fixture %s: %v", name, err)
+	}
+	return f
+}
+
+func TestReadFixture(t *testing.T) {
+	f := openFixture(t, "org.ldif")
+	defer f.Close()
+
+	employees, err := Read(f)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(employees) != 5 {
+		t.Fatalf("expected 5 employees, got %d", len(employees))
+	}
+
+	carol := employees[3]
+	if carol.ID != 4 || carol.Name != "Carol" || *carol.ManagerID != 2 {
+		t.Errorf("unexpected employee %+v", carol)
+	}
+	if carol.Title != "Senior Software Engineer working on the corporate directory and related services" {
+		t.Errorf("folded line was not joined: %q", carol.Title)
+	}
+
+	bob := employees[2]
+	if bob.ManagerID == nil || *bob.ManagerID != 1 {
+		t.Errorf("manager dn was not normalized: %+v", bob)
+	}
+
+	dave := employees[4]
+	if dave.ID != 5 || dave.Name != "Déve" || dave.Surname != "Dave" || dave.Mail != "dave@bureaucr.at" ||
+		dave.Custom != nil {
+		t.Errorf("unexpected employee %+v", dave)
+	}
+}
+
+func TestImportFixture(t *testing.T) {
+	f := openFixture(t, "org.ldif")
+	defer f.Close()
+
+	dir := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := Import(context.Background(), f, dir); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	common, err := dir.GetCommonManager(context.Background(), 4, 5)
+	if err != nil || common.ID != 2 {
+		t.Errorf("unexpected common manager %+v, error=%v", common, err)
+	}
+	common, err = dir.GetCommonManager(context.Background(), 4, 3)
+	if err != nil || common.ID != 1 {
+		t.Errorf("unexpected common manager %+v, error=%v", common, err)
+	}
+}
+
+func TestImportUnknownManager(t *testing.T) {
+	f := openFixture(t, "unknown_manager.ldif")
+	defer f.Close()
+
+	dir := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := Import(context.Background(), f, dir); err != ErrUnknownManager {
+		t.Errorf("unknown manager not detected, error=%v", err)
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	f := openFixture(t, "cycle.ldif")
+	defer f.Close()
+
+	dir := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := Import(context.Background(), f, dir); err != lca.ErrInvalidTree {
+		t.Errorf("cycle not detected, error=%v", err)
+	}
+}
+
+func TestWriteFixture(t *testing.T) {
+	f := openFixture(t, "org.ldif")
+	defer f.Close()
+
+	dir := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := Import(context.Background(), f, dir); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	employees, _ := dir.GetEmployees(context.Background())
+
+	buf := &bytes.Buffer{}
+	if err := Write(buf, employees, "ou=people,dc=bureaucr,dc=at"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	expected, err := ioutil.ReadFile("testdata/export.ldif")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("unexpected export:\n%s", buf.String())
+	}
+
+	// Exported file must be readable back with the same hierarchy
+	exported, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("read of exported ldif failed: %v", err)
+	}
+	for i, employee := range exported {
+		if employee.ID != employees[i].ID || employee.Name != employees[i].Name ||
+			(employee.ManagerID == nil) != (employees[i].ManagerID == nil) ||
+			(employee.ManagerID != nil && *employee.ManagerID != *employees[i].ManagerID) {
+			t.Errorf("round trip mismatch: %+v != %+v", employee, employees[i])
+		}
+	}
+}
+
+func readFixture(t *testing.T, name string) []*service.Employee {
+	f := openFixture(t, name)
+	defer f.Close()
+	employees, err := Read(f)
+	if err != nil {
+		t.Fatalf("read of %s failed: %v", name, err)
+	}
+	return employees
+}
+
+func TestWriteNamingAttributes(t *testing.T) {
+	employees := readFixture(t, "naming.ldif")
+	// Employees set up by other means than LDIF have no dn
+	employees[2].DN = ""
+
+	buf := &bytes.Buffer{}
+	if err := Write(buf, employees, "ou=people,dc=bureaucr,dc=at"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	entries, err := parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	expected := []map[string][]string{
+		{"cn": {"Claire"}, "sn": {"Claire"}, "employeenumber": {"1"}},
+		{"cn": {"Smith, Alice"}, "sn": {"Alice"}, "employeenumber": {"2"}},
+		{"uid": {"3"}, "cn": {"3"}, "sn": {"3"}, "employeenumber": {"3"}},
+	}
+	for i, e := range entries {
+		for name, values := range expected[i] {
+			if got := e.attributes[name]; len(got) != len(values) || got[0] != values[0] {
+				t.Errorf("entry %s: expected %s %v, got %v", e.dn, name, values, got)
+			}
+		}
+	}
+
+	if err := Write(buf, readFixture(t, "malformed_dn.ldif"), ""); err != ErrMalformedDn {
+		t.Errorf("expected ErrMalformedDn, got %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+// Package pb contains protobuf messages and gRPC service definitions of the corporate directory
+package pb
+
+//go:generate protoc --go_out=plugins=grpc:. directory.proto
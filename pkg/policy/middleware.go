@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/service"
+)
+
+type visibilityMiddleware struct {
+	service.CorporateDirectory
+	policy *Policy
+}
+
+// Middleware redacts fields the caller from the context may not see in returned employees. Whether the caller
+// manages an employee is answered by the directory itself, the caller is up the chain exactly when he/she is their
+// closest common manager. Callers not linked to an employee, including anonymous ones, only see public fields
+func Middleware(policy *Policy) service.Middleware {
+	return func(next service.CorporateDirectory) service.CorporateDirectory {
+		return &visibilityMiddleware{CorporateDirectory: next, policy: policy}
+	}
+}
+
+func (mw *visibilityMiddleware) GetCommonManager(ctx context.Context, first, second int) (*service.Employee, error) {
+	employee, err := mw.CorporateDirectory.GetCommonManager(ctx, first, second)
+	if err != nil {
+		return nil, err
+	}
+	mw.policy.Redact(ctx, mw.CorporateDirectory, employee)
+	return employee, nil
+}
+
+func (mw *visibilityMiddleware) GetCommonManagers(ctx context.Context, pairs []service.EmployeePair) (
+	[]service.CommonManagerResult, error) {
+	res, err := mw.CorporateDirectory.GetCommonManagers(ctx, pairs)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range res {
+		if result.Manager != nil {
+			mw.policy.Redact(ctx, mw.CorporateDirectory, result.Manager)
+		}
+	}
+	return res, nil
+}
+
+func (mw *visibilityMiddleware) GetEmployee(ctx context.Context, id int) (*service.Employee, error) {
+	employee, err := mw.CorporateDirectory.GetEmployee(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	mw.policy.Redact(ctx, mw.CorporateDirectory, employee)
+	return employee, nil
+}
+
+func (mw *visibilityMiddleware) GetEmployees(ctx context.Context) ([]*service.Employee, error) {
+	employees, err := mw.CorporateDirectory.GetEmployees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, employee := range employees {
+		mw.policy.Redact(ctx, mw.CorporateDirectory, employee)
+	}
+	return employees, nil
+}
+
+// Only employees of the page are redacted. Custom attributes the caller can't see don't match filters either, so pages
+// filtered by them may come out short
+func (mw *visibilityMiddleware) ListEmployees(ctx context.Context, query service.EmployeeQuery) (
+	*service.EmployeePage, error) {
+	page, err := mw.CorporateDirectory.ListEmployees(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	visible := page.Employees[:0]
+	for _, employee := range page.Employees {
+		mw.policy.Redact(ctx, mw.CorporateDirectory, employee)
+		if matchesCustom(employee, query.Custom) {
+			visible = append(visible, employee)
+		}
+	}
+	page.Employees = visible
+	return page, nil
+}
+
+func matchesCustom(employee *service.Employee, custom map[string]string) bool {
+	for key, value := range custom {
+		if employee.Custom[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Redact clears fields of the employee not visible to the caller from the context, e.g. of employees the service
+// doesn't return itself. Relation to the employee is only resolved when needed, asking dir for common managers
+func (p *Policy) Redact(ctx context.Context, dir service.CorporateDirectory, employee *service.Employee) {
+	identity, ok := auth.FromContext(ctx)
+	if ok && identity.Role.Includes(auth.RoleAdmin) {
+		return
+	}
+	var resolved *relation
+	visible := func(field string) bool {
+		if _, restricted := p.rule(field); !restricted {
+			return true
+		}
+		if resolved == nil {
+			r := relationTo(ctx, dir, identity.EmployeeID, employee)
+			resolved = &r
+		}
+		return p.visible(field, *resolved)
+	}
+
+	for field, value := range map[string]*string{
+		"dn":       &employee.DN,
+		"mail":     &employee.Mail,
+		"title":    &employee.Title,
+		"phone":    &employee.Phone,
+		"location": &employee.Location,
+	} {
+		if *value != "" && !visible(field) {
+			*value = ""
+		}
+	}
+	for key := range employee.Custom {
+		if !visible(customPrefix + "." + key) {
+			delete(employee.Custom, key)
+		}
+	}
+	if len(employee.Custom) == 0 {
+		employee.Custom = nil
+	}
+}
+
+func relationTo(ctx context.Context, dir service.CorporateDirectory, viewer *int, employee *service.Employee) relation {
+	var r relation
+	if viewer == nil {
+		return r
+	}
+	if *viewer == employee.ID {
+		r.self = true
+		return r
+	}
+	r.manager = employee.ManagerID != nil && *employee.ManagerID == *viewer
+	if r.manager {
+		r.chain = true
+		return r
+	}
+	// Any failure, e.g. the viewer is not in the directory (anymore), leaves the viewer without access
+	common, err := dir.GetCommonManager(ctx, *viewer, employee.ID)
+	r.chain = err == nil && common.ID == *viewer
+	return r
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+)
+
+//
+// Visibility policy of employee attributes. Each restricted field lists audiences allowed to see it, relative to
+// the employee being viewed, any other field is visible to everyone. ID, name (surname and user name included) and
+// hierarchy can't be restricted, as the directory is useless without them.
+//
+
+var (
+	ErrUnknownField    = errors.New(`unknown field`)
+	ErrUnknownAudience = errors.New(`unknown audience`)
+)
+
+// Who may see a field. HR admins are not an audience, they always see everything since they may change it anyway
+type Audience string
+
+const (
+	Everyone Audience = "everyone"
+	// The employee him/herself
+	Self Audience = "self"
+	// Direct manager of the employee
+	Manager Audience = "manager"
+	// Anyone up the management chain of the employee, including the direct manager
+	Chain Audience = "chain"
+)
+
+var audiences = map[Audience]bool{
+	Everyone: true,
+	Self:     true,
+	Manager:  true,
+	Chain:    true,
+}
+
+// Prefix of custom fields, e.g. custom.salary_band. Plain custom is the rule of custom fields without their own rule
+const customPrefix = "custom"
+
+var fixedFields = map[string]bool{
+	"dn":       true,
+	"mail":     true,
+	"title":    true,
+	"phone":    true,
+	"location": true,
+}
+
+type Policy struct {
+	rules map[string][]Audience
+}
+
+// policy file format
+type policyFile struct {
+	Fields map[string][]Audience `yaml:"fields"`
+}
+
+// New validates rules, audiences by field name
+func New(rules map[string][]Audience) (*Policy, error) {
+	for field, allowed := range rules {
+		if !fixedFields[field] && field != customPrefix && !strings.HasPrefix(field, customPrefix+".") {
+			return nil, fmt.Errorf("%v %q", ErrUnknownField, field)
+		}
+		for _, audience := range allowed {
+			if !audiences[audience] {
+				return nil, fmt.Errorf("%s: %v %q", field, ErrUnknownAudience, audience)
+			}
+		}
+	}
+	return &Policy{rules: rules}, nil
+}
+
+// Load policy from a YAML file with audiences under fields, e.g. phone: [self, chain]
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file policyFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	policy, err := New(file.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return policy, nil
+}
+
+// Relation of the viewer to the viewed employee
+type relation struct {
+	self    bool
+	manager bool
+	chain   bool
+}
+
+func (r relation) includes(audience Audience) bool {
+	switch audience {
+	case Everyone:
+		return true
+	case Self:
+		return r.self
+	case Manager:
+		return r.manager
+	case Chain:
+		return r.chain
+	}
+	return false
+}
+
+// Rule of the field and whether there is one at all
+func (p *Policy) rule(field string) ([]Audience, bool) {
+	allowed, ok := p.rules[field]
+	if !ok && strings.HasPrefix(field, customPrefix+".") {
+		allowed, ok = p.rules[customPrefix]
+	}
+	return allowed, ok
+}
+
+func (p *Policy) visible(field string, r relation) bool {
+	allowed, ok := p.rule(field)
+	if !ok {
+		return true
+	}
+	for _, audience := range allowed {
+		if r.includes(audience) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"testing"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := Load("testdata/policy.yaml"); err != nil {
+		t.Errorf("load failed: %v", err)
+	}
+	if _, err := Load("testdata/unknown_field.yaml"); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+	if _, err := New(map[string][]Audience{"phone": {"hr"}}); err == nil {
+		t.Errorf("expected error for unknown audience")
+	}
+}
+
+// Claire manages Alice and Bob, Alice manages Carol
+func setupDirectory(t *testing.T) service.CorporateDirectory {
+	policy, err := Load("testdata/policy.yaml")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	custom := map[string]string{"team": "core", "salary_band": "L5"}
+	employees := []*service.Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1)},
+		{ID: 3, Name: "Bob", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Carol", ManagerID: intPtr(2), Title: "Engineer", Phone: "555-0104", Location: "Berlin",
+			Custom: custom},
+	}
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := svc.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return Middleware(policy)(svc)
+}
+
+func TestMiddleware(t *testing.T) {
+	dir := setupDirectory(t)
+	viewer := func(id *int, role auth.Role) context.Context {
+		return auth.NewContext(context.Background(), auth.Identity{Subject: "viewer", Role: role, EmployeeID: id})
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		phone      string
+		location   string
+		salaryBand string
+	}{
+		{"self", viewer(intPtr(4), auth.RoleReader), "555-0104", "Berlin", ""},
+		{"manager", viewer(intPtr(2), auth.RoleReader), "555-0104", "Berlin", "L5"},
+		{"chain", viewer(intPtr(1), auth.RoleReader), "555-0104", "", "L5"},
+		{"peer of manager", viewer(intPtr(3), auth.RoleReader), "", "", ""},
+		{"unknown employee", viewer(intPtr(9), auth.RoleReader), "", "", ""},
+		{"not an employee", viewer(nil, auth.RoleReader), "", "", ""},
+		{"anonymous", context.Background(), "", "", ""},
+		{"hr", viewer(nil, auth.RoleAdmin), "555-0104", "Berlin", "L5"},
+	}
+	for _, test := range tests {
+		employee, err := dir.GetEmployee(test.ctx, 4)
+		if err != nil {
+			t.Fatalf("%s: get failed: %v", test.name, err)
+		}
+		if employee.Phone != test.phone || employee.Location != test.location ||
+			employee.Custom["salary_band"] != test.salaryBand {
+			t.Errorf("%s: unexpected fields phone=%q location=%q custom=%v", test.name, employee.Phone,
+				employee.Location, employee.Custom)
+		}
+		// Unrestricted fields are public
+		if employee.Title != "Engineer" || employee.Custom["team"] != "core" {
+			t.Errorf("%s: public fields were redacted: %+v", test.name, employee)
+		}
+	}
+
+	employees, err := dir.GetEmployees(viewer(intPtr(3), auth.RoleReader))
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	for _, employee := range employees {
+		if employee.ID == 4 && employee.Phone != "" {
+			t.Errorf("phone was not redacted in list")
+		}
+	}
+
+	// Hidden attributes can't be probed by filtering on them
+	salaryBand := service.EmployeeQuery{Custom: map[string]string{"salary_band": "L5"}}
+	for id, found := range map[int]int{3: 0, 2: 1} {
+		page, err := dir.ListEmployees(viewer(intPtr(id), auth.RoleReader), salaryBand)
+		if err != nil || len(page.Employees) != found {
+			t.Errorf("viewer %d: expected %d employees, got %+v, error=%v", id, found, page, err)
+		}
+	}
+
+	// Redaction applies to copies, the directory keeps all fields
+	employee, _ := dir.GetEmployee(viewer(nil, auth.RoleAdmin), 4)
+	if employee.Phone == "" || len(employee.Custom) != 2 {
+		t.Errorf("directory lost fields: %+v", employee)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"sort"
+)
+
+// Change of a single employee between two versions of the directory. Before is nil for added employees, After for
+// removed ones
+type EmployeeChange struct {
+	Before *Employee
+	After  *Employee
+}
+
+// Moved reports whether the employee got a new manager
+func (c EmployeeChange) Moved() bool {
+	if c.Before == nil || c.After == nil {
+		return false
+	}
+	return !sameManager(c.Before.ManagerID, c.After.ManagerID)
+}
+
+// ChangeSet describes the change made by a setup or mutation given a context of NewChangeSetContext. It refers to
+// the immutable states before and after the change, so decorators describing changes need no copies of the directory
+type ChangeSet struct {
+	before *directoryState
+	after  *directoryState
+
+	// Changed employees of both states, found on first use
+	changes []EmployeeChange
+	diffed  bool
+}
+
+type changeSetKey struct{}
+
+// NewChangeSetContext returns a context recording the next setup or mutation made with it into the returned set.
+// Decorators nested within each other share the set of the outermost one
+func NewChangeSetContext(ctx context.Context) (context.Context, *ChangeSet) {
+	if set := changeSetFromContext(ctx); set != nil {
+		return ctx, set
+	}
+	set := &ChangeSet{}
+	return context.WithValue(ctx, changeSetKey{}, set), set
+}
+
+func changeSetFromContext(ctx context.Context) *ChangeSet {
+	set, _ := ctx.Value(changeSetKey{}).(*ChangeSet)
+	return set
+}
+
+// Done reports whether the change succeeded, there is nothing to describe otherwise
+func (set *ChangeSet) Done() bool {
+	return set.after != nil
+}
+
+// Version of the directory after the change
+func (set *ChangeSet) Version() uint64 {
+	return set.after.version
+}
+
+// Sizes returns the number of employees before and after the change, after is the same as before unless it succeeded
+func (set *ChangeSet) Sizes() (before, after int) {
+	if set.before != nil {
+		before = len(set.before.employees)
+	}
+	if set.after == nil {
+		return before, before
+	}
+	return before, len(set.after.employees)
+}
+
+// Counts returns how many employees were added, removed and changed
+func (set *ChangeSet) Counts() (added, removed, changed int) {
+	for _, change := range set.diff() {
+		switch {
+		case change.Before == nil:
+			added++
+		case change.After == nil:
+			removed++
+		default:
+			changed++
+		}
+	}
+	return added, removed, changed
+}
+
+// Changes lists copies of employees added, removed or changed, ordered by ID. Reports are derived from managers, so
+// an employee whose reports changed is not changed itself
+func (set *ChangeSet) Changes() []EmployeeChange {
+	changes := set.diff()
+	res := make([]EmployeeChange, len(changes))
+	for idx, change := range changes {
+		if change.Before != nil {
+			res[idx].Before = cloneEmployee(change.Before)
+		}
+		if change.After != nil {
+			res[idx].After = cloneEmployee(change.After)
+		}
+	}
+	return res
+}
+
+// ChainBefore returns IDs of managers above the employee before the change, closest first
+func (set *ChangeSet) ChainBefore(id int) []int {
+	return set.before.chain(id)
+}
+
+// ChainAfter returns IDs of managers above the employee after the change, closest first
+func (set *ChangeSet) ChainAfter(id int) []int {
+	return set.after.chain(id)
+}
+
+// Employees of both states are looked up by their ID maps, so only the changes themselves are allocated
+func (set *ChangeSet) diff() []EmployeeChange {
+	if set.diffed || set.after == nil {
+		return set.changes
+	}
+	set.diffed = true
+	before, after := set.before, set.after
+	for _, employee := range after.employees {
+		idx, ok := before.idToIndex[employee.ID]
+		if !ok {
+			set.changes = append(set.changes, EmployeeChange{After: employee})
+		} else if old := before.employees[idx]; !sameAttributes(old, employee) {
+			set.changes = append(set.changes, EmployeeChange{Before: old, After: employee})
+		}
+	}
+	for _, employee := range before.employees {
+		if _, ok := after.idToIndex[employee.ID]; !ok {
+			set.changes = append(set.changes, EmployeeChange{Before: employee})
+		}
+	}
+	sort.Slice(set.changes, func(i, j int) bool {
+		return set.changes[i].id() < set.changes[j].id()
+	})
+	return set.changes
+}
+
+// IDs of managers above the employee, closest first. The directory is a tree, so walking up always ends with Claire
+func (state *directoryState) chain(id int) []int {
+	var res []int
+	idx, ok := state.idToIndex[id]
+	for ok && state.employees[idx].ManagerID != nil {
+		manager := *state.employees[idx].ManagerID
+		res = append(res, manager)
+		idx, ok = state.idToIndex[manager]
+	}
+	return res
+}
+
+func (c EmployeeChange) id() int {
+	if c.After != nil {
+		return c.After.ID
+	}
+	return c.Before.ID
+}
+
+// All fields but Subordinates, which are derived from managers. Compared one by one, as diffs of large setups compare
+// every employee
+func sameAttributes(a, b *Employee) bool {
+	if a.ID != b.ID || a.Name != b.Name || !sameManager(a.ManagerID, b.ManagerID) || a.DN != b.DN ||
+		a.Mail != b.Mail || a.Title != b.Title || a.Phone != b.Phone || a.Location != b.Location ||
+		a.Surname != b.Surname || a.UserName != b.UserName || len(a.Custom) != len(b.Custom) {
+		return false
+	}
+	for key, value := range a.Custom {
+		if other, ok := b.Custom[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func sameManager(a, b *int) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
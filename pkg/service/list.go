@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"sort"
+)
+
+// Orders employees can be listed in, besides the order they were set up in
+const (
+	SortByID   = "id"
+	SortByName = "name"
+)
+
+// Sort key of the employee a listing continues after
+type EmployeeCursor struct {
+	ID   int
+	Name string
+}
+
+// Page of employees asked for from ListEmployees
+type EmployeeQuery struct {
+	// Page size, zero for all matching employees
+	Limit int
+	// SortByID or SortByName, otherwise pages come in ID order and all employees in directory order
+	Sort string
+	// Continue right after this sort key
+	After *EmployeeCursor
+	// Only direct reports of this manager
+	ManagerID *int
+	// Only employees having all of these custom attributes
+	Custom map[string]string
+}
+
+// Employees of a page, Next is set when more employees match the query
+type EmployeePage struct {
+	Employees []*Employee
+	Next      *EmployeeCursor
+}
+
+// Order of employees by sort key, ties of names are broken by ID so the order is total
+func employeeLess(key string) func(a, b *Employee) bool {
+	if key == SortByName {
+		return func(a, b *Employee) bool {
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.ID < b.ID
+		}
+	}
+	return func(a, b *Employee) bool {
+		return a.ID < b.ID
+	}
+}
+
+// Indices of employees sorted by key
+func sortedIndices(employees []*Employee, key string) []int {
+	less := employeeLess(key)
+	indices := make([]int, len(employees))
+	for idx := range indices {
+		indices[idx] = idx
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return less(employees[indices[i]], employees[indices[j]])
+	})
+	return indices
+}
+
+// Indices of employees in the requested order, nil for directory order
+func (state *directoryState) order(key string) []int {
+	switch key {
+	case SortByID:
+		return state.byID
+	case SortByName:
+		return state.byName
+	}
+	return nil
+}
+
+func (query *EmployeeQuery) matches(employee *Employee) bool {
+	if query.ManagerID != nil && (employee.ManagerID == nil || *employee.ManagerID != *query.ManagerID) {
+		return false
+	}
+	for key, value := range query.Custom {
+		if employee.Custom[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk employees in the requested order from the cursor on, stopping right after the first match beyond the page
+func (state *directoryState) listEmployees(query EmployeeQuery) *EmployeePage {
+	if query.Sort != SortByName && (query.Limit > 0 || query.After != nil) {
+		query.Sort = SortByID
+	}
+	order := state.order(query.Sort)
+	at := func(i int) *Employee {
+		if order == nil {
+			return state.employees[i]
+		}
+		return state.employees[order[i]]
+	}
+	start := 0
+	if query.After != nil {
+		less := employeeLess(query.Sort)
+		after := &Employee{ID: query.After.ID, Name: query.After.Name}
+		start = sort.Search(len(order), func(i int) bool {
+			return less(after, at(i))
+		})
+	}
+
+	page := &EmployeePage{Employees: []*Employee{}}
+	for i := start; i < len(state.employees); i++ {
+		employee := at(i)
+		if !query.matches(employee) {
+			continue
+		}
+		if query.Limit > 0 && len(page.Employees) == query.Limit {
+			last := page.Employees[len(page.Employees)-1]
+			page.Next = &EmployeeCursor{ID: last.ID, Name: last.Name}
+			break
+		}
+		page.Employees = append(page.Employees, employee)
+	}
+	return page
+}
+
+// Page of employees as asked for by the query. Orders are prepared by every setup and only employees of the page are
+// copied, so the cost of a page doesn't depend on the size of the directory beyond skipping filtered out employees
+func (dir *CorporateDirectoryService) ListEmployees(_ context.Context, query EmployeeQuery) (*EmployeePage, error) {
+	page := dir.loadState().listEmployees(query)
+	for idx, employee := range page.Employees {
+		page.Employees[idx] = cloneEmployee(employee)
+	}
+	return page, nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/trace"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"time"
+)
+
+// Decorator of the service, e.g. for instrumentation or logging
+type Middleware func(CorporateDirectory) CorporateDirectory
+
+type instrumentingMiddleware struct {
+	CorporateDirectory
+	setupDuration metrics.Histogram
+}
+
+// InstrumentingMiddleware observes duration of setups in seconds, labeled with success. Setup includes validation
+// and solver preprocessing, the latter is measured separately by lca.InstrumentingSolverFactory
+func InstrumentingMiddleware(setupDuration metrics.Histogram) Middleware {
+	return func(next CorporateDirectory) CorporateDirectory {
+		return &instrumentingMiddleware{CorporateDirectory: next, setupDuration: setupDuration}
+	}
+}
+
+func (mw *instrumentingMiddleware) Setup(ctx context.Context, employees []*Employee) (err error) {
+	defer func(begin time.Time) {
+		mw.setupDuration.With("success", fmt.Sprint(err == nil)).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.CorporateDirectory.Setup(ctx, employees)
+}
+
+type loggingMiddleware struct {
+	CorporateDirectory
+	logger log.Logger
+}
+
+// LoggingMiddleware logs changes of the directory with their outcome and the authenticated caller. Queries are left to
+// transport logging, and employees are never logged in full, setup only reports how many were submitted
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next CorporateDirectory) CorporateDirectory {
+		return &loggingMiddleware{CorporateDirectory: next, logger: logger}
+	}
+}
+
+func (mw *loggingMiddleware) log(ctx context.Context, begin time.Time, err error, keyvals ...interface{}) {
+	prefix := []interface{}{"request_id", requestid.FromContext(ctx)}
+	if identity, ok := auth.FromContext(ctx); ok {
+		prefix = append(prefix, "caller", identity.Subject)
+	}
+	keyvals = append(prefix, keyvals...)
+	keyvals = append(keyvals, "took", time.Since(begin), "err", err)
+	_ = mw.logger.Log(keyvals...)
+}
+
+func (mw *loggingMiddleware) Setup(ctx context.Context, employees []*Employee) (err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx, begin, err, "method", "setup", "employees", len(employees), "valid", err == nil)
+	}(time.Now())
+	return mw.CorporateDirectory.Setup(ctx, employees)
+}
+
+func (mw *loggingMiddleware) AddEmployee(ctx context.Context, employee *Employee) (res *Employee, err error) {
+	defer func(begin time.Time) {
+		id := employee.ID
+		if res != nil {
+			id = res.ID
+		}
+		mw.log(ctx, begin, err, "method", "add_employee", "id", id)
+	}(time.Now())
+	return mw.CorporateDirectory.AddEmployee(ctx, employee)
+}
+
+func (mw *loggingMiddleware) UpdateEmployee(ctx context.Context, employee *Employee) (res *Employee, err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx, begin, err, "method", "update_employee", "id", employee.ID)
+	}(time.Now())
+	return mw.CorporateDirectory.UpdateEmployee(ctx, employee)
+}
+
+func (mw *loggingMiddleware) RemoveEmployee(ctx context.Context, id int) (err error) {
+	defer func(begin time.Time) {
+		mw.log(ctx, begin, err, "method", "remove_employee", "id", id)
+	}(time.Now())
+	return mw.CorporateDirectory.RemoveEmployee(ctx, id)
+}
+
+type tracingMiddleware struct {
+	CorporateDirectory
+}
+
+// TracingMiddleware wraps every method except Ready in a span named after it. Spans of the wrapped service, like
+// waiting on setupMutex or solver calls, become its children
+func TracingMiddleware() Middleware {
+	return func(next CorporateDirectory) CorporateDirectory {
+		return &tracingMiddleware{CorporateDirectory: next}
+	}
+}
+
+func (mw *tracingMiddleware) Setup(ctx context.Context, employees []*Employee) error {
+	ctx, span := trace.Start(ctx, "service.Setup")
+	defer span.End()
+	span.SetAttribute("employees", len(employees))
+	err := mw.CorporateDirectory.Setup(ctx, employees)
+	span.SetError(err)
+	return err
+}
+
+func (mw *tracingMiddleware) GetCommonManager(ctx context.Context, first, second int) (*Employee, error) {
+	ctx, span := trace.Start(ctx, "service.GetCommonManager")
+	defer span.End()
+	span.SetAttribute("first", first)
+	span.SetAttribute("second", second)
+	res, err := mw.CorporateDirectory.GetCommonManager(ctx, first, second)
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) GetCommonManagers(ctx context.Context, pairs []EmployeePair) (
+	[]CommonManagerResult, error) {
+	ctx, span := trace.Start(ctx, "service.GetCommonManagers")
+	defer span.End()
+	span.SetAttribute("pairs", len(pairs))
+	res, err := mw.CorporateDirectory.GetCommonManagers(ctx, pairs)
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) GetEmployee(ctx context.Context, id int) (*Employee, error) {
+	ctx, span := trace.Start(ctx, "service.GetEmployee")
+	defer span.End()
+	span.SetAttribute("id", id)
+	res, err := mw.CorporateDirectory.GetEmployee(ctx, id)
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) GetEmployees(ctx context.Context) ([]*Employee, error) {
+	ctx, span := trace.Start(ctx, "service.GetEmployees")
+	defer span.End()
+	res, err := mw.CorporateDirectory.GetEmployees(ctx)
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) ListEmployees(ctx context.Context, query EmployeeQuery) (*EmployeePage, error) {
+	ctx, span := trace.Start(ctx, "service.ListEmployees")
+	defer span.End()
+	span.SetAttribute("limit", query.Limit)
+	res, err := mw.CorporateDirectory.ListEmployees(ctx, query)
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) AddEmployee(ctx context.Context, employee *Employee) (*Employee, error) {
+	ctx, span := trace.Start(ctx, "service.AddEmployee")
+	defer span.End()
+	res, err := mw.CorporateDirectory.AddEmployee(ctx, employee)
+	if res != nil {
+		span.SetAttribute("id", res.ID)
+	}
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) UpdateEmployee(ctx context.Context, employee *Employee) (*Employee, error) {
+	ctx, span := trace.Start(ctx, "service.UpdateEmployee")
+	defer span.End()
+	span.SetAttribute("id", employee.ID)
+	res, err := mw.CorporateDirectory.UpdateEmployee(ctx, employee)
+	span.SetError(err)
+	return res, err
+}
+
+func (mw *tracingMiddleware) RemoveEmployee(ctx context.Context, id int) error {
+	ctx, span := trace.Start(ctx, "service.RemoveEmployee")
+	defer span.End()
+	span.SetAttribute("id", id)
+	err := mw.CorporateDirectory.RemoveEmployee(ctx, id)
+	span.SetError(err)
+	return err
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/requestid"
+	"github.com/go-kit/kit/log"
+	"strings"
+	"testing"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	dir := LoggingMiddleware(log.NewLogfmtLogger(&buf))(NewCorporateDirectoryService(newMockLCASolver))
+	ctx := requestid.NewContext(context.Background(), "r1")
+
+	_ = dir.Setup(ctx, []*Employee{{ID: 1, Name: "Alice"}})
+	_ = dir.Setup(ctx, []*Employee{{ID: 1, Name: "Claire"}, {ID: 2, Name: "Secret Name", ManagerID: intPtr(1)}})
+	ctx = auth.NewContext(ctx, auth.Identity{Subject: "hr-tool", Role: auth.RoleAdmin})
+	_, _ = dir.AddEmployee(ctx, &Employee{Name: "D", ManagerID: intPtr(2)})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 log lines, got %q", buf.String())
+	}
+	expected := []string{
+		"request_id=r1 method=setup employees=1 valid=false took=",
+		"request_id=r1 method=setup employees=2 valid=true took=",
+		"request_id=r1 caller=hr-tool method=add_employee id=3 took=",
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected line starting with %q, got %q", prefix, lines[i])
+		}
+	}
+	if strings.Contains(buf.String(), "Secret") {
+		t.Errorf("employee data was logged: %s", buf.String())
+	}
+}
@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
 	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/trace"
 	"errors"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -11,143 +14,303 @@ var (
 	ErrInvalidEdge     = errors.New(`employee links to an invalid employee id`)
 	ErrEmployeeExists  = errors.New(`multiple employees with same id`)
 	ErrBossNotFound    = errors.New(`employee with name Claire was not found`)
+	ErrManagerConflict = errors.New(`employee manager_id conflicts with subordinates of another employee`)
+	ErrRemoveBoss      = errors.New(`employee named Claire can not be removed`)
+	ErrVersionMismatch = errors.New(`directory has been changed since the expected version`)
 )
 
+// Employee may be submitted either with the list of its subordinates (parent -> child) or with the ID of its manager
+// (child -> parent), both ways may be mixed within a single setup. After setup both fields are populated.
 type Employee struct {
 	ID           int    `json:"id"`
 	Name         string `json:"name"`
 	Subordinates []int  `json:"subordinates"`
+	// ID of the manager, nil for Claire
+	ManagerID *int `json:"manager_id,omitempty"`
+
+	// Optional attributes, mostly coming from LDAP
+	DN       string `json:"dn,omitempty"`
+	Mail     string `json:"mail,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Surname of LDAP entries and userName of SCIM users, kept so they are exported back as they came
+	Surname  string `json:"surname,omitempty"`
+	UserName string `json:"user_name,omitempty"`
+	// Free form attributes, e.g. cost center or salary band
+	Custom map[string]string `json:"custom,omitempty"`
+}
+
+// Pair of employees whose closest common manager is asked for
+type EmployeePair struct {
+	First  int `json:"first"`
+	Second int `json:"second"`
+}
+
+// Answer for one pair of a batch, Err is set instead of Manager when there is none
+type CommonManagerResult struct {
+	Manager *Employee
+	Err     error
 }
 
 // We assume that employees are known in advance or change rarely so we can afford to recalculate the solution
-// For tests we will be able to mock the service or swap the implementation
+// For tests we will be able to mock the service or swap the implementation, e.g. with a remote client
 type CorporateDirectory interface {
-	Setup(employees []*Employee) error
-	GetCommonManager(first, second int) (*Employee, error)
-	GetEmployee(id int) (*Employee, error)
-	GetEmployees() ([]*Employee, error)
+	Setup(ctx context.Context, employees []*Employee) error
+	GetCommonManager(ctx context.Context, first, second int) (*Employee, error)
+	// Closest common managers of all pairs in their order, all answered by the same version of the directory
+	GetCommonManagers(ctx context.Context, pairs []EmployeePair) ([]CommonManagerResult, error)
+	GetEmployee(ctx context.Context, id int) (*Employee, error)
+	GetEmployees(ctx context.Context) ([]*Employee, error)
+	// Page of employees matching the query, in the order it asks for
+	ListEmployees(ctx context.Context, query EmployeeQuery) (*EmployeePage, error)
+
+	// Single employee mutations, hierarchy is changed through ManagerID
+	AddEmployee(ctx context.Context, employee *Employee) (*Employee, error)
+	UpdateEmployee(ctx context.Context, employee *Employee) (*Employee, error)
+	RemoveEmployee(ctx context.Context, id int) error
+
+	// Whether a valid org has been set up, before that there is nothing to query
+	Ready(ctx context.Context) bool
+	// Version of the directory, incremented by every successful setup and mutation, zero before the first one
+	Version(ctx context.Context) uint64
 }
 
 // Service implementation. Main functionality implemented by this service is ID resolution from client representation
-// to representation required by LCASolver interface
+// to representation required by LCASolver interface. Each setup builds a new immutable state which is then published
+// atomically, so readers never wait for a setup in progress
 type CorporateDirectoryService struct {
-	// Map to lookup employee index by his/her ID
-	idToIndex *sync.Map
-
-	// employees list
-	employees []*Employee
+	// Current *directoryState
+	state atomic.Value
 
-	// Lock so we don't get into race conditions with simultaneous setup/common requests
-	setupMutex sync.RWMutex
-	// Solver implementation injected into this service
-	solver lca.LCASolver
+	// Lock so we don't get into race conditions with simultaneous setups and mutations, readers don't take it
+	setupMutex sync.Mutex
+	// Factory of solvers, each state gets its own solver
+	newSolver lca.SolverFactory
 }
 
-func NewCorporateDirectoryService(solver lca.LCASolver) *CorporateDirectoryService {
-	return &CorporateDirectoryService{
-		idToIndex: &sync.Map{},
-		solver:    solver,
+func NewCorporateDirectoryService(newSolver lca.SolverFactory) *CorporateDirectoryService {
+	dir := &CorporateDirectoryService{
+		newSolver: newSolver,
 	}
+	dir.state.Store(&directoryState{idToIndex: map[int]int{}})
+	return dir
 }
 
-// Setup service, preparing data structures for further queries
-func (dir *CorporateDirectoryService) Setup(employees []*Employee) error {
-	dir.setupMutex.Lock()
+// Setup service, preparing data structures for further queries. Employees are copied, so the caller may keep
+// using them afterwards, unless ctx hands them over with NewHandOverContext
+func (dir *CorporateDirectoryService) Setup(ctx context.Context, employees []*Employee) error {
+	dir.lock(ctx)
 	defer dir.setupMutex.Unlock()
-
-	// Find Claire and place her as the first node
-	ok := false
-	for idx, employee := range employees {
-		if employee.Name == "Claire" {
-			employees[0], employees[idx] = employees[idx], employees[0]
-			ok = true
-			break
-		}
-	}
-	if !ok {
-		return ErrBossNotFound
+	if err := dir.loadState().checkVersion(ctx); err != nil {
+		return err
 	}
 
-	// Prepare Employee ID -> Employee index in array map, making sure Employee IDs are unique
-	idToIndex := sync.Map{}
+	if handedOver, _ := ctx.Value(handOverKey{}).(bool); handedOver {
+		return dir.setup(ctx, employees)
+	}
+	copied := make([]*Employee, len(employees))
 	for idx, employee := range employees {
-		if _, ok := idToIndex.Load(employee.ID); ok {
-			return ErrEmployeeExists
-		}
-		idToIndex.Store(employee.ID, idx)
+		copied[idx] = cloneEmployee(employee)
 	}
+	return dir.setup(ctx, copied)
+}
 
-	// Prepare represenstion for LCASolver interface  while checking all the edges
-	nodesAdjList := make([][]int, len(employees))
-	for idx, node := range employees {
-		for _, child := range node.Subordinates {
-			childNodeId, ok := idToIndex.Load(child)
-			if !ok {
-				return ErrInvalidEdge
-			}
-			nodesAdjList[idx] = append(nodesAdjList[idx], childNodeId.(int))
-		}
+type handOverKey struct{}
+
+// NewHandOverContext makes Setup take over the employees instead of copying them, for callers that never use them
+// again, e.g. transports decoding them from a request. Large setups then don't hold the org twice
+func NewHandOverContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, handOverKey{}, true)
+}
+
+// Take setupMutex, time spent waiting behind other setups and mutations is traced separately. The state a change
+// starts from is recorded for the change set of ctx
+func (dir *CorporateDirectoryService) lock(ctx context.Context) {
+	_, span := trace.Start(ctx, "service.setupMutex.wait")
+	dir.setupMutex.Lock()
+	span.End()
+	if set := changeSetFromContext(ctx); set != nil {
+		*set = ChangeSet{before: dir.loadState()}
 	}
+}
 
-	// Setup solver and if everything went well update service struct
-	err := dir.solver.Setup(nodesAdjList)
+// Build new state off to the side and publish it if everything went well. Employees must not be referenced by anyone
+// else, as the state takes ownership over them
+func (dir *CorporateDirectoryService) setup(ctx context.Context, employees []*Employee) error {
+	state, err := newDirectoryState(ctx, employees, dir.newSolver())
 	if err != nil {
 		return err
 	}
-
-	dir.idToIndex = &idToIndex
-	dir.employees = employees
+	state.version = dir.loadState().version + 1
+	dir.state.Store(state)
+	if set := changeSetFromContext(ctx); set != nil {
+		set.after = state
+	}
 	return nil
 }
 
-// Actual request, get closest common manager for two employees by their ID
-func (dir *CorporateDirectoryService) GetCommonManager(first, second int) (*Employee, error) {
-	dir.setupMutex.RLock()
-	defer dir.setupMutex.RUnlock()
+func (dir *CorporateDirectoryService) loadState() *directoryState {
+	return dir.state.Load().(*directoryState)
+}
 
-	// Resolve indices
-	firstId, err := dir.resolveId(first)
+// Actual request, get closest common manager for two employees by their ID. All methods return copies of employees,
+// changing them doesn't affect the directory
+func (dir *CorporateDirectoryService) GetCommonManager(ctx context.Context, first, second int) (*Employee, error) {
+	common, err := dir.loadState().getCommonManager(ctx, first, second)
 	if err != nil {
 		return nil, err
 	}
-	secondId, err := dir.resolveId(second)
+	return cloneEmployee(common), nil
+}
+
+// Pairs are answered one by one, failing pairs don't affect the others
+func (dir *CorporateDirectoryService) GetCommonManagers(ctx context.Context, pairs []EmployeePair) (
+	[]CommonManagerResult, error) {
+	state := dir.loadState()
+	res := make([]CommonManagerResult, len(pairs))
+	for idx, pair := range pairs {
+		common, err := state.getCommonManager(ctx, pair.First, pair.Second)
+		if err != nil {
+			res[idx].Err = err
+			continue
+		}
+		res[idx].Manager = cloneEmployee(common)
+	}
+	return res, nil
+}
+
+// Convenience method to get an employee by ID
+func (dir *CorporateDirectoryService) GetEmployee(_ context.Context, id int) (*Employee, error) {
+	state := dir.loadState()
+
+	employeeId, err := state.resolveId(id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Find solution and return corresponding employee
-	commonId, err := dir.solver.SolveLCA(firstId, secondId)
-	if err != nil {
+	return cloneEmployee(state.employees[employeeId]), nil
+}
+
+// Method to list all employees registered in the system
+func (dir *CorporateDirectoryService) GetEmployees(_ context.Context) ([]*Employee, error) {
+	state := dir.loadState()
+
+	employees := make([]*Employee, len(state.employees))
+	for idx, employee := range state.employees {
+		employees[idx] = cloneEmployee(employee)
+	}
+	return employees, nil
+}
+
+// Initial state is empty, while any successfully set up org contains at least Claire
+func (dir *CorporateDirectoryService) Ready(_ context.Context) bool {
+	return len(dir.loadState().employees) > 0
+}
+
+func (dir *CorporateDirectoryService) Version(_ context.Context) uint64 {
+	return dir.loadState().version
+}
+
+// Add a new employee reporting to ManagerID. If ID is zero the next free ID is assigned
+func (dir *CorporateDirectoryService) AddEmployee(ctx context.Context, employee *Employee) (*Employee, error) {
+	dir.lock(ctx)
+	defer dir.setupMutex.Unlock()
+	state := dir.loadState()
+	if err := state.checkVersion(ctx); err != nil {
 		return nil, err
 	}
 
-	return dir.employees[commonId], nil
+	added := cloneEmployee(employee)
+	added.Subordinates = nil
+	if added.ID == 0 {
+		for _, existing := range state.employees {
+			if existing.ID > added.ID {
+				added.ID = existing.ID
+			}
+		}
+		added.ID++
+	}
+	employees := state.copyEmployees()
+	employees = append(employees, added)
+	if err := dir.setup(ctx, employees); err != nil {
+		return nil, err
+	}
+	return cloneEmployee(added), nil
 }
 
-// Convenience method to get an employee by ID
-func (dir *CorporateDirectoryService) GetEmployee(id int) (*Employee, error) {
-	dir.setupMutex.RLock()
-	defer dir.setupMutex.RUnlock()
+// Replace attributes and manager of the employee with the same ID. Reports of the employee stay with him/her
+func (dir *CorporateDirectoryService) UpdateEmployee(ctx context.Context, employee *Employee) (*Employee, error) {
+	dir.lock(ctx)
+	defer dir.setupMutex.Unlock()
+	state := dir.loadState()
+	if err := state.checkVersion(ctx); err != nil {
+		return nil, err
+	}
 
-	employeeId, err := dir.resolveId(id)
+	idx, err := state.resolveId(employee.ID)
 	if err != nil {
 		return nil, err
 	}
+	updated := cloneEmployee(employee)
+	updated.Subordinates = nil
+	employees := state.copyEmployees()
+	employees[idx] = updated
+	if err := dir.setup(ctx, employees); err != nil {
+		return nil, err
+	}
+	return cloneEmployee(updated), nil
+}
+
+// Remove employee, his/her reports are moved to the removed employee's manager
+func (dir *CorporateDirectoryService) RemoveEmployee(ctx context.Context, id int) error {
+	dir.lock(ctx)
+	defer dir.setupMutex.Unlock()
+	state := dir.loadState()
+	if err := state.checkVersion(ctx); err != nil {
+		return err
+	}
+
+	idx, err := state.resolveId(id)
+	if err != nil {
+		return err
+	}
+	removed := state.employees[idx]
+	if removed.ManagerID == nil {
+		return ErrRemoveBoss
+	}
 
-	return dir.employees[employeeId], nil
+	employees := state.copyEmployees()
+	employees = append(employees[:idx], employees[idx+1:]...)
+	for _, employee := range employees {
+		if employee.ManagerID != nil && *employee.ManagerID == id {
+			managerId := *removed.ManagerID
+			employee.ManagerID = &managerId
+		}
+	}
+	return dir.setup(ctx, employees)
 }
 
-// Method to list all employees registered in the system
-func (dir *CorporateDirectoryService) GetEmployees() ([]*Employee, error) {
-	dir.setupMutex.RLock()
-	defer dir.setupMutex.RUnlock()
-	return dir.employees, nil
+// Clone returns a deep copy of the employee
+func (employee *Employee) Clone() *Employee {
+	return cloneEmployee(employee)
 }
 
-func (dir *CorporateDirectoryService) resolveId(first int) (int, error) {
-	id, ok := dir.idToIndex.Load(first)
-	if !ok {
-		return 0, ErrInvalidEmployee
+// Deep copy of an employee
+func cloneEmployee(employee *Employee) *Employee {
+	copied := *employee
+	if employee.Subordinates != nil {
+		copied.Subordinates = append(make([]int, 0, len(employee.Subordinates)), employee.Subordinates...)
+	}
+	if employee.ManagerID != nil {
+		managerId := *employee.ManagerID
+		copied.ManagerID = &managerId
+	}
+	if employee.Custom != nil {
+		copied.Custom = make(map[string]string, len(employee.Custom))
+		for key, value := range employee.Custom {
+			copied.Custom[key] = value
+		}
 	}
-	return id.(int), nil
+	return &copied
 }
@@ -1,9 +1,14 @@
 package service
 
 import (
+	"context"
+	"corporate-directory/pkg/lca"
+	"reflect"
 	"runtime"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 )
 
 type MockLCASolver struct {
@@ -24,6 +29,10 @@ func (solver *MockLCASolver) SolveLCA(first, second int) (int, error) {
 	return first, nil
 }
 
+func newMockLCASolver() lca.LCASolver {
+	return &MockLCASolver{}
+}
+
 type corporateDirectoryTestCase struct {
 	Left   int
 	Right  int
@@ -33,7 +42,9 @@ type corporateDirectoryTestCase struct {
 
 func validateCorporateDirectory(t *testing.T, dir CorporateDirectory, tests []corporateDirectoryTestCase) {
 	for _, test := range tests {
-		if ans, err := dir.GetCommonManager(test.Left, test.Right); ans != test.Answer || err != test.Error {
+		ans, err := dir.GetCommonManager(context.Background(), test.Left, test.Right)
+		// Service returns copies of employees, so compare them by ID
+		if (ans == nil) != (test.Answer == nil) || (ans != nil && ans.ID != test.Answer.ID) || err != test.Error {
 			errorFmt := "Test failed on test=(%d, %d); expected=%d; result=%d; error=%v; expected_error=%v"
 			t.Errorf(errorFmt, test.Left, test.Right, test.Answer, ans, err, test.Error)
 		}
@@ -42,11 +53,11 @@ func validateCorporateDirectory(t *testing.T, dir CorporateDirectory, tests []co
 
 func TestCorporateDirectoryServiceSetup(t *testing.T) {
 	employees := []*Employee{
-		{1, "Claire", []int{}},
+		{ID: 1, Name: "Claire", Subordinates: []int{}},
 	}
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != nil {
 		t.Error("setup failed")
 	}
@@ -54,12 +65,12 @@ func TestCorporateDirectoryServiceSetup(t *testing.T) {
 
 func TestCorporateDirectoryServiceSetupDuplicatedId(t *testing.T) {
 	employees := []*Employee{
-		{1, "Claire", []int{}},
-		{1, "A", []int{}},
+		{ID: 1, Name: "Claire", Subordinates: []int{}},
+		{ID: 1, Name: "A", Subordinates: []int{}},
 	}
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != ErrEmployeeExists {
 		t.Error("setup failed")
 	}
@@ -67,13 +78,13 @@ func TestCorporateDirectoryServiceSetupDuplicatedId(t *testing.T) {
 
 func TestCorporateDirectoryServiceSetupInvalidEdge(t *testing.T) {
 	employees := []*Employee{
-		{2, "A", []int{5}},
-		{1, "Claire", []int{2}},
-		{3, "B", []int{}},
+		{ID: 2, Name: "A", Subordinates: []int{5}},
+		{ID: 1, Name: "Claire", Subordinates: []int{2}},
+		{ID: 3, Name: "B", Subordinates: []int{}},
 	}
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != ErrInvalidEdge {
 		t.Error("setup failed")
 	}
@@ -81,23 +92,98 @@ func TestCorporateDirectoryServiceSetupInvalidEdge(t *testing.T) {
 
 func TestCorporateDirectoryServiceSetupBossNotFound(t *testing.T) {
 	employees := []*Employee{
-		{1, "_", []int{}},
-		{2, "A", []int{}},
-		{3, "B", []int{}},
+		{ID: 1, Name: "_", Subordinates: []int{}},
+		{ID: 2, Name: "A", Subordinates: []int{}},
+		{ID: 3, Name: "B", Subordinates: []int{}},
 	}
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != ErrBossNotFound {
 		t.Error("setup failed")
 	}
 }
 
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestCorporateDirectoryServiceSetupManagerId(t *testing.T) {
+	employees := []*Employee{
+		{ID: 2, Name: "A", ManagerID: intPtr(1)},
+		{ID: 1, Name: "Claire", Subordinates: []int{3}},
+		{ID: 3, Name: "B"},
+		{ID: 4, Name: "C", ManagerID: intPtr(3)},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+
+	err := dir.Setup(context.Background(), employees)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	expected := map[int]struct {
+		manager      *int
+		subordinates []int
+	}{
+		1: {nil, []int{3, 2}},
+		2: {intPtr(1), []int{}},
+		3: {intPtr(1), []int{4}},
+		4: {intPtr(3), []int{}},
+	}
+	for id, exp := range expected {
+		employee, err := dir.GetEmployee(context.Background(), id)
+		if err != nil {
+			t.Fatalf("employee %d not found", id)
+		}
+		if (employee.ManagerID == nil) != (exp.manager == nil) ||
+			(employee.ManagerID != nil && *employee.ManagerID != *exp.manager) {
+			t.Errorf("employee %d: unexpected manager_id %v", id, employee.ManagerID)
+		}
+		if len(employee.Subordinates) != len(exp.subordinates) {
+			t.Errorf("employee %d: unexpected subordinates %v", id, employee.Subordinates)
+			continue
+		}
+		for i := range exp.subordinates {
+			if employee.Subordinates[i] != exp.subordinates[i] {
+				t.Errorf("employee %d: unexpected subordinates %v", id, employee.Subordinates)
+			}
+		}
+	}
+}
+
+func TestCorporateDirectoryServiceSetupManagerIdConflict(t *testing.T) {
+	employees := []*Employee{
+		{ID: 1, Name: "Claire", Subordinates: []int{2, 3}},
+		{ID: 2, Name: "A"},
+		{ID: 3, Name: "B", ManagerID: intPtr(2)},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+
+	err := dir.Setup(context.Background(), employees)
+	if err != ErrManagerConflict {
+		t.Error("conflict not detected")
+	}
+}
+
+func TestCorporateDirectoryServiceSetupManagerIdInvalidEdge(t *testing.T) {
+	employees := []*Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "A", ManagerID: intPtr(5)},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+
+	err := dir.Setup(context.Background(), employees)
+	if err != ErrInvalidEdge {
+		t.Error("setup failed")
+	}
+}
+
 func TestCorporateDirectoryServiceBasicLookup(t *testing.T) {
 	employees := []*Employee{
-		{1, "Claire", []int{1, 2}},
-		{2, "A", []int{}},
-		{3, "B", []int{}},
+		{ID: 1, Name: "Claire", Subordinates: []int{1, 2}},
+		{ID: 2, Name: "A", Subordinates: []int{}},
+		{ID: 3, Name: "B", Subordinates: []int{}},
 	}
 
 	tests := []corporateDirectoryTestCase{
@@ -106,9 +192,9 @@ func TestCorporateDirectoryServiceBasicLookup(t *testing.T) {
 		{3, 3, employees[2], nil},
 	}
 
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != nil {
 		t.Error("setup failed")
 	}
@@ -117,9 +203,9 @@ func TestCorporateDirectoryServiceBasicLookup(t *testing.T) {
 
 func TestCorporateDirectoryServiceBasicLookupDifferentOrder(t *testing.T) {
 	employees := []*Employee{
-		{3, "B", []int{}},
-		{1, "Claire", []int{1, 2}},
-		{2, "A", []int{}},
+		{ID: 3, Name: "B", Subordinates: []int{}},
+		{ID: 1, Name: "Claire", Subordinates: []int{1, 2}},
+		{ID: 2, Name: "A", Subordinates: []int{}},
 	}
 
 	tests := []corporateDirectoryTestCase{
@@ -128,9 +214,9 @@ func TestCorporateDirectoryServiceBasicLookupDifferentOrder(t *testing.T) {
 		{3, 3, employees[0], nil},
 	}
 
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != nil {
 		t.Error("setup failed")
 	}
@@ -139,9 +225,9 @@ func TestCorporateDirectoryServiceBasicLookupDifferentOrder(t *testing.T) {
 
 func TestCorporateDirectoryServiceInvalidId(t *testing.T) {
 	employees := []*Employee{
-		{3, "B", []int{}},
-		{1, "Claire", []int{1, 2}},
-		{2, "A", []int{}},
+		{ID: 3, Name: "B", Subordinates: []int{}},
+		{ID: 1, Name: "Claire", Subordinates: []int{1, 2}},
+		{ID: 2, Name: "A", Subordinates: []int{}},
 	}
 
 	tests := []corporateDirectoryTestCase{
@@ -149,33 +235,60 @@ func TestCorporateDirectoryServiceInvalidId(t *testing.T) {
 		{2, 0, nil, ErrInvalidEmployee},
 	}
 
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
-	err := dir.Setup(employees)
+	err := dir.Setup(context.Background(), employees)
 	if err != nil {
 		t.Error("setup failed")
 	}
 	validateCorporateDirectory(t, dir, tests)
 }
 
+func TestCorporateDirectoryServiceGetCommonManagers(t *testing.T) {
+	dir := NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	err := dir.Setup(context.Background(), []*Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "A", ManagerID: intPtr(1)},
+		{ID: 3, Name: "B", ManagerID: intPtr(1)},
+		{ID: 4, Name: "C", ManagerID: intPtr(2)},
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	res, err := dir.GetCommonManagers(context.Background(), []EmployeePair{{4, 3}, {9, 3}, {4, 2}})
+	if err != nil || len(res) != 3 {
+		t.Fatalf("unexpected results %+v, %v", res, err)
+	}
+	if res[0].Manager == nil || res[0].Manager.ID != 1 || res[0].Err != nil {
+		t.Errorf("unexpected first result %+v", res[0])
+	}
+	if res[1].Manager != nil || res[1].Err != ErrInvalidEmployee {
+		t.Errorf("expected invalid employee, got %+v", res[1])
+	}
+	if res[2].Manager == nil || res[2].Manager.ID != 2 || res[2].Err != nil {
+		t.Errorf("unexpected third result %+v", res[2])
+	}
+}
+
 func TestCorporateDirectoryServiceSetupRaceCondition(t *testing.T) {
 	wg := &sync.WaitGroup{}
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
 	for i := 0; i < 8; i++ {
 		wg.Add(1)
 		go func() {
 			for j := 0; j < 100000; j++ {
 				employees := []*Employee{
-					{1, "B", []int{}},
-					{2, "Claire", []int{1, 3, 4, 5, 6}},
-					{3, "A", []int{}},
-					{4, "A", []int{}},
-					{5, "A", []int{}},
-					{6, "A", []int{}},
+					{ID: 1, Name: "B", Subordinates: []int{}},
+					{ID: 2, Name: "Claire", Subordinates: []int{1, 3, 4, 5, 6}},
+					{ID: 3, Name: "A", Subordinates: []int{}},
+					{ID: 4, Name: "A", Subordinates: []int{}},
+					{ID: 5, Name: "A", Subordinates: []int{}},
+					{ID: 6, Name: "A", Subordinates: []int{}},
 				}
 
-				err := dir.Setup(employees)
+				err := dir.Setup(context.Background(), employees)
 				if err != nil {
 					t.Error("setup failed")
 				}
@@ -189,22 +302,22 @@ func TestCorporateDirectoryServiceSetupRaceCondition(t *testing.T) {
 
 func TestCorporateDirectoryServiceRWRaceCondition(t *testing.T) {
 	wg := &sync.WaitGroup{}
-	dir := NewCorporateDirectoryService(&MockLCASolver{})
+	dir := NewCorporateDirectoryService(newMockLCASolver)
 
 	for i := 0; i < 8; i++ {
 		wg.Add(2)
 		go func() {
 			for j := 0; j < 100000; j++ {
 				employees := []*Employee{
-					{1, "B", []int{}},
-					{2, "Claire", []int{1, 3, 4, 5, 6}},
-					{3, "A", []int{}},
-					{4, "A", []int{}},
-					{5, "A", []int{}},
-					{6, "A", []int{}},
+					{ID: 1, Name: "B", Subordinates: []int{}},
+					{ID: 2, Name: "Claire", Subordinates: []int{1, 3, 4, 5, 6}},
+					{ID: 3, Name: "A", Subordinates: []int{}},
+					{ID: 4, Name: "A", Subordinates: []int{}},
+					{ID: 5, Name: "A", Subordinates: []int{}},
+					{ID: 6, Name: "A", Subordinates: []int{}},
 				}
 
-				err := dir.Setup(employees)
+				err := dir.Setup(context.Background(), employees)
 				if err != nil {
 					t.Error("setup failed")
 				}
@@ -215,7 +328,7 @@ func TestCorporateDirectoryServiceRWRaceCondition(t *testing.T) {
 
 		go func() {
 			for j := 0; j < 100000; j++ {
-				_, _ = dir.GetCommonManager(0, 0)
+				_, _ = dir.GetCommonManager(context.Background(), 0, 0)
 				runtime.Gosched()
 			}
 			wg.Done()
@@ -224,3 +337,417 @@ func TestCorporateDirectoryServiceRWRaceCondition(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func setupMutationDirectory(t *testing.T) *CorporateDirectoryService {
+	employees := []*Employee{
+		{ID: 1, Name: "Claire", Subordinates: []int{2, 3}},
+		{ID: 2, Name: "A", Subordinates: []int{4}},
+		{ID: 3, Name: "B"},
+		{ID: 4, Name: "C"},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+	if err := dir.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return dir
+}
+
+func TestCorporateDirectoryServiceAddEmployee(t *testing.T) {
+	dir := setupMutationDirectory(t)
+
+	added, err := dir.AddEmployee(context.Background(), &Employee{Name: "D", ManagerID: intPtr(3)})
+	if err != nil || added.ID != 5 {
+		t.Fatalf("add failed: %+v, %v", added, err)
+	}
+	manager, _ := dir.GetEmployee(context.Background(), 3)
+	if len(manager.Subordinates) != 1 || manager.Subordinates[0] != 5 {
+		t.Errorf("unexpected subordinates %v", manager.Subordinates)
+	}
+
+	if _, err := dir.AddEmployee(context.Background(), &Employee{ID: 2, Name: "E", ManagerID: intPtr(1)}); err != ErrEmployeeExists {
+		t.Errorf("duplicate id not detected")
+	}
+	if _, err := dir.AddEmployee(context.Background(), &Employee{Name: "E", ManagerID: intPtr(10)}); err != ErrInvalidEdge {
+		t.Errorf("invalid manager not detected")
+	}
+	if employees, _ := dir.GetEmployees(context.Background()); len(employees) != 5 {
+		t.Errorf("failed mutation changed the directory")
+	}
+}
+
+func TestCorporateDirectoryServiceListEmployees(t *testing.T) {
+	employees := []*Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 5, Name: "Bob", ManagerID: intPtr(1), Custom: map[string]string{"department": "sales"}},
+		{ID: 3, Name: "Alice", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Bob", ManagerID: intPtr(3), Custom: map[string]string{"department": "sales"}},
+		{ID: 2, Name: "Dave", ManagerID: intPtr(3)},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+	if err := dir.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	ids := func(page *EmployeePage) []int {
+		res := []int{}
+		for _, employee := range page.Employees {
+			res = append(res, employee.ID)
+		}
+		return res
+	}
+	tests := []struct {
+		query EmployeeQuery
+		ids   []int
+		next  *EmployeeCursor
+	}{
+		{EmployeeQuery{}, []int{1, 5, 3, 4, 2}, nil},
+		// Pages without a sort come in ID order, so they can be continued
+		{EmployeeQuery{Limit: 2}, []int{1, 2}, &EmployeeCursor{ID: 2, Name: "Dave"}},
+		{EmployeeQuery{Limit: 2, After: &EmployeeCursor{ID: 2}}, []int{3, 4}, &EmployeeCursor{ID: 4, Name: "Bob"}},
+		{EmployeeQuery{Limit: 2, Sort: SortByID}, []int{1, 2}, &EmployeeCursor{ID: 2, Name: "Dave"}},
+		{EmployeeQuery{Limit: 2, Sort: SortByID, After: &EmployeeCursor{ID: 2}}, []int{3, 4},
+			&EmployeeCursor{ID: 4, Name: "Bob"}},
+		{EmployeeQuery{Limit: 2, Sort: SortByID, After: &EmployeeCursor{ID: 4}}, []int{5}, nil},
+		{EmployeeQuery{Sort: SortByName}, []int{3, 4, 5, 1, 2}, nil},
+		{EmployeeQuery{Limit: 2, Sort: SortByName, After: &EmployeeCursor{ID: 4, Name: "Bob"}}, []int{5, 1},
+			&EmployeeCursor{ID: 1, Name: "Claire"}},
+		// Cursors of removed employees continue at their place
+		{EmployeeQuery{Sort: SortByName, After: &EmployeeCursor{ID: 9, Name: "Bo"}}, []int{4, 5, 1, 2}, nil},
+		{EmployeeQuery{Sort: SortByID, ManagerID: intPtr(3)}, []int{2, 4}, nil},
+		{EmployeeQuery{Limit: 1, Sort: SortByID, Custom: map[string]string{"department": "sales"}}, []int{4},
+			&EmployeeCursor{ID: 4, Name: "Bob"}},
+	}
+	for _, test := range tests {
+		page, err := dir.ListEmployees(context.Background(), test.query)
+		if err != nil || !reflect.DeepEqual(ids(page), test.ids) || !reflect.DeepEqual(page.Next, test.next) {
+			t.Errorf("query %+v: expected %v next %+v, got %v next %+v, error=%v", test.query, test.ids, test.next,
+				ids(page), page.Next, err)
+		}
+	}
+
+	// Pages are copies
+	page, _ := dir.ListEmployees(context.Background(), EmployeeQuery{Limit: 1})
+	page.Employees[0].Name = "Changed"
+	if employee, _ := dir.GetEmployee(context.Background(), 1); employee.Name != "Claire" {
+		t.Errorf("page shares employees with the directory")
+	}
+}
+
+func TestCorporateDirectoryServiceUpdateEmployee(t *testing.T) {
+	dir := setupMutationDirectory(t)
+
+	updated, err := dir.UpdateEmployee(context.Background(), &Employee{ID: 2, Name: "A2", ManagerID: intPtr(3)})
+	if err != nil || updated.Name != "A2" {
+		t.Fatalf("update failed: %+v, %v", updated, err)
+	}
+	employee, _ := dir.GetEmployee(context.Background(), 2)
+	if *employee.ManagerID != 3 || len(employee.Subordinates) != 1 || employee.Subordinates[0] != 4 {
+		t.Errorf("unexpected employee %+v", employee)
+	}
+
+	if _, err := dir.UpdateEmployee(context.Background(), &Employee{ID: 10, Name: "X"}); err != ErrInvalidEmployee {
+		t.Errorf("unknown employee not detected")
+	}
+}
+
+func TestCorporateDirectoryServiceRemoveEmployee(t *testing.T) {
+	dir := setupMutationDirectory(t)
+
+	if err := dir.RemoveEmployee(context.Background(), 2); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, err := dir.GetEmployee(context.Background(), 2); err != ErrInvalidEmployee {
+		t.Errorf("employee was not removed")
+	}
+	employee, _ := dir.GetEmployee(context.Background(), 4)
+	if *employee.ManagerID != 1 {
+		t.Errorf("reports were not moved to the manager: %+v", employee)
+	}
+
+	if err := dir.RemoveEmployee(context.Background(), 1); err != ErrRemoveBoss {
+		t.Errorf("boss removal not detected")
+	}
+}
+
+func TestCorporateDirectoryServiceFailedSetupKeepsState(t *testing.T) {
+	dir := NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	employees := []*Employee{
+		{ID: 1, Name: "Claire", Subordinates: []int{2, 3}},
+		{ID: 2, Name: "A"},
+		{ID: 3, Name: "B"},
+	}
+	if err := dir.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// Cycle is detected by the solver only, after the new solver has been partially prepared
+	invalid := []*Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "A", Subordinates: []int{3}},
+		{ID: 3, Name: "B", Subordinates: []int{2}},
+	}
+	if err := dir.Setup(context.Background(), invalid); err != lca.ErrInvalidTree {
+		t.Fatalf("invalid tree not detected: %v", err)
+	}
+
+	validateCorporateDirectory(t, dir, []corporateDirectoryTestCase{
+		{2, 3, employees[0], nil},
+		{2, 2, employees[1], nil},
+	})
+}
+
+func TestCorporateDirectoryServiceVersion(t *testing.T) {
+	dir := NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	ctx := context.Background()
+	if version := dir.Version(ctx); version != 0 {
+		t.Fatalf("expected version 0 before setup, got %d", version)
+	}
+	_ = dir.Setup(ctx, []*Employee{{ID: 1, Name: "Claire"}})
+	_ = dir.Setup(ctx, []*Employee{{ID: 1, Name: "A"}})
+	_ = dir.RemoveEmployee(ctx, 1)
+	if _, err := dir.AddEmployee(ctx, &Employee{Name: "A", ManagerID: intPtr(1)}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if version := dir.Version(ctx); version != 2 {
+		t.Errorf("only successful changes should count, got version %d", version)
+	}
+}
+
+func TestCorporateDirectoryServiceExpectedVersion(t *testing.T) {
+	dir := NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	ctx := context.Background()
+	if err := dir.Setup(NewExpectedVersionContext(ctx, 0), []*Employee{{ID: 1, Name: "Claire"}}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	stale := NewExpectedVersionContext(ctx, 0)
+	if err := dir.Setup(stale, []*Employee{{ID: 1, Name: "Claire"}}); err != ErrVersionMismatch {
+		t.Errorf("expected %v, got %v", ErrVersionMismatch, err)
+	}
+	if _, err := dir.AddEmployee(stale, &Employee{Name: "A", ManagerID: intPtr(1)}); err != ErrVersionMismatch {
+		t.Errorf("expected %v, got %v", ErrVersionMismatch, err)
+	}
+	if err := dir.RemoveEmployee(stale, 1); err != ErrVersionMismatch {
+		t.Errorf("expected %v, got %v", ErrVersionMismatch, err)
+	}
+	current := NewExpectedVersionContext(ctx, 1)
+	if _, err := dir.AddEmployee(current, &Employee{Name: "A", ManagerID: intPtr(1)}); err != nil {
+		t.Errorf("add at current version failed: %v", err)
+	}
+}
+
+// Directory guarded by sync.RWMutex as it was before states were swapped atomically, kept for comparison in benchmarks
+type rwMutexDirectory struct {
+	mutex     sync.RWMutex
+	state     *directoryState
+	newSolver lca.SolverFactory
+}
+
+func (dir *rwMutexDirectory) Setup(ctx context.Context, employees []*Employee) error {
+	dir.mutex.Lock()
+	defer dir.mutex.Unlock()
+	state, err := newDirectoryState(ctx, employees, dir.newSolver())
+	if err != nil {
+		return err
+	}
+	dir.state = state
+	return nil
+}
+
+func (dir *rwMutexDirectory) GetCommonManager(ctx context.Context, first, second int) (*Employee, error) {
+	dir.mutex.RLock()
+	defer dir.mutex.RUnlock()
+	return dir.state.getCommonManager(ctx, first, second)
+}
+
+type setupCommonManager interface {
+	Setup(ctx context.Context, employees []*Employee) error
+	GetCommonManager(ctx context.Context, first, second int) (*Employee, error)
+}
+
+// Generate an org where each employee with index i reports to employee i/8
+func generateEmployees(count int) []*Employee {
+	employees := make([]*Employee, count)
+	for i := range employees {
+		employees[i] = &Employee{ID: i + 1, Name: "A"}
+		if i > 0 {
+			managerId := i/8 + 1
+			employees[i].ManagerID = &managerId
+		}
+	}
+	employees[0].Name = "Claire"
+	return employees
+}
+
+// Measure latency of reads while setups of a 200k employees org are running in background
+func benchmarkReadLatencyDuringSetup(b *testing.B, dir setupCommonManager) {
+	const count = 200000
+	if err := dir.Setup(context.Background(), generateEmployees(count)); err != nil {
+		b.Fatalf("setup failed: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = dir.Setup(context.Background(), generateEmployees(count))
+			}
+		}
+	}()
+
+	latencies := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if _, err := dir.GetCommonManager(context.Background(), count-i%1000, count/2+i%1000); err != nil {
+			b.Fatalf("query failed: %v", err)
+		}
+		latencies[i] = time.Since(start)
+	}
+	b.StopTimer()
+	close(stop)
+	<-done
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+	b.ReportMetric(float64(latencies[len(latencies)-1].Nanoseconds()), "max-ns")
+}
+
+func BenchmarkReadLatencyDuringSetupAtomic(b *testing.B) {
+	benchmarkReadLatencyDuringSetup(b, NewCorporateDirectoryService(lca.NewOnlineLCASolver))
+}
+
+func BenchmarkReadLatencyDuringSetupRWMutex(b *testing.B) {
+	benchmarkReadLatencyDuringSetup(b, &rwMutexDirectory{newSolver: lca.NewOnlineLCASolver})
+}
+
+func TestCorporateDirectoryServiceSetupDoesNotModifyInput(t *testing.T) {
+	employees := []*Employee{
+		{ID: 2, Name: "A", ManagerID: intPtr(1)},
+		{ID: 1, Name: "Claire"},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+	if err := dir.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	if employees[0].ID != 2 || employees[1].ID != 1 || employees[1].Subordinates != nil {
+		t.Errorf("input was modified: %+v %+v", employees[0], employees[1])
+	}
+
+	// Changes made by the caller after setup must not leak into the directory
+	employees[0].Name = "B"
+	*employees[0].ManagerID = 2
+	if employee, _ := dir.GetEmployee(context.Background(), 2); employee.Name != "A" || *employee.ManagerID != 1 {
+		t.Errorf("directory was modified through input: %+v", employee)
+	}
+}
+
+func TestCorporateDirectoryServiceSetupHandOver(t *testing.T) {
+	employees := []*Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "A", ManagerID: intPtr(1)},
+	}
+	dir := NewCorporateDirectoryService(newMockLCASolver)
+	if err := dir.Setup(NewHandOverContext(context.Background()), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if dir.loadState().employees[1] != employees[1] {
+		t.Errorf("handed over employees were copied")
+	}
+}
+
+func TestCorporateDirectoryServiceChangeSet(t *testing.T) {
+	dir := setupMutationDirectory(t)
+
+	ctx, changes := NewChangeSetContext(context.Background())
+	if _, err := dir.UpdateEmployee(ctx, &Employee{ID: 4, Name: "C", ManagerID: intPtr(3)}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if nested, same := NewChangeSetContext(ctx); nested != ctx || same != changes {
+		t.Errorf("nested decorators must share the change set")
+	}
+	before, after := changes.Sizes()
+	added, removed, changed := changes.Counts()
+	if !changes.Done() || changes.Version() != 2 || before != 4 || after != 4 || added != 0 || removed != 0 ||
+		changed != 1 {
+		t.Errorf("unexpected change set: version=%d sizes=%d,%d counts=%d,%d,%d", changes.Version(), before, after,
+			added, removed, changed)
+	}
+	list := changes.Changes()
+	if len(list) != 1 || !list[0].Moved() || *list[0].Before.ManagerID != 2 {
+		t.Fatalf("unexpected changes %+v", list)
+	}
+	if chain := changes.ChainBefore(4); !reflect.DeepEqual(chain, []int{2, 1}) {
+		t.Errorf("unexpected chain before %v", chain)
+	}
+	if chain := changes.ChainAfter(4); !reflect.DeepEqual(chain, []int{3, 1}) {
+		t.Errorf("unexpected chain after %v", chain)
+	}
+	// Changes are copies
+	list[0].After.Name = "X"
+	if employee, _ := dir.GetEmployee(context.Background(), 4); employee.Name != "C" {
+		t.Errorf("change shares employees with the directory")
+	}
+
+	ctx, changes = NewChangeSetContext(context.Background())
+	if err := dir.RemoveEmployee(ctx, 1); err != ErrRemoveBoss {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if before, after := changes.Sizes(); changes.Done() || before != 4 || after != 4 {
+		t.Errorf("failed change was recorded")
+	}
+}
+
+func TestCorporateDirectoryServiceReturnedValuesRaceCondition(t *testing.T) {
+	employees := []*Employee{
+		{ID: 1, Name: "Claire", Subordinates: []int{2, 3}},
+		{ID: 2, Name: "A"},
+		{ID: 3, Name: "B"},
+	}
+	dir := NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := dir.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// Writers corrupt everything they get back while readers keep querying, the race detector must stay silent
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				all, _ := dir.GetEmployees(context.Background())
+				all[0] = nil
+				one, _ := dir.GetEmployee(context.Background(), 1)
+				one.Name = "X"
+				one.Subordinates[0] = 3
+				common, _ := dir.GetCommonManager(context.Background(), 2, 3)
+				common.Subordinates = append(common.Subordinates[:0], 5)
+				runtime.Gosched()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				common, err := dir.GetCommonManager(context.Background(), 2, 3)
+				if err != nil || common.Name != "Claire" || common.Subordinates[0] != 2 {
+					t.Errorf("directory was modified through returned values: %+v", common)
+					return
+				}
+				all, _ := dir.GetEmployees(context.Background())
+				if all[0] == nil || all[0].Name != "Claire" {
+					t.Errorf("directory was modified through returned slice")
+					return
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/util"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Name of the snapshot file within persistence directory
+const snapshotFile = "directory.json"
+
+type snapshot struct {
+	Employees []*Employee `json:"employees"`
+}
+
+// Decorator saving the whole org into a JSON snapshot after every successful change, so it survives restarts. The
+// snapshot is replaced by util.WriteFileAtomic, so neither a crash nor a power loss leaves a partially written one.
+// The change is already live when the snapshot is saved, so failures to save are logged rather than reported to the
+// caller, the next change saves the whole org again
+type snapshotDirectory struct {
+	CorporateDirectory
+	path   string
+	logger log.Logger
+
+	// Serializes saves, so an older state never overwrites a newer one
+	saveMutex sync.Mutex
+}
+
+// WithSnapshots wraps next with persistence into dir, restoring the org from an existing snapshot first. Failed saves
+// are logged to logger
+func WithSnapshots(ctx context.Context, next CorporateDirectory, dir string, logger log.Logger) (CorporateDirectory,
+	error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	res := &snapshotDirectory{CorporateDirectory: next, path: filepath.Join(dir, snapshotFile), logger: logger}
+
+	data, err := ioutil.ReadFile(res.path)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved snapshot
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	if err := next.Setup(NewHandOverContext(ctx), saved.Employees); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Save the current org, logging failures
+func (dir *snapshotDirectory) save(ctx context.Context) {
+	if err := dir.write(ctx); err != nil {
+		_ = dir.logger.Log("msg", "failed to save snapshot", "request_id", requestid.FromContext(ctx), "path", dir.path,
+			"err", err)
+	}
+}
+
+func (dir *snapshotDirectory) write(ctx context.Context) error {
+	dir.saveMutex.Lock()
+	defer dir.saveMutex.Unlock()
+
+	employees, err := dir.CorporateDirectory.GetEmployees(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot{Employees: employees})
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(dir.path, data, 0644)
+}
+
+func (dir *snapshotDirectory) Setup(ctx context.Context, employees []*Employee) error {
+	if err := dir.CorporateDirectory.Setup(ctx, employees); err != nil {
+		return err
+	}
+	dir.save(ctx)
+	return nil
+}
+
+func (dir *snapshotDirectory) AddEmployee(ctx context.Context, employee *Employee) (*Employee, error) {
+	res, err := dir.CorporateDirectory.AddEmployee(ctx, employee)
+	if err != nil {
+		return nil, err
+	}
+	dir.save(ctx)
+	return res, nil
+}
+
+func (dir *snapshotDirectory) UpdateEmployee(ctx context.Context, employee *Employee) (*Employee, error) {
+	res, err := dir.CorporateDirectory.UpdateEmployee(ctx, employee)
+	if err != nil {
+		return nil, err
+	}
+	dir.save(ctx)
+	return res, nil
+}
+
+func (dir *snapshotDirectory) RemoveEmployee(ctx context.Context, id int) error {
+	if err := dir.CorporateDirectory.RemoveEmployee(ctx, id); err != nil {
+		return err
+	}
+	dir.save(ctx)
+	return nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotsRestoreDirectory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+
+	dir, err := WithSnapshots(ctx, setupMutationDirectory(t), tmp, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("failed to open snapshots: %v", err)
+	}
+	// Nothing is saved until the first change
+	if _, err := os.Stat(filepath.Join(tmp, snapshotFile)); !os.IsNotExist(err) {
+		t.Errorf("unexpected snapshot: %v", err)
+	}
+	if _, err := dir.AddEmployee(ctx, &Employee{ID: 5, Name: "D", ManagerID: intPtr(3)}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := dir.RemoveEmployee(ctx, 2); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	// Failed changes keep the snapshot intact
+	if err := dir.RemoveEmployee(ctx, 2); err != ErrInvalidEmployee {
+		t.Fatalf("expected ErrInvalidEmployee, got %v", err)
+	}
+
+	restored, err := WithSnapshots(ctx, NewCorporateDirectoryService(newMockLCASolver), tmp, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	employees, _ := restored.GetEmployees(ctx)
+	if len(employees) != 4 {
+		t.Fatalf("expected 4 employees, got %d", len(employees))
+	}
+	employee, err := restored.GetEmployee(ctx, 4)
+	if err != nil || *employee.ManagerID != 1 {
+		t.Errorf("unexpected restored employee %+v, %v", employee, err)
+	}
+	if _, err := restored.GetEmployee(ctx, 5); err != nil {
+		t.Errorf("added employee was not restored: %v", err)
+	}
+}
+
+func TestSnapshotFailureKeepsChange(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+
+	buf := &bytes.Buffer{}
+	dir, err := WithSnapshots(ctx, setupMutationDirectory(t), tmp, log.NewLogfmtLogger(buf))
+	if err != nil {
+		t.Fatalf("failed to open snapshots: %v", err)
+	}
+	// Temporary file can't be created in place of a directory
+	if err := os.Mkdir(filepath.Join(tmp, snapshotFile+".tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.RemoveEmployee(ctx, 2); err != nil {
+		t.Fatalf("applied change must not fail: %v", err)
+	}
+	if _, err := dir.GetEmployee(ctx, 2); err != ErrInvalidEmployee {
+		t.Errorf("change was not applied: %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("failed to save snapshot")) {
+		t.Errorf("failure was not logged: %s", buf.String())
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/trace"
+)
+
+// Complete directory state produced by a single setup. State is never modified after it has been built, so it can be
+// shared between any number of readers without locking
+type directoryState struct {
+	// Map to lookup employee index by his/her ID
+	idToIndex map[int]int
+
+	// employees list
+	employees []*Employee
+
+	// Indices of employees sorted by ID and by name, for listing pages without sorting
+	byID   []int
+	byName []int
+
+	// Solver prepared for this exact list of employees
+	solver lca.LCASolver
+
+	// Version of the directory this state belongs to
+	version uint64
+}
+
+// Validate employees and prepare all data structures for further queries
+func newDirectoryState(ctx context.Context, employees []*Employee, solver lca.LCASolver) (*directoryState, error) {
+	// Find Claire and place her as the first node
+	ok := false
+	for idx, employee := range employees {
+		if employee.Name == "Claire" {
+			employees[0], employees[idx] = employees[idx], employees[0]
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, ErrBossNotFound
+	}
+
+	// Prepare Employee ID -> Employee index in array map, making sure Employee IDs are unique
+	idToIndex := make(map[int]int, len(employees))
+	for idx, employee := range employees {
+		if _, ok := idToIndex[employee.ID]; ok {
+			return nil, ErrEmployeeExists
+		}
+		idToIndex[employee.ID] = idx
+	}
+
+	// Prepare represenstion for LCASolver interface  while checking all the edges
+	nodesAdjList := make([][]int, len(employees))
+	parents := make([]int, len(employees))
+	for idx := range parents {
+		parents[idx] = -1
+	}
+	for idx, node := range employees {
+		for _, child := range node.Subordinates {
+			childNodeId, ok := idToIndex[child]
+			if !ok {
+				return nil, ErrInvalidEdge
+			}
+			nodesAdjList[idx] = append(nodesAdjList[idx], childNodeId)
+			parents[childNodeId] = idx
+		}
+	}
+
+	// Convert child -> parent links into the same representation, edges already known from subordinates are skipped
+	for idx, node := range employees {
+		if node.ManagerID == nil {
+			continue
+		}
+		managerNodeId, ok := idToIndex[*node.ManagerID]
+		if !ok {
+			return nil, ErrInvalidEdge
+		}
+		if parents[idx] == managerNodeId {
+			continue
+		}
+		if parents[idx] != -1 {
+			return nil, ErrManagerConflict
+		}
+		nodesAdjList[managerNodeId] = append(nodesAdjList[managerNodeId], idx)
+		parents[idx] = managerNodeId
+	}
+
+	// Setup solver, it is not shared with any other state so a failure doesn't affect queries
+	_, span := trace.Start(ctx, "solver.Setup")
+	span.SetAttribute("nodes", len(nodesAdjList))
+	err := solver.Setup(nodesAdjList)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	// Tree is valid, so fill in derived links in both directions
+	for idx, employee := range employees {
+		employee.Subordinates = make([]int, 0, len(nodesAdjList[idx]))
+		for _, child := range nodesAdjList[idx] {
+			employee.Subordinates = append(employee.Subordinates, employees[child].ID)
+		}
+		employee.ManagerID = nil
+		if parents[idx] != -1 {
+			managerId := employees[parents[idx]].ID
+			employee.ManagerID = &managerId
+		}
+	}
+
+	return &directoryState{
+		idToIndex: idToIndex,
+		employees: employees,
+		byID:      sortedIndices(employees, SortByID),
+		byName:    sortedIndices(employees, SortByName),
+		solver:    solver,
+	}, nil
+}
+
+func (state *directoryState) getCommonManager(ctx context.Context, first, second int) (*Employee, error) {
+	// Resolve indices
+	firstId, err := state.resolveId(first)
+	if err != nil {
+		return nil, err
+	}
+	secondId, err := state.resolveId(second)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find solution and return corresponding employee
+	_, span := trace.Start(ctx, "solver.SolveLCA")
+	commonId, err := state.solver.SolveLCA(firstId, secondId)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	return state.employees[commonId], nil
+}
+
+func (state *directoryState) resolveId(first int) (int, error) {
+	id, ok := state.idToIndex[first]
+	if !ok {
+		return 0, ErrInvalidEmployee
+	}
+	return id, nil
+}
+
+// Copy employees so that a failed mutation leaves them untouched. Hierarchy is kept in ManagerID only,
+// subordinates are derived again during setup
+func (state *directoryState) copyEmployees() []*Employee {
+	employees := make([]*Employee, len(state.employees))
+	for idx, employee := range state.employees {
+		employees[idx] = cloneEmployee(employee)
+		employees[idx].Subordinates = nil
+	}
+	return employees
+}
+
+type expectedVersionKey struct{}
+
+// NewExpectedVersionContext makes setups and mutations fail with ErrVersionMismatch unless the directory is still at
+// the given version, so concurrent writers don't overwrite each other's changes unknowingly
+func NewExpectedVersionContext(ctx context.Context, version uint64) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+// ExpectedVersionFromContext returns the version set by NewExpectedVersionContext, if any
+func ExpectedVersionFromContext(ctx context.Context) (uint64, bool) {
+	expected, ok := ctx.Value(expectedVersionKey{}).(uint64)
+	return expected, ok
+}
+
+// Fail unless the state has the version expected by ctx, if any
+func (state *directoryState) checkVersion(ctx context.Context) error {
+	if expected, ok := ExpectedVersionFromContext(ctx); ok && expected != state.version {
+		return ErrVersionMismatch
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"github.com/go-kit/kit/log"
+	"sort"
+	"sync"
+)
+
+// InMemoryExporter keeps finished spans, meant for tests
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(data SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, data)
+}
+
+// Spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Span returns the first ended span with given name
+func (e *InMemoryExporter) Span(name string) (SpanData, bool) {
+	for _, span := range e.Spans() {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return SpanData{}, false
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+type logExporter struct {
+	logger log.Logger
+}
+
+// NewLogExporter logs every span as a single line, attributes are prefixed with attr_ and sorted by key
+func NewLogExporter(logger log.Logger) Exporter {
+	return &logExporter{logger: logger}
+}
+
+func (e *logExporter) ExportSpan(data SpanData) {
+	keyvals := []interface{}{
+		"span", data.Name,
+		"trace_id", data.TraceID,
+		"span_id", data.SpanID,
+		"parent_id", data.ParentID,
+		"took", data.Duration(),
+	}
+	keys := make([]string, 0, len(data.Attributes))
+	for key := range data.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		keyvals = append(keyvals, "attr_"+key, data.Attributes[key])
+	}
+	if data.Err != "" {
+		keyvals = append(keyvals, "err", data.Err)
+	}
+	_ = e.logger.Log(keyvals...)
+}
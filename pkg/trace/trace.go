@@ -0,0 +1,230 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// Minimal tracing modeled after OpenTelemetry. Spans are kept in context.Context and exported when ended to the
+// exporter set with SetExporter, like with OpenTelemetry's global provider. Without an exporter no spans are created,
+// so instrumented code pays only for a context lookup.
+//
+
+// Header of W3C Trace Context, https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Identity of a span, either local or received from a remote caller
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats span context as traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses traceparent header value, only version 00 is known, future versions are parsed by its
+// rules as the spec requires
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 || strings.ToLower(value) != value {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	if sc.Sampled = flags[0]&1 == 1; !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Finished span as passed to exporters
+type SpanData struct {
+	Name       string
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	// Error message, empty if span succeeded
+	Err string
+}
+
+func (data SpanData) Duration() time.Duration {
+	return data.End.Sub(data.Start)
+}
+
+type Exporter interface {
+	ExportSpan(data SpanData)
+}
+
+type exporterHolder struct {
+	exporter Exporter
+}
+
+var currentExporter atomic.Value
+
+// SetExporter sets exporter for all spans ended afterwards, nil disables tracing
+func SetExporter(exporter Exporter) {
+	currentExporter.Store(exporterHolder{exporter: exporter})
+}
+
+func getExporter() Exporter {
+	holder, _ := currentExporter.Load().(exporterHolder)
+	return holder.exporter
+}
+
+// Span in progress. All methods are safe to call on nil span, which is what Start returns when tracing is disabled
+type Span struct {
+	mutex    sync.Mutex
+	data     SpanData
+	sampled  bool
+	ended    bool
+	exporter Exporter
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: s.sampled}
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// SetError marks span as failed, nil errors are ignored so it can be called with any returned error
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Err = err.Error()
+}
+
+// End finishes span and exports it if sampled, subsequent calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mutex.Unlock()
+
+	if s.sampled {
+		s.exporter.ExportSpan(data)
+	}
+}
+
+type spanKey struct{}
+
+type remoteParentKey struct{}
+
+// SpanFromContext returns current span of ctx, nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent makes spans started from ctx children of a span of another process
+func ContextWithRemoteParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, parent)
+}
+
+// Start a new span as a child of the current span of ctx, or of the remote parent, or as a root of a new trace.
+// Returned context carries the new span
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	exporter := getExporter()
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		data: SpanData{
+			Name:       name,
+			Start:      time.Now(),
+			Attributes: make(map[string]interface{}),
+		},
+		sampled:  true,
+		exporter: exporter,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentID = parent.data.SpanID
+		span.sampled = parent.sampled
+	} else if remote, ok := ctx.Value(remoteParentKey{}).(SpanContext); ok && remote.IsValid() {
+		span.data.TraceID = remote.TraceID
+		span.data.ParentID = remote.SpanID
+		span.sampled = remote.Sampled
+	} else {
+		_, _ = rand.Read(span.data.TraceID[:])
+	}
+	_, _ = rand.Read(span.data.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Traceparent of the current span of ctx for outgoing requests, empty if there is none
+func Traceparent(ctx context.Context) string {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context().Traceparent()
+	}
+	if remote, ok := ctx.Value(remoteParentKey{}).(SpanContext); ok && remote.IsValid() {
+		return remote.Traceparent()
+	}
+	return ""
+}
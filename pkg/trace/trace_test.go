@@ -0,0 +1,85 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		// Future versions may append fields
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01", false, false},
+		{"", false, false},
+	}
+	for _, test := range tests {
+		sc, ok := ParseTraceparent(test.value)
+		if ok != test.ok || sc.Sampled != test.sampled {
+			t.Errorf("%q: expected %v sampled %v, got %v sampled %v", test.value, test.ok, test.sampled, ok, sc.Sampled)
+		}
+	}
+
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if sc, _ := ParseTraceparent(value); sc.Traceparent() != value {
+		t.Errorf("expected %s, got %s", value, sc.Traceparent())
+	}
+}
+
+func TestStart(t *testing.T) {
+	SetExporter(nil)
+	if _, span := Start(context.Background(), "disabled"); span != nil {
+		t.Fatalf("span created while tracing is disabled")
+	}
+
+	exporter := NewInMemoryExporter()
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := Start(ContextWithRemoteParent(context.Background(), remote), "parent")
+	_, child := Start(ctx, "child")
+	child.SetAttribute("key", "value")
+	child.SetError(errors.New("failed"))
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	if spans[1].TraceID != remote.TraceID || spans[1].ParentID != remote.SpanID {
+		t.Errorf("parent doesn't continue remote trace: %+v", spans[1])
+	}
+	if spans[0].TraceID != remote.TraceID || spans[0].ParentID != spans[1].SpanID {
+		t.Errorf("child is not linked to parent: %+v", spans[0])
+	}
+	if spans[0].Attributes["key"] != "value" || spans[0].Err != "failed" {
+		t.Errorf("unexpected child attributes %v and error %q", spans[0].Attributes, spans[0].Err)
+	}
+	if Traceparent(ctx) != parent.Context().Traceparent() {
+		t.Errorf("expected traceparent of the parent span, got %s", Traceparent(ctx))
+	}
+
+	// Spans of unsampled traces are propagated but not exported
+	exporter.Reset()
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := Start(ContextWithRemoteParent(context.Background(), unsampled), "unsampled")
+	span.End()
+	if len(exporter.Spans()) != 0 || Traceparent(ctx)[53:] != "00" {
+		t.Errorf("unsampled span was exported or its flags changed: %s", Traceparent(ctx))
+	}
+}
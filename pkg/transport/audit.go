@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/audit"
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"net/http"
+	"time"
+)
+
+type AuditRequest struct {
+	Since time.Time
+	Actor string
+}
+
+type AuditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+// Serve GET /audit from the given log, admins only
+func WithAuditLog(log *audit.Log) Option {
+	return func(o *httpOptions) {
+		o.auditLog = log
+	}
+}
+
+func makeAuditEndpoint(log *audit.Log) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		req := request.(AuditRequest)
+		entries, err := log.Query(req.Since, req.Actor)
+		if err != nil {
+			return nil, err
+		}
+		return AuditResponse{Entries: entries}, nil
+	}
+}
+
+func decodeAuditRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request AuditRequest
+	query := r.URL.Query()
+	if since := query.Get("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, newParameterError(codeInvalidParameter, "since", `since must be an RFC 3339 timestamp`)
+		}
+		request.Since = parsed
+	}
+	request.Actor = query.Get("actor")
+	return request, nil
+}
+
+// Record address of the caller for the audit log. Proxies are not trusted, so it is the address of the peer
+func httpSource(ctx context.Context, r *http.Request) context.Context {
+	return audit.NewSourceContext(ctx, hostOf(r.RemoteAddr))
+}
+
+func grpcSource(ctx context.Context, _ metadata.MD) context.Context {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return audit.NewSourceContext(ctx, hostOf(p.Addr.String()))
+	}
+	return ctx
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
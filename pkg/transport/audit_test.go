@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"corporate-directory/pkg/audit"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"), 0)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	defer auditLog.Close()
+
+	var svc service.CorporateDirectory = service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	svc = audit.Middleware(auditLog, log.NewNopLogger())(svc)
+	handler := SetupHttpTransport(svc, config.Default(), WithAuditLog(auditLog),
+		WithMiddlewares(AuthMiddleware(testAuthenticator()))).Handler
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	do := func(method, path, key, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set(apiKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+	do("POST", "/setup", "admin-key", `{"employees": [{"id": 1, "name": "Claire"}]}`).Body.Close()
+	do("POST", "/setup", "admin-key", `{"employees": [{"id": 1, "name": "Alice"}]}`).Body.Close()
+
+	resp := do("GET", "/audit?actor=hr-sync&since=2000-01-01T00:00:00Z", "admin-key", "")
+	var res AuditResponse
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(res.Entries) != 2 {
+		t.Fatalf("unexpected response %d %+v", resp.StatusCode, res)
+	}
+	first, second := res.Entries[0], res.Entries[1]
+	if first.Outcome != audit.OutcomeSuccess || first.Source != "127.0.0.1" || first.RequestId == "" {
+		t.Errorf("unexpected entry %+v", first)
+	}
+	if second.Outcome != audit.OutcomeFailure || second.Error != service.ErrBossNotFound.Error() {
+		t.Errorf("unexpected entry %+v", second)
+	}
+
+	for _, test := range []struct {
+		path   string
+		key    string
+		status int
+	}{
+		{"/audit?actor=nobody", "admin-key", http.StatusOK},
+		{"/audit?since=yesterday", "admin-key", http.StatusBadRequest},
+		{"/audit", "reader-key", http.StatusForbidden},
+	} {
+		resp := do("GET", test.path, test.key, "")
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+	}
+
+	// Without audit log there is no route
+	plain := httptest.NewServer(SetupHttpTransport(svc, config.Default()).Handler)
+	defer plain.Close()
+	if resp, err := http.Get(plain.URL + "/audit"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 without audit log, got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strings"
+)
+
+// Header for API keys, which may also be sent as bearer tokens
+const apiKeyHeader = "X-API-Key"
+
+// Endpoints only reading the directory, any other endpoint requires the admin role. New endpoints are thus closed to
+// readers until they are listed here
+var readerMethods = map[string]bool{
+	"common_manager":               true,
+	"common_manager_batch":         true,
+	"get_employee":                 true,
+	"get_employees":                true,
+	"graphql":                      true,
+	"events":                       true,
+	"scim_list_users":              true,
+	"scim_get_user":                true,
+	"scim_service_provider_config": true,
+}
+
+// AuthMiddleware authenticates credentials taken from the request and checks the caller's role is sufficient for
+// the endpoint. Identity of the caller is passed on in the context, see auth.FromContext
+func AuthMiddleware(authenticator auth.Authenticator) Middleware {
+	return func(method string, next endpoint.Endpoint) endpoint.Endpoint {
+		required := auth.RoleAdmin
+		if readerMethods[method] {
+			required = auth.RoleReader
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			credentials := auth.CredentialsFromContext(ctx)
+			if credentials == "" {
+				return nil, auth.ErrUnauthenticated
+			}
+			identity, err := authenticator.Authenticate(ctx, credentials)
+			if err != nil {
+				return nil, err
+			}
+			if !identity.Role.Includes(required) {
+				return nil, auth.ErrForbidden
+			}
+			return next(auth.NewContext(ctx, identity), request)
+		}
+	}
+}
+
+// Take credentials from Authorization bearer token or X-API-Key header
+func httpCredentials(ctx context.Context, r *http.Request) context.Context {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return auth.NewCredentialsContext(ctx, key)
+	}
+	return auth.NewCredentialsContext(ctx, bearerToken(r.Header.Get("Authorization")))
+}
+
+// Take credentials from authorization or x-api-key metadata, the same way as for HTTP
+func grpcCredentials(ctx context.Context, md metadata.MD) context.Context {
+	if values := md.Get(apiKeyHeader); len(values) > 0 {
+		return auth.NewCredentialsContext(ctx, values[0])
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		return auth.NewCredentialsContext(ctx, bearerToken(values[0]))
+	}
+	return ctx
+}
+
+func bearerToken(authorization string) string {
+	const prefix = "bearer "
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(prefix):])
+}
@@ -0,0 +1,218 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/audit"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/pb"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/webhook"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testAuthenticator() auth.Authenticator {
+	keys := make(auth.ApiKeys)
+	keys.Add("reader-key", auth.Identity{Subject: "org-chart-ui", Role: auth.RoleReader})
+	keys.Add("admin-key", auth.Identity{Subject: "hr-sync", Role: auth.RoleAdmin})
+	return keys
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	handler := SetupHttpTransport(svc, config.Default(), WithMiddlewares(AuthMiddleware(testAuthenticator()))).Handler
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	setupBody := `{"employees": [{"id": 1, "name": "Claire"}, {"id": 2, "name": "Alice", "manager_id": 1}]}`
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		header string
+		value  string
+		status int
+		code   string
+	}{
+		{"POST", "/setup", setupBody, "", "", http.StatusUnauthorized, codeUnauthenticated},
+		{"POST", "/setup", setupBody, "Authorization", "Bearer wrong-key", http.StatusUnauthorized, codeUnauthenticated},
+		{"POST", "/setup", setupBody, "X-API-Key", "reader-key", http.StatusForbidden, codeForbidden},
+		{"POST", "/setup", setupBody, "Authorization", "Bearer admin-key", http.StatusOK, ""},
+		{"GET", "/employees/2", "", "", "", http.StatusUnauthorized, codeUnauthenticated},
+		{"GET", "/employees/2", "", "Authorization", "bearer reader-key", http.StatusOK, ""},
+		{"DELETE", "/employees/2", "", "X-API-Key", "reader-key", http.StatusForbidden, codeForbidden},
+		{"DELETE", "/scim/v2/Users/2", "", "X-API-Key", "reader-key", http.StatusForbidden, ""},
+		{"GET", "/scim/v2/Users/2", "", "X-API-Key", "reader-key", http.StatusOK, ""},
+		{"DELETE", "/employees/2", "", "X-API-Key", "admin-key", http.StatusOK, ""},
+		// Probes stay open for orchestrators
+		{"GET", "/healthz", "", "", "", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var body ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s with %s: expected %d, got %d", test.method, test.path, test.value, test.status,
+				resp.StatusCode)
+		}
+		if test.code != "" && (body.Error == nil || body.Error.Code != test.code) {
+			t.Errorf("%s %s with %s: expected code %s, got %+v", test.method, test.path, test.value, test.code,
+				body.Error)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s %s: missing WWW-Authenticate header", test.method, test.path)
+		}
+	}
+}
+
+func TestAuthMiddlewareRoles(t *testing.T) {
+	// Every endpoint must be classified here, so adding one is a conscious decision about who may call it
+	expected := map[string]auth.Role{
+		"setup":                        auth.RoleAdmin,
+		"common_manager":               auth.RoleReader,
+		"common_manager_batch":         auth.RoleReader,
+		"get_employee":                 auth.RoleReader,
+		"get_employees":                auth.RoleReader,
+		"add_employee":                 auth.RoleAdmin,
+		"update_employee":              auth.RoleAdmin,
+		"remove_employee":              auth.RoleAdmin,
+		"graphql":                      auth.RoleReader,
+		"events":                       auth.RoleReader,
+		"audit":                        auth.RoleAdmin,
+		"create_webhook":               auth.RoleAdmin,
+		"list_webhooks":                auth.RoleAdmin,
+		"delete_webhook":               auth.RoleAdmin,
+		"webhook_dead_letters":         auth.RoleAdmin,
+		"scim_list_users":              auth.RoleReader,
+		"scim_get_user":                auth.RoleReader,
+		"scim_create_user":             auth.RoleAdmin,
+		"scim_replace_user":            auth.RoleAdmin,
+		"scim_patch_user":              auth.RoleAdmin,
+		"scim_delete_user":             auth.RoleAdmin,
+		"scim_service_provider_config": auth.RoleReader,
+	}
+
+	// Record names of all endpoints of both transports with every optional feature enabled
+	registered := make(map[string]bool)
+	record := func(method string, next endpoint.Endpoint) endpoint.Endpoint {
+		registered[method] = true
+		return next
+	}
+	tmp, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	auditLog, err := audit.Open(filepath.Join(tmp, "audit.log"), 0)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	defer auditLog.Close()
+	dispatcher, _ := webhook.NewDispatcher()
+	defer dispatcher.Close()
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	SetupHttpTransport(svc, config.Default(), WithMiddlewares(record), WithAuditLog(auditLog),
+		WithWebhooks(dispatcher), WithEventStream(events.NewStream(1)))
+	SetupGrpcTransport(svc, record)
+
+	authenticator := testAuthenticator()
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	for method := range registered {
+		role, ok := expected[method]
+		if !ok {
+			t.Errorf("endpoint %s is not classified", method)
+			continue
+		}
+		e := AuthMiddleware(authenticator)(method, next)
+		_, err := e(auth.NewCredentialsContext(context.Background(), "reader-key"), nil)
+		if role == auth.RoleAdmin && err != auth.ErrForbidden {
+			t.Errorf("endpoint %s must require admin, got %v", method, err)
+		}
+		if role == auth.RoleReader && err != nil {
+			t.Errorf("endpoint %s must be open to readers, got %v", method, err)
+		}
+	}
+	for method := range expected {
+		if !registered[method] {
+			t.Errorf("endpoint %s is not registered", method)
+		}
+	}
+
+	// Unknown endpoints are closed to readers
+	e := AuthMiddleware(authenticator)("unknown", next)
+	if _, err := e(auth.NewCredentialsContext(context.Background(), "reader-key"), nil); err != auth.ErrForbidden {
+		t.Errorf("unknown endpoint must require admin, got %v", err)
+	}
+}
+
+func TestAuthMiddlewareIdentity(t *testing.T) {
+	var identity auth.Identity
+	next := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		identity, _ = auth.FromContext(ctx)
+		return nil, nil
+	}
+	e := AuthMiddleware(testAuthenticator())("get_employee", next)
+	if _, err := e(auth.NewCredentialsContext(context.Background(), "reader-key"), nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if identity.Subject != "org-chart-ui" || identity.Role != auth.RoleReader {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+}
+
+func TestGrpcAuth(t *testing.T) {
+	client, closer := setupGrpcClient(t, AuthMiddleware(testAuthenticator()))
+	defer closer()
+	setup := &pb.SetupRequest{Employees: []*pb.Employee{{Id: 1, Name: "Claire"}}}
+
+	_, err := client.Setup(context.Background(), setup)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected unauthenticated, got %v", err)
+	}
+	reader := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer reader-key")
+	_, err = client.Setup(reader, setup)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+
+	// Streaming setup goes through the same endpoint
+	stream, err := client.SetupStream(reader)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	_ = stream.Send(&pb.Employee{Id: 1, Name: "Claire"})
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected permission denied for stream, got %v", err)
+	}
+
+	admin := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "admin-key")
+	if _, err := client.Setup(admin, setup); err != nil {
+		t.Errorf("setup failed: %v", err)
+	}
+	if _, err := client.GetEmployee(reader, &pb.GetEmployeeRequest{Id: 1}); err != nil {
+		t.Errorf("get failed: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+//
+// POST /common/batch answers many pairs in one round trip, all of them by the same version of the directory. Pairs
+// fail on their own, e.g. for unknown employees, with the same error object as GET /common would respond with.
+//
+
+type CommonManagerBatchRequest struct {
+	Pairs []service.EmployeePair
+}
+
+// Either the common manager or the error of one pair
+type CommonManagerBatchResult struct {
+	Common *service.Employee `json:"common,omitempty"`
+	Error  *ApiError         `json:"error,omitempty"`
+}
+
+type CommonManagerBatchResponse struct {
+	Results []CommonManagerBatchResult `json:"results"`
+}
+
+func makeCommonManagerBatchEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(CommonManagerBatchRequest)
+		res, err := svc.GetCommonManagers(ctx, req.Pairs)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]CommonManagerBatchResult, len(res))
+		for idx, result := range res {
+			if result.Err != nil {
+				results[idx].Error = toApiError(result.Err)
+				continue
+			}
+			results[idx].Common = result.Manager
+		}
+		return CommonManagerBatchResponse{Results: results}, nil
+	}
+}
+
+// Bytes of the body allowed per pair of a batch, plenty even for pretty-printed pairs
+const batchPairBytes = 256
+
+// Body is a JSON array of {"first": ..., "second": ...}, decoding stops as soon as it has more than maxSize pairs. The
+// body is read up to batchPairBytes per pair, so huge values or padding of a few pairs can't exhaust memory either
+func makeDecodeCommonManagerBatchRequest(maxSize int) httptransport.DecodeRequestFunc {
+	maxBytes := int64(maxSize) * batchPairBytes
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		request, err := decodeCommonManagerBatch(&limitedBody{r: r.Body, n: maxBytes}, maxSize)
+		if err == errBodyTooLarge {
+			return nil, newApiError(http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", maxBytes), nil)
+		}
+		return request, err
+	}
+}
+
+func decodeCommonManagerBatch(body io.Reader, maxSize int) (interface{}, error) {
+	var request CommonManagerBatchRequest
+	decoder := json.NewDecoder(body)
+	if err := expectDelim(decoder, '['); err == errBodyTooLarge {
+		return nil, err
+	} else if err != nil {
+		return nil, newApiError(http.StatusBadRequest, codeMalformedBody, "body must be an array of pairs: "+
+			err.Error(), nil)
+	}
+	for decoder.More() {
+		if len(request.Pairs) == maxSize {
+			return nil, newApiError(http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+				fmt.Sprintf("batch exceeds %d pairs", maxSize), map[string]string{"max": strconv.Itoa(maxSize)})
+		}
+		var pair service.EmployeePair
+		if err := decoder.Decode(&pair); err == errBodyTooLarge {
+			return nil, err
+		} else if err != nil {
+			return nil, newApiError(http.StatusBadRequest, codeMalformedBody,
+				fmt.Sprintf("pair %d: %v", len(request.Pairs)+1, err), nil)
+		}
+		request.Pairs = append(request.Pairs, pair)
+	}
+	if err := expectDelim(decoder, ']'); err == errBodyTooLarge {
+		return nil, err
+	} else if err != nil {
+		return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+	}
+	return request, nil
+}
@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCommonManagerBatch(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxBatchSize = 3
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	_ = svc.Setup(context.Background(), []*service.Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1)},
+		{ID: 3, Name: "Bob", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Carol", ManagerID: intPtr(2)},
+	})
+	server := httptest.NewServer(SetupHttpTransport(svc, cfg).Handler)
+	defer server.Close()
+
+	post := func(body string) (*http.Response, []byte) {
+		resp, err := http.Post(server.URL+"/common/batch", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var raw json.RawMessage
+		_ = json.NewDecoder(resp.Body).Decode(&raw)
+		return resp, raw
+	}
+
+	resp, body := post(`[{"first": 4, "second": 3}, {"first": 4, "second": 42}, {"first": 4, "second": 2}]`)
+	var response CommonManagerBatchResponse
+	_ = json.Unmarshal(body, &response)
+	if resp.StatusCode != http.StatusOK || len(response.Results) != 3 {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, body)
+	}
+	results := response.Results
+	if results[0].Common == nil || results[0].Common.ID != 1 || results[0].Error != nil ||
+		results[1].Common != nil || results[1].Error == nil || results[1].Error.Code != codeEmployeeNotFound ||
+		results[2].Common == nil || results[2].Common.ID != 2 {
+		t.Errorf("unexpected results %s", body)
+	}
+
+	for _, test := range []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`[]`, http.StatusOK, ""},
+		{`{"first": 1, "second": 2}`, http.StatusBadRequest, codeMalformedBody},
+		{`[{"first": "x"}]`, http.StatusBadRequest, codeMalformedBody},
+		{`[{"first": 1, "second": 2}`, http.StatusBadRequest, codeMalformedBody},
+		{"[" + strings.Repeat(`{"first": 1, "second": 2},`, 3) + `{"first": 1, "second": 2}]`,
+			http.StatusRequestEntityTooLarge, codeBatchTooLarge},
+		// A single pair can't be arbitrarily large either
+		{`[{"first": 1, "second": 2, "padding": "` + strings.Repeat("x", 3*batchPairBytes) + `"}]`,
+			http.StatusRequestEntityTooLarge, codeBodyTooLarge},
+	} {
+		resp, body := post(test.body)
+		var response ErrorResponse
+		_ = json.Unmarshal(body, &response)
+		if resp.StatusCode != test.status ||
+			(test.code != "" && (response.Error == nil || response.Error.Code != test.code)) {
+			t.Errorf("%s: expected %d %s, got %d %s", test.body, test.status, test.code, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/service"
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// Conditional requests. Responses of reads and writes carry the directory version in X-Directory-Version and as an
+// ETag, GET requests answer If-None-Match with 304 and writes given If-Match fail with 412 once the directory has
+// changed since. gRPC calls take If-Match from metadata and report the version in response metadata the same way.
+// Versions start over with every restart, so ETags also include a random epoch of the process. Negotiated responses
+// add their format and encoding to the ETag, so each representation has its own, while conditions only compare the
+// version.
+//
+
+const versionHeader = "X-Directory-Version"
+
+// Random per process, so ETags of a previous run never match
+var etagEpoch = requestid.New()
+
+// Request conditions and the version a response is based on, shared by the request's context and the endpoint
+type conditions struct {
+	ifNoneMatch string
+	ifMatch     string
+	// ETag of If-None-Match the response is not modified from
+	matched string
+	// Version the response is based on, valid only when known is set
+	version uint64
+	known   bool
+}
+
+type conditionsKey struct{}
+
+// Returned by reads instead of their response when the client's copy is up to date
+type notModifiedResponse struct{}
+
+func etag(version uint64) string {
+	return `"` + etagEpoch + "-" + strconv.FormatUint(version, 10) + `"`
+}
+
+// ETag of a representation of the response, e.g. "<epoch>-3-msgpack-gzip"
+func representationEtag(tag, format string, gzipped bool) string {
+	suffix := "-" + format
+	if gzipped {
+		suffix += "-gzip"
+	}
+	return strings.TrimSuffix(tag, `"`) + suffix + `"`
+}
+
+// Version of an ETag of this process, ok is false for any other value. Representations share the version
+func parseEtag(tag string) (version uint64, ok bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	prefix := `"` + etagEpoch + "-"
+	if !strings.HasPrefix(tag, prefix) || !strings.HasSuffix(tag, `"`) || len(tag) <= len(prefix) {
+		return 0, false
+	}
+	value := tag[len(prefix) : len(tag)-1]
+	if end := strings.IndexByte(value, '-'); end >= 0 {
+		value = value[:end]
+	}
+	version, err := strconv.ParseUint(value, 10, 64)
+	return version, err == nil
+}
+
+// Take conditions from the request, so endpoints wrapped by versionedRead or versionedWrite can evaluate them. Reads
+// sent with POST, e.g. batches, only report their version, as there is no cached response to revalidate
+func httpConditions(ctx context.Context, r *http.Request) context.Context {
+	c := &conditions{ifMatch: r.Header.Get("If-Match")}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		c.ifNoneMatch = r.Header.Get("If-None-Match")
+	}
+	return context.WithValue(ctx, conditionsKey{}, c)
+}
+
+// Take If-Match from metadata, gRPC responses are never cached, so If-None-Match is not supported
+func grpcConditions(ctx context.Context, md metadata.MD) context.Context {
+	c := &conditions{}
+	if values := md.Get("if-match"); len(values) > 0 {
+		c.ifMatch = values[0]
+	}
+	return context.WithValue(ctx, conditionsKey{}, c)
+}
+
+// Report the version of the response, unless it's unknown because the directory changed while it was being made.
+// Responses not modified repeat the ETag of the client's copy, writeResponse adds the representation to others.
+// Visibility policies redact responses per caller while the version is the same for all, so shared caches must not
+// store them
+func httpVersionHeaders(ctx context.Context, w http.ResponseWriter) context.Context {
+	w.Header().Set("Cache-Control", "private")
+	if c, ok := ctx.Value(conditionsKey{}).(*conditions); ok && c.known {
+		tag := etag(c.version)
+		if c.matched != "" {
+			tag = c.matched
+		}
+		w.Header().Set("ETag", tag)
+		w.Header().Set(versionHeader, strconv.FormatUint(c.version, 10))
+	}
+	return ctx
+}
+
+// Report the version in response metadata, like httpVersionHeaders does in HTTP headers
+func grpcVersionHeaders(ctx context.Context, header *metadata.MD, _ *metadata.MD) context.Context {
+	if c, ok := ctx.Value(conditionsKey{}).(*conditions); ok && c.known {
+		*header = metadata.Join(*header,
+			metadata.Pairs("etag", etag(c.version), versionHeader, strconv.FormatUint(c.version, 10)))
+	}
+	return ctx
+}
+
+// Reads answer If-None-Match and report the version they read. The version is read before and after the read, when
+// they differ the response is not attributed to either of them
+func versionedRead(svc service.CorporateDirectory, next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		c, ok := ctx.Value(conditionsKey{}).(*conditions)
+		if !ok {
+			return next(ctx, request)
+		}
+		before := svc.Version(ctx)
+		if c.ifNoneMatch != "" {
+			if tag, ok := matchesAny(c.ifNoneMatch, before); ok {
+				c.version, c.known, c.matched = before, true, tag
+				return notModifiedResponse{}, nil
+			}
+		}
+		res, err := next(ctx, request)
+		if err == nil && svc.Version(ctx) == before {
+			c.version, c.known = before, true
+		}
+		return res, err
+	}
+}
+
+// Writes given If-Match only succeed when the directory is still at that version and report the version they made.
+// It's read after the write, so it is only reported when it is the next one
+func versionedWrite(svc service.CorporateDirectory, next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		c, ok := ctx.Value(conditionsKey{}).(*conditions)
+		if !ok {
+			return next(ctx, request)
+		}
+		if c.ifMatch != "" && strings.TrimSpace(c.ifMatch) != "*" {
+			expected, ok := parseIfMatch(c.ifMatch)
+			if !ok {
+				return nil, service.ErrVersionMismatch
+			}
+			ctx = service.NewExpectedVersionContext(ctx, expected)
+		}
+		before := svc.Version(ctx)
+		res, err := next(ctx, request)
+		if after := svc.Version(ctx); err == nil && after == before+1 {
+			c.version, c.known = after, true
+		}
+		return res, err
+	}
+}
+
+// First ETag of If-None-Match of the version, empty for "*". Weak comparison is used as for GET
+func matchesAny(header string, version uint64) (string, bool) {
+	if strings.TrimSpace(header) == "*" {
+		return "", true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if parsed, ok := parseEtag(tag); ok && parsed == version {
+			return strings.TrimSpace(tag), true
+		}
+	}
+	return "", false
+}
+
+// Version of the first strong ETag of this process
+func parseIfMatch(header string) (uint64, bool) {
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if version, ok := parseEtag(tag); ok {
+			return version, true
+		}
+	}
+	return 0, false
+}
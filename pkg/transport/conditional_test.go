@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	do := func(method, path, header, value, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := do("GET", "/employees", "", "", "")
+	first := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || first == "" || resp.Header.Get(versionHeader) != "1" ||
+		resp.Header.Get("Cache-Control") != "private" {
+		t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+	update := `{"name": "Alice", "title": "CTO", "manager_id": 1}`
+
+	for _, test := range []struct {
+		method  string
+		path    string
+		header  string
+		value   string
+		body    string
+		status  int
+		version string
+	}{
+		{"GET", "/employees", "If-None-Match", first, "", http.StatusNotModified, "1"},
+		{"GET", "/employees/2", "If-None-Match", `"other", W/` + first, "", http.StatusNotModified, "1"},
+		{"GET", "/common?first=2&second=3", "If-None-Match", `"other"`, "", http.StatusOK, "1"},
+		// Batches are POSTed, so they report their version without revalidating
+		{"POST", "/common/batch", "If-None-Match", first, `[{"first": 2, "second": 3}]`, http.StatusOK, "1"},
+		// GraphQL resolvers may read different versions, so none is reported
+		{"GET", "/graphql?query=%7Bemployee(id:2)%7Bname%7D%7D", "If-None-Match", first, "", http.StatusOK, ""},
+		{"PUT", "/employees/2", "If-Match", first, update, http.StatusOK, "2"},
+		// Lost update of a client still at the first version
+		{"PUT", "/employees/2", "If-Match", first, update, http.StatusPreconditionFailed, ""},
+		{"DELETE", "/employees/4", "If-Match", `"previous-run-2"`, "", http.StatusPreconditionFailed, ""},
+		{"DELETE", "/employees/4", "If-Match", "*", "", http.StatusOK, "3"},
+		{"GET", "/employees", "If-None-Match", first, "", http.StatusOK, "3"},
+	} {
+		resp := do(test.method, test.path, test.header, test.value, test.body)
+		if resp.StatusCode != test.status || resp.Header.Get(versionHeader) != test.version {
+			t.Errorf("%s %s with %s %s: expected %d and version %q, got %d and %q", test.method, test.path,
+				test.header, test.value, test.status, test.version, resp.StatusCode, resp.Header.Get(versionHeader))
+		}
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/employees", nil)
+	req.Header.Set("If-None-Match", etag(3))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified || len(body) != 0 || resp.Header.Get("ETag") != etag(3) {
+		t.Errorf("unexpected response %d %v %s", resp.StatusCode, resp.Header, body)
+	}
+}
+
+func TestRepresentationEtags(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	get := func(accept, ifNoneMatch string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/employees", nil)
+		req.Header.Set("Accept", accept)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	jsonTag, msgpackTag := get(jsonContentType, "").Header.Get("ETag"), get(msgpackContentType, "").Header.Get("ETag")
+	if jsonTag == msgpackTag || !strings.HasSuffix(jsonTag, `-json"`) || !strings.HasSuffix(msgpackTag, `-msgpack"`) {
+		t.Errorf("expected an ETag per format, got %s and %s", jsonTag, msgpackTag)
+	}
+	if resp := get(msgpackContentType, msgpackTag); resp.StatusCode != http.StatusNotModified ||
+		resp.Header.Get("ETag") != msgpackTag {
+		t.Errorf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+	if tag := representationEtag(etag(1), "json", true); tag != `"`+etagEpoch+`-1-json-gzip"` {
+		t.Errorf("unexpected gzip ETag %s", tag)
+	}
+	if version, ok := parseEtag(representationEtag(etag(7), "protobuf", true)); !ok || version != 7 {
+		t.Errorf("expected version 7, got %d %v", version, ok)
+	}
+}
@@ -0,0 +1,141 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/webhook"
+	"encoding/json"
+	"net/http"
+)
+
+//
+// Error envelope shared by all JSON endpoints. Every error is reported with a proper HTTP status and a body of form
+// {"error": {"code": "...", "message": "...", "details": {...}}}, where code is stable and meant for machines.
+//
+
+// Machine readable error codes
+const (
+	codeMalformedBody     = "malformed_body"
+	codeBodyTooLarge      = "body_too_large"
+	codeUnknownEncoding   = "unsupported_encoding"
+	codeBatchTooLarge     = "batch_too_large"
+	codeMissingParameter  = "missing_parameter"
+	codeInvalidParameter  = "invalid_parameter"
+	codeEmployeeNotFound  = "employee_not_found"
+	codeInvalidEdge       = "invalid_edge"
+	codeDuplicateEmployee = "duplicate_employee"
+	codeBossNotFound      = "boss_not_found"
+	codeManagerConflict   = "manager_conflict"
+	codeRemoveBoss        = "remove_boss"
+	codeInvalidTree       = "invalid_tree"
+	codeRouteNotFound     = "route_not_found"
+	codeMethodNotAllowed  = "method_not_allowed"
+	codeNotReady          = "not_ready"
+	codeUnauthenticated   = "unauthenticated"
+	codeForbidden         = "forbidden"
+	codeVersionMismatch   = "version_mismatch"
+	codeWebhookNotFound   = "webhook_not_found"
+	codeInvalidWebhookUrl = "invalid_webhook_url"
+	codeUnknownEventType  = "unknown_event_type"
+	codeInternal          = "internal"
+)
+
+type ApiError struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error *ApiError `json:"error"`
+}
+
+func newApiError(status int, code, message string, details map[string]string) *ApiError {
+	return &ApiError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+}
+
+// Error for a missing or malformed request parameter, detected while decoding a request
+func newParameterError(code, parameter, message string) *ApiError {
+	return newApiError(http.StatusBadRequest, code, message, map[string]string{"parameter": parameter})
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+// Service, solver, auth and webhook errors with their HTTP statuses, validation failures of the submitted org are
+// reported as 422
+var knownErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrInvalidEmployee, http.StatusNotFound, codeEmployeeNotFound},
+	{service.ErrInvalidEdge, http.StatusUnprocessableEntity, codeInvalidEdge},
+	{service.ErrEmployeeExists, http.StatusUnprocessableEntity, codeDuplicateEmployee},
+	{service.ErrBossNotFound, http.StatusUnprocessableEntity, codeBossNotFound},
+	{service.ErrManagerConflict, http.StatusUnprocessableEntity, codeManagerConflict},
+	{service.ErrRemoveBoss, http.StatusUnprocessableEntity, codeRemoveBoss},
+	{service.ErrVersionMismatch, http.StatusPreconditionFailed, codeVersionMismatch},
+	{lca.ErrInvalidTree, http.StatusUnprocessableEntity, codeInvalidTree},
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, codeUnauthenticated},
+	{auth.ErrForbidden, http.StatusForbidden, codeForbidden},
+	{webhook.ErrSubscriptionNotFound, http.StatusNotFound, codeWebhookNotFound},
+	{webhook.ErrInvalidUrl, http.StatusBadRequest, codeInvalidWebhookUrl},
+	{webhook.ErrUnknownEvent, http.StatusBadRequest, codeUnknownEventType},
+}
+
+// Map service and solver errors into API errors
+func toApiError(err error) *ApiError {
+	if apiErr, ok := err.(*ApiError); ok {
+		return apiErr
+	}
+	for _, known := range knownErrors {
+		if err == known.err {
+			return newApiError(known.status, known.code, err.Error(), nil)
+		}
+	}
+	return newApiError(http.StatusInternalServerError, codeInternal, err.Error(), nil)
+}
+
+// FromApiError is the reverse of the mapping done by the server, so clients get the same service errors as returned
+// by the in-process service. Errors that don't originate from the service are returned as is.
+func FromApiError(apiErr *ApiError) error {
+	for _, known := range knownErrors {
+		if apiErr.Code == known.code {
+			return known.err
+		}
+	}
+	return apiErr
+}
+
+func writeApiError(w http.ResponseWriter, apiErr *ApiError) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if apiErr.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.WriteHeader(apiErr.Status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: apiErr})
+}
+
+// ServerErrorEncoder for all endpoints, covers decoding errors as well as errors returned by the service
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	writeApiError(w, toApiError(err))
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeApiError(w, newApiError(http.StatusNotFound, codeRouteNotFound, "no route for "+r.URL.Path, nil))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeApiError(w, newApiError(http.StatusMethodNotAllowed, codeMethodNotAllowed,
+		r.Method+" is not allowed for "+r.URL.Path, nil))
+}
@@ -0,0 +1,224 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/policy"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//
+// Server-Sent Events stream of directory changes. The stream starts with a version event carrying the current
+// directory version, or a reset event when the client resumes from an event that is no longer buffered and has to
+// reload the directory. Change events follow with their ID, so browsers resume from the last one they saw by
+// sending Last-Event-ID on reconnect.
+//
+
+// Interval of comments keeping idle streams open through proxies
+const heartbeatInterval = 15 * time.Second
+
+type EventsRequest struct {
+	// Only events of employees in the subtree of this employee, nil for all
+	Root        *int
+	LastEventId string
+}
+
+type eventStream struct {
+	subscription *events.Subscription
+	resumed      bool
+	version      uint64
+	root         *int
+	// Clears fields of streamed employees the caller may not see, nil when all fields are public
+	redact func(*service.Employee)
+}
+
+// Serve GET /events from the given stream, which has to receive events of svc
+func WithEventStream(stream *events.Stream) Option {
+	return func(o *httpOptions) {
+		o.eventStream = stream
+	}
+}
+
+// Redact employees which don't come from the service itself, e.g. in streamed events, the same way as the service
+// does with policy.Middleware
+func WithVisibilityPolicy(p *policy.Policy) Option {
+	return func(o *httpOptions) {
+		o.visibility = p
+	}
+}
+
+func makeEventsEndpoint(svc service.CorporateDirectory, stream *events.Stream, p *policy.Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(EventsRequest)
+		if req.Root != nil {
+			if _, err := svc.GetEmployee(ctx, *req.Root); err != nil {
+				return nil, err
+			}
+		}
+		// Subscribing before reading the version, so no change falls in between
+		subscription, resumed := stream.Subscribe(req.LastEventId)
+		res := &eventStream{subscription: subscription, resumed: resumed, version: svc.Version(ctx), root: req.Root}
+		if p != nil {
+			res.redact = func(employee *service.Employee) {
+				p.Redact(ctx, svc, employee)
+			}
+		}
+		return res, nil
+	}
+}
+
+// Connections of the server by remote address, tracked by its ConnState hook. Handlers have no access to their
+// connection otherwise, which event streams need to move its write deadline
+type connections struct {
+	conns sync.Map
+}
+
+func (c *connections) track(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		c.conns.Store(conn.RemoteAddr().String(), conn)
+	case http.StateHijacked, http.StateClosed:
+		c.conns.Delete(conn.RemoteAddr().String())
+	}
+}
+
+// Give the handler a response writer able to set the write deadline of its connection
+func (c *connections) withWriteDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := c.conns.Load(r.RemoteAddr); ok {
+			w = &deadlineWriter{ResponseWriter: w, conn: conn.(net.Conn)}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(deadline time.Time) error
+}
+
+// Response writer of a connection tracked by connections
+type deadlineWriter struct {
+	http.ResponseWriter
+	conn net.Conn
+}
+
+func (w *deadlineWriter) SetWriteDeadline(deadline time.Time) error {
+	return w.conn.SetWriteDeadline(deadline)
+}
+
+// Flush keeps streaming responses working through the writer
+func (w *deadlineWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func decodeEventsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	request := EventsRequest{LastEventId: r.Header.Get("Last-Event-ID")}
+	if root := r.URL.Query().Get("root"); root != "" {
+		id, err := strconv.Atoi(root)
+		if err != nil {
+			return nil, newParameterError(codeInvalidParameter, "root", `root must be an integer`)
+		}
+		request.Root = &id
+	}
+	return request, nil
+}
+
+// Write events until the client goes away or the subscription ends. The server's write timeout would cut the stream
+// soon after it started, so instead every write gets writeTimeout of its own, which still drops stalled clients.
+// Zero means no limit
+func makeEncodeEventStream(writeTimeout time.Duration) httptransport.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		stream := response.(*eventStream)
+		defer stream.subscription.Close()
+		extendDeadline := func() {
+			// Writers not supporting deadlines have no server timeout to escape either
+			deadliner, ok := w.(writeDeadliner)
+			if !ok {
+				return
+			}
+			var deadline time.Time
+			if writeTimeout > 0 {
+				deadline = time.Now().Add(writeTimeout)
+			}
+			_ = deadliner.SetWriteDeadline(deadline)
+		}
+		extendDeadline()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Disables response buffering of nginx
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flush := func() {
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+
+		start := "version"
+		if !stream.resumed {
+			start = "reset"
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: {\"version\":%d}\n\n", start, stream.version); err != nil {
+			return nil
+		}
+		for _, event := range stream.subscription.Missed {
+			if err := stream.write(w, event); err != nil {
+				return nil
+			}
+		}
+		flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			var err error
+			select {
+			case event, ok := <-stream.subscription.Events:
+				if !ok {
+					return nil
+				}
+				extendDeadline()
+				err = stream.write(w, event)
+			case <-heartbeat.C:
+				extendDeadline()
+				_, err = io.WriteString(w, ": heartbeat\n\n")
+			case <-ctx.Done():
+				return nil
+			}
+			if err != nil {
+				return nil
+			}
+			flush()
+		}
+	}
+}
+
+// Write event in SSE format, unless it's outside of the watched subtree
+func (stream *eventStream) write(w io.Writer, event events.Event) error {
+	if stream.root != nil && !event.InSubtree(*stream.root) {
+		return nil
+	}
+	if event.Employee != nil && stream.redact != nil {
+		// Events are shared by all subscribers
+		event.Employee = event.Employee.Clone()
+		stream.redact(event.Employee)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
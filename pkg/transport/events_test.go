@@ -0,0 +1,152 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/policy"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func openEventStream(t *testing.T, url, lastEventId string) (*bufio.Reader, func()) {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set(apiKeyHeader, "reader-key")
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body), func() { resp.Body.Close() }
+}
+
+func readSseEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	var res sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return res
+		case strings.HasPrefix(line, "id: "):
+			res.id = line[len("id: "):]
+		case strings.HasPrefix(line, "event: "):
+			res.event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			res.data = line[len("data: "):]
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	visibility, _ := policy.New(map[string][]policy.Audience{"phone": {policy.Self}})
+	stream := events.NewStream(10)
+	var svc service.CorporateDirectory = service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	svc = events.Middleware(stream)(svc)
+	svc = policy.Middleware(visibility)(svc)
+	ctx := context.Background()
+	_ = svc.Setup(ctx, []*service.Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1)},
+		{ID: 3, Name: "Bob", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Carol", ManagerID: intPtr(2)},
+	})
+	handler := SetupHttpTransport(svc, config.Default(), WithEventStream(stream), WithVisibilityPolicy(visibility),
+		WithMiddlewares(AuthMiddleware(testAuthenticator()))).Handler
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	reader, closeStream := openEventStream(t, server.URL+"/events?root=2", "")
+	if event := readSseEvent(t, reader); event.event != "version" || event.data != `{"version":1}` {
+		t.Fatalf("unexpected first event %+v", event)
+	}
+	// Bob is outside of the watched subtree, Carol's phone is only visible to herself
+	_, _ = svc.UpdateEmployee(ctx, &service.Employee{ID: 3, Name: "Bob", ManagerID: intPtr(1), Phone: "555-0003"})
+	_, _ = svc.UpdateEmployee(ctx, &service.Employee{ID: 4, Name: "Carol", ManagerID: intPtr(2), Phone: "555-0004"})
+	first := readSseEvent(t, reader)
+	var event events.Event
+	_ = json.Unmarshal([]byte(first.data), &event)
+	if first.event != string(events.EmployeeUpdated) || first.id != event.ID || event.Employee.ID != 4 ||
+		event.Employee.Phone != "" || event.Version != 3 {
+		t.Fatalf("unexpected event %+v", first)
+	}
+	closeStream()
+
+	// Changes made while disconnected are replayed on resume
+	_ = svc.RemoveEmployee(ctx, 4)
+	reader, closeStream = openEventStream(t, server.URL+"/events", first.id)
+	if start := readSseEvent(t, reader); start.event != "version" || start.data != `{"version":4}` {
+		t.Errorf("unexpected first event %+v", start)
+	}
+	if missed := readSseEvent(t, reader); missed.event != string(events.EmployeeRemoved) {
+		t.Errorf("unexpected missed event %+v", missed)
+	}
+	closeStream()
+
+	reader, closeStream = openEventStream(t, server.URL+"/events", "unknown")
+	if start := readSseEvent(t, reader); start.event != "reset" {
+		t.Errorf("expected reset, got %+v", start)
+	}
+	closeStream()
+
+	for _, path := range []string{"/events?root=42", "/events?root=x"} {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Header.Set(apiKeyHeader, "reader-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
+
+func TestEventStreamOutlivesWriteTimeout(t *testing.T) {
+	stream := events.NewStream(10)
+	var svc service.CorporateDirectory = service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	svc = events.Middleware(stream)(svc)
+	ctx := context.Background()
+	_ = svc.Setup(ctx, []*service.Employee{{ID: 1, Name: "Claire"}})
+
+	cfg := config.Default()
+	cfg.WriteTimeout = 100 * time.Millisecond
+	httpServer := SetupHttpTransport(svc, cfg, WithEventStream(stream))
+	server := httptest.NewUnstartedServer(httpServer.Handler)
+	server.Config = httpServer
+	server.Start()
+	defer server.Close()
+
+	reader, closeStream := openEventStream(t, server.URL+"/events", "")
+	defer closeStream()
+	if event := readSseEvent(t, reader); event.event != "version" {
+		t.Fatalf("unexpected first event %+v", event)
+	}
+	time.Sleep(3 * cfg.WriteTimeout)
+	_, _ = svc.AddEmployee(ctx, &service.Employee{ID: 2, Name: "Alice", ManagerID: intPtr(1)})
+	if event := readSseEvent(t, reader); event.event != string(events.EmployeeAdded) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
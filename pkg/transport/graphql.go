@@ -0,0 +1,445 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// GraphQL endpoint for hierarchical queries. Every field is resolved through CorporateDirectory, queries are limited
+// in depth and in complexity before they are executed. List fields return at most as many employees as their
+// required first argument asks for, so complexity is an upper bound of resolved fields rather than an estimate.
+//
+
+const (
+	// Maximum nesting of fields, introspection fields are not counted
+	graphqlMaxDepth = 10
+	// Maximum number of resolved fields
+	graphqlMaxComplexity = 5000
+)
+
+// Fields returning lists, their selections are multiplied by the first argument
+var graphqlListFields = map[string]bool{
+	"employees": true,
+	"reports":   true,
+	"peers":     true,
+	"chain":     true,
+}
+
+// Argument of list fields limiting the number of returned employees
+var graphqlFirstArgument = graphql.FieldConfigArgument{
+	"first": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "Maximum number of employees returned",
+	},
+}
+
+// Value of the first argument, validation makes sure it is present
+func graphqlFirst(p graphql.ResolveParams) (int, error) {
+	first := p.Args["first"].(int)
+	if first < 0 {
+		return 0, fmt.Errorf("first must not be negative")
+	}
+	return first, nil
+}
+
+// Keep at most first IDs
+func limitIds(ids []int, first int) []int {
+	if len(ids) > first {
+		return ids[:first]
+	}
+	return ids
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Result of a query, requests rejected before execution are reported with 400
+type graphqlResponse struct {
+	*graphql.Result
+	status int
+}
+
+func (r graphqlResponse) StatusCode() int {
+	return r.status
+}
+
+func newGraphqlSchema(svc service.CorporateDirectory) (graphql.Schema, error) {
+	getEmployee := func(ctx context.Context, id int) (interface{}, error) {
+		employee, err := svc.GetEmployee(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return employee, nil
+	}
+	getEmployees := func(ctx context.Context, ids []int) (interface{}, error) {
+		employees := make([]*service.Employee, 0, len(ids))
+		for _, id := range ids {
+			employee, err := svc.GetEmployee(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			employees = append(employees, employee)
+		}
+		return employees, nil
+	}
+
+	var employeeType *graphql.Object
+	employeeType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Employee",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.Int),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*service.Employee).ID, nil
+					},
+				},
+				"name": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*service.Employee).Name, nil
+					},
+				},
+				"title": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*service.Employee).Title, nil
+					},
+				},
+				"mail": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*service.Employee).Mail, nil
+					},
+				},
+				"phone": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*service.Employee).Phone, nil
+					},
+				},
+				"location": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*service.Employee).Location, nil
+					},
+				},
+				"manager": &graphql.Field{
+					Type:        employeeType,
+					Description: "Direct manager, null for Claire",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						employee := p.Source.(*service.Employee)
+						if employee.ManagerID == nil {
+							return nil, nil
+						}
+						return getEmployee(p.Context, *employee.ManagerID)
+					},
+				},
+				"reports": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(employeeType))),
+					Description: "Direct reports",
+					Args:        graphqlFirstArgument,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						first, err := graphqlFirst(p)
+						if err != nil {
+							return nil, err
+						}
+						return getEmployees(p.Context, limitIds(p.Source.(*service.Employee).Subordinates, first))
+					},
+				},
+				"peers": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(employeeType))),
+					Description: "Other direct reports of the same manager",
+					Args:        graphqlFirstArgument,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						first, err := graphqlFirst(p)
+						if err != nil {
+							return nil, err
+						}
+						employee := p.Source.(*service.Employee)
+						if employee.ManagerID == nil {
+							return []*service.Employee{}, nil
+						}
+						manager, err := svc.GetEmployee(p.Context, *employee.ManagerID)
+						if err != nil {
+							return nil, err
+						}
+						ids := make([]int, 0, len(manager.Subordinates))
+						for _, id := range manager.Subordinates {
+							if id != employee.ID {
+								ids = append(ids, id)
+							}
+						}
+						return getEmployees(p.Context, limitIds(ids, first))
+					},
+				},
+				"chain": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(employeeType))),
+					Description: "Management chain from the direct manager up to Claire",
+					Args:        graphqlFirstArgument,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						first, err := graphqlFirst(p)
+						if err != nil {
+							return nil, err
+						}
+						chain := []*service.Employee{}
+						employee := p.Source.(*service.Employee)
+						for employee.ManagerID != nil && len(chain) < first {
+							manager, err := svc.GetEmployee(p.Context, *employee.ManagerID)
+							if err != nil {
+								return nil, err
+							}
+							chain = append(chain, manager)
+							employee = manager
+						}
+						return chain, nil
+					},
+				},
+				"commonManager": &graphql.Field{
+					Type:        employeeType,
+					Description: "Closest common manager with another employee",
+					Args: graphql.FieldConfigArgument{
+						"with": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return svc.GetCommonManager(p.Context, p.Source.(*service.Employee).ID, p.Args["with"].(int))
+					},
+				},
+			}
+		}),
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"employee": &graphql.Field{
+				Type: employeeType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getEmployee(p.Context, p.Args["id"].(int))
+				},
+			},
+			"employees": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(employeeType))),
+				Args: graphqlFirstArgument,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					first, err := graphqlFirst(p)
+					if err != nil {
+						return nil, err
+					}
+					if first == 0 {
+						return []*service.Employee{}, nil
+					}
+					page, err := svc.ListEmployees(p.Context, service.EmployeeQuery{Limit: first})
+					if err != nil {
+						return nil, err
+					}
+					return page.Employees, nil
+				},
+			},
+			"commonManager": &graphql.Field{
+				Type: employeeType,
+				Args: graphql.FieldConfigArgument{
+					"first":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"second": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return svc.GetCommonManager(p.Context, p.Args["first"].(int), p.Args["second"].(int))
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// Fragments and variables of the operation being measured
+type graphqlMeasure struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// Walk selections measuring depth and complexity of the query. Fragment cycles are rejected by validation before.
+// Complexity saturates at the limit, so huge first arguments can't overflow it
+func (m *graphqlMeasure) selections(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var childDepth, childComplexity int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			childDepth, childComplexity = m.selections(selection.SelectionSet)
+			if graphqlListFields[selection.Name.Value] {
+				childComplexity = saturatedMul(childComplexity+1, m.first(selection))
+			}
+			childDepth++
+			childComplexity++
+		case *ast.InlineFragment:
+			childDepth, childComplexity = m.selections(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := m.fragments[selection.Name.Value]; ok {
+				childDepth, childComplexity = m.selections(fragment.SelectionSet)
+			}
+		}
+		if childDepth > depth {
+			depth = childDepth
+		}
+		complexity = saturatedMul(1, complexity+childComplexity)
+	}
+	return depth, complexity
+}
+
+// Value of the first argument of a list field, taken from variables if needed. Values unknown before execution
+// are counted as the limit itself
+func (m *graphqlMeasure) first(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		value := argument.Value.GetValue()
+		if variable, ok := argument.Value.(*ast.Variable); ok {
+			value = m.variables[variable.Name.Value]
+		}
+		switch value := value.(type) {
+		case string:
+			// Literals keep their source text
+			if first, err := strconv.Atoi(value); err == nil {
+				return first
+			}
+		case float64:
+			return int(value)
+		case int:
+			return value
+		}
+	}
+	return graphqlMaxComplexity + 1
+}
+
+// Product of non negative a and b capped just above the complexity limit
+func saturatedMul(a, b int) int {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if a > (graphqlMaxComplexity+1)/b {
+		return graphqlMaxComplexity + 1
+	}
+	return a * b
+}
+
+// Variables of the operation with their default values
+func graphqlVariables(operation *ast.OperationDefinition, variables map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(operation.VariableDefinitions))
+	for _, definition := range operation.VariableDefinitions {
+		if definition.DefaultValue != nil {
+			res[definition.Variable.Name.Value] = definition.DefaultValue.GetValue()
+		}
+	}
+	for name, value := range variables {
+		res[name] = value
+	}
+	return res
+}
+
+func checkGraphqlLimits(document *ast.Document, variables map[string]interface{}) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		measure := &graphqlMeasure{fragments: fragments, variables: graphqlVariables(operation, variables)}
+		depth, complexity := measure.selections(operation.SelectionSet)
+		if depth > graphqlMaxDepth {
+			return fmt.Errorf("query depth %d exceeds maximum of %d", depth, graphqlMaxDepth)
+		}
+		if complexity > graphqlMaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds maximum of %d", complexity, graphqlMaxComplexity)
+		}
+	}
+	return nil
+}
+
+func makeGraphqlEndpoint(schema graphql.Schema) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(graphqlRequest)
+		rejected := func(errs ...error) (interface{}, error) {
+			result := &graphql.Result{Errors: gqlerrors.FormatErrors(errs...)}
+			return graphqlResponse{Result: result, status: http.StatusBadRequest}, nil
+		}
+
+		document, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			return rejected(err)
+		}
+		validation := graphql.ValidateDocument(&schema, document, graphql.SpecifiedRules)
+		if !validation.IsValid {
+			result := &graphql.Result{Errors: validation.Errors}
+			return graphqlResponse{Result: result, status: http.StatusBadRequest}, nil
+		}
+		if err := checkGraphqlLimits(document, req.Variables); err != nil {
+			return rejected(err)
+		}
+
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           document,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       ctx,
+		})
+		return graphqlResponse{Result: result, status: http.StatusOK}, nil
+	}
+}
+
+// Queries are accepted both as GET with query parameters and as POST with JSON body
+func decodeGraphqlRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request graphqlRequest
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		request.Query = query.Get("query")
+		request.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return nil, newParameterError(codeInvalidParameter, "variables", `variables must be a JSON object`)
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+	}
+	if request.Query == "" {
+		return nil, newParameterError(codeMissingParameter, "query", `'query' is missing`)
+	}
+	return request, nil
+}
+
+func encodeGraphqlResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(graphqlResponse)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(res.status)
+	return json.NewEncoder(w).Encode(res.Result)
+}
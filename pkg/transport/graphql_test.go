@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type graphqlTestResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func doGraphqlRequest(t *testing.T, url, query string, variables map[string]interface{}) (int, graphqlTestResponse) {
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	resp, err := http.Post(url+"/graphql", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var result graphqlTestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestGraphqlHierarchy(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	query := `query($id: Int!) {
+		employee(id: $id) {
+			name
+			manager { name peers: reports(first: 10) { id } }
+			peers(first: 10) { name }
+			chain(first: 10) { id }
+			commonManager(with: 3) { name }
+		}
+	}`
+	code, result := doGraphqlRequest(t, server.URL, query, map[string]interface{}{"id": 4})
+	if code != http.StatusOK || len(result.Errors) != 0 {
+		t.Fatalf("query failed with %d: %+v", code, result.Errors)
+	}
+
+	data, _ := json.Marshal(result.Data)
+	expected := `{"employee":{"chain":[{"id":2},{"id":1}],"commonManager":{"name":"Claire"},"manager":{"name":"Alice",` +
+		`"peers":[{"id":4}]},"name":"Carol","peers":[]}}`
+	if string(data) != expected {
+		t.Errorf("unexpected result %s", data)
+	}
+}
+
+func TestGraphqlErrors(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	code, result := doGraphqlRequest(t, server.URL, `{ employee(id: 10) { name } }`, nil)
+	if code != http.StatusOK || len(result.Errors) != 1 || result.Data["employee"] != nil {
+		t.Errorf("unexpected result %d %+v", code, result)
+	}
+
+	code, result = doGraphqlRequest(t, server.URL, `{ employee(id: 1) { salary } }`, nil)
+	if code != http.StatusBadRequest || len(result.Errors) == 0 {
+		t.Errorf("invalid query was not rejected: %d %+v", code, result)
+	}
+
+	deep := `{ employee(id: 1) { ` + strings.Repeat("manager { ", 10) + "id" + strings.Repeat(" }", 10) + " } }"
+	code, result = doGraphqlRequest(t, server.URL, deep, nil)
+	if code != http.StatusBadRequest || len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, "depth") {
+		t.Errorf("deep query was not rejected: %d %+v", code, result)
+	}
+
+	complex := `fragment r on Employee { reports(first: 10) { reports(first: 10) { reports(first: 10) { id } } } }
+		{ employees(first: 10) { ...r peers(first: 10) { ...r } } }`
+	code, result = doGraphqlRequest(t, server.URL, complex, nil)
+	if code != http.StatusBadRequest || len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, "complexity") {
+		t.Errorf("complex query was not rejected: %d %+v", code, result)
+	}
+
+	// Lists must be bounded by the client
+	code, result = doGraphqlRequest(t, server.URL, `{ employees { chain(first: 1) { name } } }`, nil)
+	if code != http.StatusBadRequest || len(result.Errors) == 0 {
+		t.Errorf("unbounded list was not rejected: %d %+v", code, result)
+	}
+}
+
+func TestGraphqlComplexityUsesFirst(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	// Whole org times the whole chain, 1 + 1000 * (1 + 1 + 100 * 2) fields
+	query := `query($n: Int!) { employees(first: $n) { name chain(first: 100) { name } } }`
+	code, result := doGraphqlRequest(t, server.URL, query, map[string]interface{}{"n": 1000})
+	if code != http.StatusBadRequest || len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, "complexity") {
+		t.Errorf("complex query was not rejected: %d %+v", code, result)
+	}
+	query = `query($n: Int! = 1000000) { employees(first: $n) { id } }`
+	if code, result = doGraphqlRequest(t, server.URL, query, nil); code != http.StatusBadRequest {
+		t.Errorf("default variable was not taken into account: %d %+v", code, result)
+	}
+
+	// Lists are cut at first
+	code, result = doGraphqlRequest(t, server.URL, `{ employees(first: 2) { id chain(first: 1) { id } } }`, nil)
+	if code != http.StatusOK || len(result.Errors) != 0 {
+		t.Fatalf("query failed with %d: %+v", code, result.Errors)
+	}
+	data, _ := json.Marshal(result.Data)
+	if expected := `{"employees":[{"chain":[],"id":1},{"chain":[{"id":1}],"id":2}]}`; string(data) != expected {
+		t.Errorf("unexpected result %s", data)
+	}
+}
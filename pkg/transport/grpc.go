@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/pb"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/service"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+)
+
+//
+// gRPC transport. Unary calls reuse the same endpoints as HTTP transport. go-kit doesn't support streaming, so
+// streaming calls collect or split messages and go through the handlers of their unary counterparts.
+//
+
+type grpcServer struct {
+	setup         grpctransport.Handler
+	commonManager grpctransport.Handler
+	getEmployee   grpctransport.Handler
+	getEmployees  grpctransport.Handler
+}
+
+func toPbEmployee(employee *service.Employee) *pb.Employee {
+	res := &pb.Employee{
+		Id:           int64(employee.ID),
+		Name:         employee.Name,
+		Subordinates: make([]int64, len(employee.Subordinates)),
+		Dn:           employee.DN,
+		Mail:         employee.Mail,
+		Title:        employee.Title,
+		Phone:        employee.Phone,
+		Location:     employee.Location,
+		Custom:       employee.Custom,
+	}
+	for i, child := range employee.Subordinates {
+		res.Subordinates[i] = int64(child)
+	}
+	if employee.ManagerID != nil {
+		res.Manager = &pb.Employee_ManagerId{ManagerId: int64(*employee.ManagerID)}
+	}
+	return res
+}
+
+func fromPbEmployee(employee *pb.Employee) *service.Employee {
+	res := &service.Employee{
+		ID:           int(employee.Id),
+		Name:         employee.Name,
+		Subordinates: make([]int, len(employee.Subordinates)),
+		DN:           employee.Dn,
+		Mail:         employee.Mail,
+		Title:        employee.Title,
+		Phone:        employee.Phone,
+		Location:     employee.Location,
+		Custom:       employee.Custom,
+	}
+	for i, child := range employee.Subordinates {
+		res.Subordinates[i] = int(child)
+	}
+	if manager, ok := employee.Manager.(*pb.Employee_ManagerId); ok {
+		managerId := int(manager.ManagerId)
+		res.ManagerID = &managerId
+	}
+	return res
+}
+
+func toPbEmployees(employees []*service.Employee) []*pb.Employee {
+	res := make([]*pb.Employee, len(employees))
+	for i, employee := range employees {
+		res[i] = toPbEmployee(employee)
+	}
+	return res
+}
+
+// Map errors to gRPC status codes the same way as HTTP statuses are chosen
+func toGrpcError(err error) error {
+	apiErr := toApiError(err)
+	code := codes.Internal
+	switch apiErr.Status {
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = codes.InvalidArgument
+	case http.StatusPreconditionFailed:
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, apiErr.Message)
+}
+
+// Take request ID from x-request-id metadata or generate a new one, like for HTTP requests
+func grpcRequestId(ctx context.Context, md metadata.MD) context.Context {
+	var id string
+	if values := md.Get(requestid.Header); len(values) > 0 {
+		id = values[0]
+	}
+	if !validRequestId(id) {
+		id = requestid.New()
+	}
+	return requestid.NewContext(ctx, id)
+}
+
+func decodeGrpcSetupRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.SetupRequest)
+	employees := make([]*service.Employee, len(req.Employees))
+	for i, employee := range req.Employees {
+		employees[i] = fromPbEmployee(employee)
+	}
+	return SetupRequest{Employees: employees}, nil
+}
+
+func encodeGrpcSetupResponse(_ context.Context, _ interface{}) (interface{}, error) {
+	return &pb.SetupResponse{}, nil
+}
+
+func decodeGrpcCommonManagerRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.GetCommonManagerRequest)
+	return CommonManagerRequest{First: int(req.First), Second: int(req.Second)}, nil
+}
+
+func encodeGrpcCommonManagerResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(CommonManagerResponse)
+	return &pb.GetCommonManagerResponse{Common: toPbEmployee(res.Common)}, nil
+}
+
+func decodeGrpcGetEmployeeRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.GetEmployeeRequest)
+	return GetEmployeeRequest{Id: int(req.Id)}, nil
+}
+
+func encodeGrpcGetEmployeeResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(GetEmployeeResponse)
+	return &pb.GetEmployeeResponse{Employee: toPbEmployee(res.Employee)}, nil
+}
+
+func decodeGrpcGetEmployeesRequest(_ context.Context, _ interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func encodeGrpcGetEmployeesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	res := response.(GetEmployeesResponse)
+	return &pb.GetEmployeesResponse{Employees: toPbEmployees(res.Employees)}, nil
+}
+
+func (s *grpcServer) Setup(ctx context.Context, req *pb.SetupRequest) (*pb.SetupResponse, error) {
+	_, res, err := s.setup.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, toGrpcError(err)
+	}
+	return res.(*pb.SetupResponse), nil
+}
+
+// Collect streamed employees and set them up at once when client closes the stream
+func (s *grpcServer) SetupStream(stream pb.CorporateDirectory_SetupStreamServer) error {
+	req := &pb.SetupRequest{}
+	for {
+		employee, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		req.Employees = append(req.Employees, employee)
+	}
+	_, res, err := s.setup.ServeGRPC(stream.Context(), req)
+	if err != nil {
+		return toGrpcError(err)
+	}
+	return stream.SendAndClose(res.(*pb.SetupResponse))
+}
+
+func (s *grpcServer) GetCommonManager(ctx context.Context, req *pb.GetCommonManagerRequest) (*pb.GetCommonManagerResponse, error) {
+	_, res, err := s.commonManager.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, toGrpcError(err)
+	}
+	return res.(*pb.GetCommonManagerResponse), nil
+}
+
+func (s *grpcServer) GetEmployee(ctx context.Context, req *pb.GetEmployeeRequest) (*pb.GetEmployeeResponse, error) {
+	_, res, err := s.getEmployee.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, toGrpcError(err)
+	}
+	return res.(*pb.GetEmployeeResponse), nil
+}
+
+func (s *grpcServer) GetEmployees(ctx context.Context, req *pb.GetEmployeesRequest) (*pb.GetEmployeesResponse, error) {
+	_, res, err := s.getEmployees.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, toGrpcError(err)
+	}
+	return res.(*pb.GetEmployeesResponse), nil
+}
+
+func (s *grpcServer) ListEmployees(_ *pb.ListEmployeesRequest, stream pb.CorporateDirectory_ListEmployeesServer) error {
+	_, res, err := s.getEmployees.ServeGRPC(stream.Context(), &pb.GetEmployeesRequest{})
+	if err != nil {
+		return toGrpcError(err)
+	}
+	for _, employee := range res.(*pb.GetEmployeesResponse).Employees {
+		if err := stream.Send(employee); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to set up all endpoints, encoders and gRPC server to serve requests. Middlewares are applied to all calls
+// the same way as to HTTP endpoints, streaming calls share the endpoints of their unary counterparts.
+func SetupGrpcTransport(svc service.CorporateDirectory, middlewares ...Middleware) *grpc.Server {
+	options := []grpctransport.ServerOption{
+		grpctransport.ServerBefore(grpcRequestId, grpcCredentials, grpcSource, grpcConditions),
+		grpctransport.ServerAfter(grpcVersionHeaders),
+	}
+	server := &grpcServer{
+		setup: newGrpcServer(chainMiddlewares("setup", versionedWrite(svc, makeSetupEndpoint(svc)), middlewares),
+			decodeGrpcSetupRequest, encodeGrpcSetupResponse, options...),
+		commonManager: newGrpcServer(
+			chainMiddlewares("common_manager", versionedRead(svc, makeCommonManagerEndpoint(svc)), middlewares),
+			decodeGrpcCommonManagerRequest, encodeGrpcCommonManagerResponse, options...),
+		getEmployee: newGrpcServer(
+			chainMiddlewares("get_employee", versionedRead(svc, makeGetEmployeeEndpoint(svc)), middlewares),
+			decodeGrpcGetEmployeeRequest, encodeGrpcGetEmployeeResponse, options...),
+		getEmployees: newGrpcServer(
+			chainMiddlewares("get_employees", versionedRead(svc, makeGetEmployeesEndpoint(svc)), middlewares),
+			decodeGrpcGetEmployeesRequest, encodeGrpcGetEmployeesResponse, options...),
+	}
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(grpcTracing))
+	pb.RegisterCorporateDirectoryServer(grpcServer, server)
+	return grpcServer
+}
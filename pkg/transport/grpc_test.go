@@ -0,0 +1,212 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/pb"
+	"corporate-directory/pkg/service"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"testing"
+)
+
+func setupGrpcClient(t *testing.T, middlewares ...Middleware) (pb.CorporateDirectoryClient, func()) {
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := SetupGrpcTransport(svc, middlewares...)
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	return pb.NewCorporateDirectoryClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestGrpcTransport(t *testing.T) {
+	client, closer := setupGrpcClient(t)
+	defer closer()
+	ctx := context.Background()
+
+	_, err := client.Setup(ctx, &pb.SetupRequest{Employees: []*pb.Employee{
+		{Id: 1, Name: "Claire", Subordinates: []int64{2, 3}},
+		{Id: 2, Name: "A"},
+		{Id: 3, Name: "B", Subordinates: []int64{4}},
+		{Id: 4, Name: "C"},
+	}})
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	common, err := client.GetCommonManager(ctx, &pb.GetCommonManagerRequest{First: 2, Second: 4})
+	if err != nil || common.Common.Id != 1 {
+		t.Errorf("unexpected common manager %v, error=%v", common, err)
+	}
+
+	employee, err := client.GetEmployee(ctx, &pb.GetEmployeeRequest{Id: 4})
+	if err != nil || employee.Employee.GetManagerId() != 3 {
+		t.Errorf("unexpected employee %v, error=%v", employee, err)
+	}
+
+	all, err := client.GetEmployees(ctx, &pb.GetEmployeesRequest{})
+	if err != nil || len(all.Employees) != 4 {
+		t.Errorf("unexpected employees %v, error=%v", all, err)
+	}
+
+	_, err = client.GetEmployee(ctx, &pb.GetEmployeeRequest{Id: 7})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	_, err = client.Setup(ctx, &pb.SetupRequest{Employees: []*pb.Employee{{Id: 1, Name: "A"}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestGrpcAttributesRoundTrip(t *testing.T) {
+	client, closer := setupGrpcClient(t)
+	defer closer()
+	ctx := context.Background()
+
+	claire := &pb.Employee{
+		Id:       1,
+		Name:     "Claire",
+		Dn:       "uid=claire,ou=people,dc=bureaucr,dc=at",
+		Mail:     "claire@bureaucr.at",
+		Title:    "CEO",
+		Phone:    "+1 555 0100",
+		Location: "Berlin",
+		Custom:   map[string]string{"cost_center": "C-1", "salary_band": "E9"},
+	}
+	if _, err := client.Setup(ctx, &pb.SetupRequest{Employees: []*pb.Employee{claire}}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	res, err := client.GetEmployee(ctx, &pb.GetEmployeeRequest{Id: 1})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	claire.Subordinates = []int64{}
+	if !proto.Equal(res.Employee, claire) {
+		t.Errorf("attributes were lost: %v", res.Employee)
+	}
+
+	// Streaming setup keeps them too
+	stream, err := client.SetupStream(ctx)
+	if err != nil {
+		t.Fatalf("setup stream failed: %v", err)
+	}
+	claire.Phone = "+1 555 0199"
+	if err := stream.Send(claire); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	all, err := client.GetEmployees(ctx, &pb.GetEmployeesRequest{})
+	if err != nil || len(all.Employees) != 1 || !proto.Equal(all.Employees[0], claire) {
+		t.Errorf("attributes were lost: %v, error=%v", all, err)
+	}
+}
+
+func TestGrpcConditionalSetup(t *testing.T) {
+	client, closer := setupGrpcClient(t)
+	defer closer()
+	ctx := context.Background()
+
+	employees := []*pb.Employee{{Id: 1, Name: "Claire", Subordinates: []int64{2}}, {Id: 2, Name: "A"}}
+	var header metadata.MD
+	if _, err := client.Setup(ctx, &pb.SetupRequest{Employees: employees}, grpc.Header(&header)); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	first := header.Get("etag")
+	if len(first) != 1 || first[0] != etag(1) {
+		t.Fatalf("unexpected metadata %v", header)
+	}
+
+	if _, err := client.GetEmployee(ctx, &pb.GetEmployeeRequest{Id: 2}, grpc.Header(&header)); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if version := header.Get("x-directory-version"); len(version) != 1 || version[0] != "1" {
+		t.Errorf("unexpected metadata %v", header)
+	}
+
+	withIfMatch := metadata.AppendToOutgoingContext(ctx, "if-match", first[0])
+	if _, err := client.Setup(withIfMatch, &pb.SetupRequest{Employees: employees}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	// Lost update of a client still at the first version, streamed or not
+	_, err := client.Setup(withIfMatch, &pb.SetupRequest{Employees: employees})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("unexpected error %v", err)
+	}
+	stream, err := client.SetupStream(withIfMatch)
+	if err != nil {
+		t.Fatalf("setup stream failed: %v", err)
+	}
+	for _, employee := range employees {
+		if err := stream.Send(employee); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestGrpcTransportStreaming(t *testing.T) {
+	client, closer := setupGrpcClient(t)
+	defer closer()
+	ctx := context.Background()
+
+	setup, err := client.SetupStream(ctx)
+	if err != nil {
+		t.Fatalf("setup stream failed: %v", err)
+	}
+	count := 1000
+	for i := 1; i <= count; i++ {
+		employee := &pb.Employee{Id: int64(i), Name: "A"}
+		if i == 1 {
+			employee.Name = "Claire"
+		} else {
+			employee.Manager = &pb.Employee_ManagerId{ManagerId: int64(i / 2)}
+		}
+		if err := setup.Send(employee); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	if _, err := setup.CloseAndRecv(); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	list, err := client.ListEmployees(ctx, &pb.ListEmployeesRequest{})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	received := 0
+	for {
+		_, err := list.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("receive failed: %v", err)
+		}
+		received++
+	}
+	if received != count {
+		t.Errorf("expected %d employees, received %d", count, received)
+	}
+}
@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/service"
+	"github.com/go-kit/kit/endpoint"
+	"net/http"
+)
+
+//
+// Probes for orchestrators. Liveness only tells that the process serves HTTP, readiness additionally requires an org
+// to be set up or restored, so traffic isn't routed to an instance that would answer every query with not found.
+//
+
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Version of the directory, only reported by readiness
+	Version uint64 `json:"version,omitempty"`
+}
+
+func makeHealthEndpoint() endpoint.Endpoint {
+	return func(_ context.Context, _ interface{}) (interface{}, error) {
+		return HealthResponse{Status: "ok"}, nil
+	}
+}
+
+func makeReadyEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		if !svc.Ready(ctx) {
+			return nil, newApiError(http.StatusServiceUnavailable, codeNotReady, "directory has not been set up yet", nil)
+		}
+		return HealthResponse{Status: "ready", Version: svc.Version(ctx)}, nil
+	}
+}
+
+func decodeHealthRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return nil, nil
+}
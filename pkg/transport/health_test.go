@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getStatus(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Status string    `json:"status"`
+		Error  *ApiError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("response is not json: %v", err)
+	}
+	if body.Error != nil {
+		return resp.StatusCode, body.Error.Code
+	}
+	return resp.StatusCode, body.Status
+}
+
+func TestHealthProbes(t *testing.T) {
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := httptest.NewServer(SetupHttpTransport(svc, config.Default()).Handler)
+	defer server.Close()
+
+	if code, status := getStatus(t, server.URL+"/healthz"); code != http.StatusOK || status != "ok" {
+		t.Errorf("unexpected liveness %d %s", code, status)
+	}
+	if code, status := getStatus(t, server.URL+"/readyz"); code != http.StatusServiceUnavailable || status != codeNotReady {
+		t.Errorf("expected not ready before setup, got %d %s", code, status)
+	}
+
+	// Failed setup doesn't make the directory ready
+	_ = svc.Setup(context.Background(), []*service.Employee{{ID: 1, Name: "Alice"}})
+	if code, _ := getStatus(t, server.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready after failed setup, got %d", code)
+	}
+
+	_ = svc.Setup(context.Background(), []*service.Employee{{ID: 1, Name: "Claire"}})
+	if code, status := getStatus(t, server.URL+"/readyz"); code != http.StatusOK || status != "ready" {
+		t.Errorf("expected ready after setup, got %d %s", code, status)
+	}
+}
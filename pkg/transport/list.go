@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/service"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// Paging, sorting, filtering and field selection of GET /employees. Without any of them all employees are returned
+// in directory order, as before. Cursors point right after the last employee of a page by its sort key, so pages of
+// the same directory version never overlap or skip anyone, and a cursor still continues sensibly after a change.
+//
+
+// Largest page that may be requested
+const maxPageSize = 1000
+
+// Custom attribute employees are filtered by with ?department=
+const departmentAttribute = "department"
+
+// Fields of employees that may be selected, as they are named in JSON
+var employeeFields = map[string]bool{
+	"id":           true,
+	"name":         true,
+	"subordinates": true,
+	"manager_id":   true,
+	"dn":           true,
+	"mail":         true,
+	"title":        true,
+	"phone":        true,
+	"location":     true,
+	"surname":      true,
+	"user_name":    true,
+	"custom":       true,
+}
+
+type GetEmployeesRequest struct {
+	// Page size, zero for all employees
+	Limit int
+	// Either id or name, empty keeps directory order which is only allowed without paging
+	Sort string
+	// Only direct reports of this manager
+	ManagerID *int
+	// Only employees with this department custom attribute
+	Department string
+	// Only these fields of employees, all when empty
+	Fields []string
+
+	after *service.EmployeeCursor
+}
+
+// Responses with selected fields only, otherwise GetEmployeesResponse is returned
+type SparseEmployeesResponse struct {
+	Employees  []map[string]interface{} `json:"employees"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// Sort key of the last employee of a page
+type pageCursor struct {
+	Sort string `json:"s"`
+	ID   int    `json:"i"`
+	Name string `json:"n,omitempty"`
+}
+
+func (c *pageCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeGetEmployeesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request GetEmployeesRequest
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return nil, newParameterError(codeInvalidParameter, "limit",
+				"limit must be an integer between 1 and "+strconv.Itoa(maxPageSize))
+		}
+		request.Limit = parsed
+	}
+	request.Sort = query.Get("sort")
+	if request.Sort != "" && request.Sort != service.SortByID && request.Sort != service.SortByName {
+		return nil, newParameterError(codeInvalidParameter, "sort", `sort must be id or name`)
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		sort, after, err := DecodeCursor(cursor)
+		if err != nil || (sort != service.SortByID && sort != service.SortByName) ||
+			(request.Sort != "" && request.Sort != sort) {
+			return nil, newParameterError(codeInvalidParameter, "cursor",
+				`cursor must be next_cursor of a previous page with the same sort`)
+		}
+		request.Sort = sort
+		request.after = after
+	}
+	if request.Sort == "" && request.Limit > 0 {
+		request.Sort = service.SortByID
+	}
+	if manager := query.Get("manager"); manager != "" {
+		id, err := strconv.Atoi(manager)
+		if err != nil {
+			return nil, newParameterError(codeInvalidParameter, "manager", `manager must be an integer`)
+		}
+		request.ManagerID = &id
+	}
+	request.Department = query.Get("department")
+	if fields := query.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if !employeeFields[field] {
+				return nil, newParameterError(codeInvalidParameter, "fields", "unknown field "+strconv.Quote(field))
+			}
+			request.Fields = append(request.Fields, field)
+		}
+	}
+	return request, nil
+}
+
+// Query of the request as understood by the service, which filters and pages on its own data
+func (req GetEmployeesRequest) query() service.EmployeeQuery {
+	query := service.EmployeeQuery{Limit: req.Limit, Sort: req.Sort, ManagerID: req.ManagerID}
+	if req.after != nil {
+		query.After = &service.EmployeeCursor{ID: req.after.ID, Name: req.after.Name}
+	}
+	if req.Department != "" {
+		query.Custom = map[string]string{departmentAttribute: req.Department}
+	}
+	return query
+}
+
+// Response of a page with the cursor of the next one and only the selected fields
+func listResponse(req GetEmployeesRequest, page *service.EmployeePage) interface{} {
+	next := EncodeCursor(req.Sort, page.Next)
+	if len(req.Fields) == 0 {
+		return GetEmployeesResponse{Employees: page.Employees, NextCursor: next}
+	}
+	sparse := make([]map[string]interface{}, len(page.Employees))
+	for idx, employee := range page.Employees {
+		sparse[idx] = selectFields(employee, req.Fields)
+	}
+	return SparseEmployeesResponse{Employees: sparse, NextCursor: next}
+}
+
+// EncodeCursor returns next_cursor continuing a listing sorted by key after the employee, empty when there is none
+func EncodeCursor(key string, after *service.EmployeeCursor) string {
+	if after == nil {
+		return ""
+	}
+	cursor := &pageCursor{Sort: key, ID: after.ID}
+	if key == service.SortByName {
+		cursor.Name = after.Name
+	}
+	return cursor.encode()
+}
+
+// DecodeCursor returns the sort key and the position of a cursor made by EncodeCursor
+func DecodeCursor(cursor string) (string, *service.EmployeeCursor, error) {
+	var after pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &after)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return after.Sort, &service.EmployeeCursor{ID: after.ID, Name: after.Name}, nil
+}
+
+// Selected fields of the employee as they appear in JSON, empty ones are left out the same way
+func selectFields(employee *service.Employee, fields []string) map[string]interface{} {
+	all := make(map[string]interface{})
+	data, _ := json.Marshal(employee)
+	_ = json.Unmarshal(data, &all)
+	res := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			res[field] = value
+		}
+	}
+	return res
+}
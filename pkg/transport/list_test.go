@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func getEmployeePage(t *testing.T, url string) (int, SparseEmployeesResponse) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var page SparseEmployeesResponse
+	_ = json.NewDecoder(resp.Body).Decode(&page)
+	return resp.StatusCode, page
+}
+
+func TestListEmployees(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	// Walk all pages sorted by name
+	var names []string
+	path := "/employees?limit=3&sort=name&fields=name"
+	for pages := 0; pages < 3; pages++ {
+		status, page := getEmployeePage(t, server.URL+path)
+		if status != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", path, status)
+		}
+		for _, employee := range page.Employees {
+			if len(employee) != 1 {
+				t.Errorf("expected only the name, got %v", employee)
+			}
+			names = append(names, employee["name"].(string))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/employees?limit=3&fields=name&cursor=" + page.NextCursor
+	}
+	if len(names) != 4 || names[0] != "Alice" || names[1] != "Bob" || names[2] != "Carol" || names[3] != "Claire" {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	for _, test := range []struct {
+		path   string
+		status int
+		ids    []float64
+	}{
+		{"/employees?manager=1&fields=id", http.StatusOK, []float64{2, 3}},
+		{"/employees?limit=1&sort=id&fields=id", http.StatusOK, []float64{1}},
+		{"/employees?limit=0", http.StatusBadRequest, nil},
+		{"/employees?limit=1001", http.StatusBadRequest, nil},
+		{"/employees?sort=title", http.StatusBadRequest, nil},
+		{"/employees?fields=id,salary", http.StatusBadRequest, nil},
+		{"/employees?cursor=x", http.StatusBadRequest, nil},
+		{"/employees?sort=id&cursor=" + (&pageCursor{Sort: "name", ID: 2}).encode(), http.StatusBadRequest, nil},
+	} {
+		status, page := getEmployeePage(t, server.URL+test.path)
+		if status != test.status || len(page.Employees) != len(test.ids) {
+			t.Errorf("%s: expected %d with %v, got %d with %v", test.path, test.status, test.ids, status, page.Employees)
+			continue
+		}
+		for idx, id := range test.ids {
+			if page.Employees[idx]["id"] != id {
+				t.Errorf("%s: expected %v, got %v", test.path, test.ids, page.Employees)
+			}
+		}
+	}
+}
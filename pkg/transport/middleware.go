@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/service"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"net/http"
+	"time"
+	"unicode"
+)
+
+// Longest request ID accepted from clients, longer ones are replaced with a generated one
+const maxRequestIdLen = 128
+
+// Endpoint middleware shared by HTTP and gRPC transports. Unlike endpoint.Middleware it gets the name of the endpoint,
+// so it can be used in metrics and logs
+type Middleware func(method string, next endpoint.Endpoint) endpoint.Endpoint
+
+func chainMiddlewares(method string, e endpoint.Endpoint, middlewares []Middleware) endpoint.Endpoint {
+	e = traceEndpoint(method, e)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		e = middlewares[i](method, e)
+	}
+	return e
+}
+
+// InstrumentingMiddleware counts requests and errors and observes latency in seconds, all labeled with method.
+// Latency is additionally labeled with success, so slow failures are told apart from slow queries
+func InstrumentingMiddleware(requests, errors metrics.Counter, duration metrics.Histogram) Middleware {
+	return func(method string, next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				requests.With("method", method).Add(1)
+				if err != nil {
+					errors.With("method", method).Add(1)
+				}
+				duration.With("method", method, "success", fmt.Sprint(err == nil)).
+					Observe(time.Since(begin).Seconds())
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
+
+// LoggingMiddleware logs every request with its parameters, duration, error and request ID. Payloads are summarized,
+// e.g. for setup only the number of employees is logged
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(method string, next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				keyvals := []interface{}{"method", method, "request_id", requestid.FromContext(ctx)}
+				keyvals = append(keyvals, requestParameters(request)...)
+				keyvals = append(keyvals, "took", time.Since(begin), "err", err)
+				_ = logger.Log(keyvals...)
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
+
+// Loggable parameters of a decoded request as key value pairs
+func requestParameters(request interface{}) []interface{} {
+	switch req := request.(type) {
+	case SetupRequest:
+		return []interface{}{"employees", len(req.Employees)}
+	case CommonManagerRequest:
+		return []interface{}{"first", req.First, "second", req.Second}
+	case GetEmployeeRequest:
+		return []interface{}{"id", req.Id}
+	case CommonManagerBatchRequest:
+		return []interface{}{"pairs", len(req.Pairs)}
+	case GetEmployeesRequest:
+		return []interface{}{"limit", req.Limit, "sort", req.Sort, "fields", len(req.Fields)}
+	case AddEmployeeRequest:
+		return employeeParameters(req.Employee)
+	case UpdateEmployeeRequest:
+		return employeeParameters(req.Employee)
+	case RemoveEmployeeRequest:
+		return []interface{}{"id", req.Id}
+	case AuditRequest:
+		return []interface{}{"since", req.Since, "actor", req.Actor}
+	case EventsRequest:
+		if req.Root != nil {
+			return []interface{}{"root", *req.Root, "last_event_id", req.LastEventId}
+		}
+		return []interface{}{"last_event_id", req.LastEventId}
+	case CreateWebhookRequest:
+		return []interface{}{"url", req.URL, "events", len(req.Events)}
+	case DeleteWebhookRequest:
+		return []interface{}{"id", req.Id}
+	case graphqlRequest:
+		return []interface{}{"operation", req.OperationName, "query_len", len(req.Query)}
+	case scimListRequest:
+		return []interface{}{"filter", req.Filter, "start_index", req.StartIndex, "count", req.Count}
+	case scimUserRequest:
+		return []interface{}{"id", req.ID}
+	case scimPatchRequest:
+		return []interface{}{"id", req.ID, "operations", len(req.Operations)}
+	case scimIdRequest:
+		return []interface{}{"id", req.ID}
+	default:
+		return nil
+	}
+}
+
+func employeeParameters(employee *service.Employee) []interface{} {
+	keyvals := []interface{}{"id", employee.ID}
+	if employee.ManagerID != nil {
+		keyvals = append(keyvals, "manager_id", *employee.ManagerID)
+	}
+	return keyvals
+}
+
+// Assign request ID to every HTTP request, keeping a sane one sent by the client, and echo it in the response
+func withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !validRequestId(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, c := range id {
+		if c > unicode.MaxASCII || !unicode.IsPrint(c) || c == ' ' {
+			return false
+		}
+	}
+	return true
+}
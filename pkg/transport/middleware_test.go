@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/requestid"
+	"corporate-directory/pkg/service"
+	"github.com/go-kit/kit/log"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentingMiddleware(t *testing.T) {
+	requests := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "requests"}, []string{"method"})
+	errors := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Name: "errors"}, []string{"method"})
+	duration := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{Name: "duration"},
+		[]string{"method", "success"})
+	instrumenting := InstrumentingMiddleware(kitprometheus.NewCounter(requests), kitprometheus.NewCounter(errors),
+		kitprometheus.NewHistogram(duration))
+
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	_ = svc.Setup(context.Background(), []*service.Employee{{ID: 1, Name: "Claire"}})
+	handler := SetupHttpTransport(svc, config.Default(), WithMiddlewares(instrumenting)).Handler
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, path := range []string{"/employees/1", "/employees/2", "/common?first=1&second=1", "/healthz"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// Health probes are not instrumented
+	if health := testutil.ToFloat64(requests.WithLabelValues("health")); health != 0 {
+		t.Errorf("health probe was instrumented")
+	}
+	getEmployee := testutil.ToFloat64(requests.WithLabelValues("get_employee"))
+	getEmployeeErrors := testutil.ToFloat64(errors.WithLabelValues("get_employee"))
+	if getEmployee != 2 || getEmployeeErrors != 1 {
+		t.Errorf("expected 2 requests and 1 error, got %v and %v", getEmployee, getEmployeeErrors)
+	}
+	if common := testutil.ToFloat64(requests.WithLabelValues("common_manager")); common != 1 {
+		t.Errorf("expected 1 common manager request, got %v", common)
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "# TYPE") {
+		t.Errorf("unexpected metrics response %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	handler := SetupHttpTransport(svc, config.Default(), WithMiddlewares(LoggingMiddleware(logger))).Handler
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	body := `{"employees": [{"id": 1, "name": "Claire", "title": "CEO"}]}`
+	req, _ := http.NewRequest("POST", server.URL+"/setup", strings.NewReader(body))
+	req.Header.Set(requestid.Header, "deploy-42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get(requestid.Header) != "deploy-42" {
+		t.Errorf("request id was not echoed, got %q", resp.Header.Get(requestid.Header))
+	}
+
+	resp, err = http.Get(server.URL + "/common?first=1&second=5")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	generated := resp.Header.Get(requestid.Header)
+	if len(generated) != 16 {
+		t.Errorf("expected generated request id, got %q", generated)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "method=setup request_id=deploy-42 employees=1 took=") ||
+		!strings.HasSuffix(lines[0], "err=null") || strings.Contains(lines[0], "CEO") {
+		t.Errorf("unexpected setup log line %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "method=common_manager request_id="+generated+" first=1 second=5 took=") ||
+		!strings.HasSuffix(lines[1], `err="employee with given id was not found"`) {
+		t.Errorf("unexpected common manager log line %q", lines[1])
+	}
+}
+
+func TestValidRequestId(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"":                        false,
+		"b7ad6b7169203331":        true,
+		"req 1":                   false,
+		"req\n1":                  false,
+		strings.Repeat("a", 129):  false,
+		"5f1f3d1e-9c2b-4f53-a6c0": true,
+	} {
+		if validRequestId(id) != valid {
+			t.Errorf("expected valid %v for %q", valid, id)
+		}
+	}
+}
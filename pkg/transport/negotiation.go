@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"corporate-directory/pkg/pb"
+	"encoding/json"
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Content negotiation of responses. Accept chooses between JSON, MessagePack and protobuf, Accept-Encoding allows
+// gzip compression of larger bodies. MessagePack uses the same field names as JSON. Protobuf uses the messages of the
+// gRPC API, so it's only available for responses that have one and carries only the attributes those messages have;
+// other responses fall back to the next acceptable format or JSON. Errors are always JSON.
+//
+
+const (
+	jsonContentType     = "application/json"
+	msgpackContentType  = "application/msgpack"
+	protobufContentType = "application/x-protobuf"
+)
+
+// Smaller bodies are not worth compressing
+const minGzipBytes = 1024
+
+// Alternative names clients use for the same formats
+var contentTypeAliases = map[string]string{
+	"application/x-msgpack": msgpackContentType,
+	"application/protobuf":  protobufContentType,
+}
+
+// Formats acceptable for the response in order of preference and whether it may be compressed
+type negotiation struct {
+	formats []string
+	gzip    bool
+}
+
+type negotiationKey struct{}
+
+// Take acceptable formats and encodings from the request for encodeResponse
+func httpNegotiation(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, negotiationKey{}, &negotiation{
+		formats: acceptedFormats(r.Header.Get("Accept")),
+		gzip:    acceptsGzip(r.Header.Get("Accept-Encoding")),
+	})
+}
+
+// Supported formats of an Accept header by quality, ties are kept in order of the header. Wildcards and a missing
+// header accept JSON
+func acceptedFormats(header string) []string {
+	type candidate struct {
+		format  string
+		quality float64
+	}
+	var candidates []candidate
+	for _, mediaRange := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		if alias, ok := contentTypeAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		switch mediaType {
+		case "*/*", "application/*":
+			mediaType = jsonContentType
+		case jsonContentType, msgpackContentType, protobufContentType:
+		default:
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			candidates = append(candidates, candidate{mediaType, quality})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	var formats []string
+	for _, c := range candidates {
+		formats = append(formats, c.format)
+	}
+	return formats
+}
+
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		parts := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err != nil || q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Body of the response in the first acceptable format able to represent it
+func (n *negotiation) encode(response interface{}) (contentType string, body []byte, err error) {
+	var formats []string
+	if n != nil {
+		formats = n.formats
+	}
+	for _, format := range formats {
+		switch format {
+		case jsonContentType:
+			return encodeJson(response)
+		case msgpackContentType:
+			var buf bytes.Buffer
+			err := msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(response)
+			return msgpackContentType, buf.Bytes(), err
+		case protobufContentType:
+			if message, ok := toPbMessage(response); ok {
+				body, err := proto.Marshal(message)
+				return protobufContentType, body, err
+			}
+		}
+	}
+	return encodeJson(response)
+}
+
+func encodeJson(response interface{}) (string, []byte, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(response)
+	return "application/json; charset=utf-8", buf.Bytes(), err
+}
+
+// Message of the gRPC API for the response, pages continued with a cursor have none
+func toPbMessage(response interface{}) (proto.Message, bool) {
+	switch res := response.(type) {
+	case SetupResponse:
+		return &pb.SetupResponse{}, true
+	case CommonManagerResponse:
+		return &pb.GetCommonManagerResponse{Common: toPbEmployee(res.Common)}, true
+	case GetEmployeeResponse:
+		return &pb.GetEmployeeResponse{Employee: toPbEmployee(res.Employee)}, true
+	case GetEmployeesResponse:
+		return &pb.GetEmployeesResponse{Employees: toPbEmployees(res.Employees)}, res.NextCursor == ""
+	}
+	return nil, false
+}
+
+// Short name of a content type, e.g. msgpack for application/msgpack
+func formatName(contentType string) string {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return strings.TrimPrefix(strings.TrimPrefix(mediaType, "application/"), "x-")
+}
+
+// Write the response with status in the negotiated format and encoding
+func writeResponse(ctx context.Context, w http.ResponseWriter, status int, response interface{}) error {
+	n, _ := ctx.Value(negotiationKey{}).(*negotiation)
+	contentType, body, err := n.encode(response)
+	if err != nil {
+		return err
+	}
+	gzipped := n != nil && n.gzip && len(body) >= minGzipBytes
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+	if tag := w.Header().Get("ETag"); tag != "" {
+		w.Header().Set("ETag", representationEtag(tag, formatName(contentType), gzipped))
+	}
+	if !gzipped {
+		w.WriteHeader(status)
+		_, err = w.Write(body)
+		return err
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
+	compressed := gzip.NewWriter(w)
+	if _, err := compressed.Write(body); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"corporate-directory/pkg/pb"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAcceptedFormats(t *testing.T) {
+	for header, expected := range map[string][]string{
+		"":                      nil,
+		"*/*":                   {jsonContentType},
+		"application/x-msgpack": {msgpackContentType},
+		"application/json;q=0.5, application/protobuf": {protobufContentType, jsonContentType},
+		"text/html, application/msgpack;q=0":           nil,
+		"application/msgpack;q=x, application/json":    {jsonContentType},
+	} {
+		if formats := acceptedFormats(header); !reflect.DeepEqual(formats, expected) {
+			t.Errorf("%q: expected %v, got %v", header, expected, formats)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	get := func(path, accept, encoding string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			if body, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatalf("invalid gzip: %v", err)
+			}
+		}
+		data, _ := ioutil.ReadAll(body)
+		return resp, data
+	}
+
+	resp, body := get("/employees", "application/msgpack", "")
+	var employees GetEmployeesResponse
+	if err := msgpack.NewDecoder(bytes.NewReader(body)).UseJSONTag(true).Decode(&employees); err != nil ||
+		resp.Header.Get("Content-Type") != msgpackContentType || len(employees.Employees) != 4 ||
+		employees.Employees[0].Name != "Claire" {
+		t.Errorf("unexpected msgpack response %v %+v %v", resp.Header, employees, err)
+	}
+
+	resp, body = get("/employees/2", "application/x-protobuf, application/json;q=0.9", "gzip")
+	var employee pb.GetEmployeeResponse
+	if err := proto.Unmarshal(body, &employee); err != nil || resp.Header.Get("Content-Type") != protobufContentType ||
+		resp.Header.Get("Content-Encoding") != "" || employee.Employee.Name != "Alice" {
+		t.Errorf("unexpected protobuf response %v %+v %v", resp.Header, employee, err)
+	}
+
+	// Pages have no protobuf message and fall back to JSON
+	resp, body = get("/employees?limit=1", "application/x-protobuf", "")
+	if err := json.Unmarshal(body, &employees); err != nil || employees.NextCursor == "" ||
+		resp.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("unexpected fallback response %v %s", resp.Header, body)
+	}
+
+	// Only larger bodies are compressed
+	if resp, _ := get("/employees", "", "gzip"); resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("expected small response uncompressed, got %v", resp.Header)
+	}
+	large := GetEmployeesResponse{}
+	for id := 1; id <= 100; id++ {
+		large.Employees = append(large.Employees, &service.Employee{ID: id, Name: "Employee"})
+	}
+	ctx := context.WithValue(context.Background(), negotiationKey{}, &negotiation{gzip: true})
+	recorder := httptest.NewRecorder()
+	if err := writeResponse(ctx, recorder, http.StatusOK, large); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil || recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got %v %v", recorder.Header(), err)
+	}
+	var decoded GetEmployeesResponse
+	if err := json.NewDecoder(reader).Decode(&decoded); err != nil || len(decoded.Employees) != 100 {
+		t.Errorf("unexpected decompressed response %+v %v", decoded, err)
+	}
+}
@@ -0,0 +1,663 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/auth"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// SCIM 2.0 (RFC 7643, RFC 7644) Users resource mapped onto the corporate directory. Hierarchy is described by the
+// manager attribute of the enterprise extension, SCIM ids are employee IDs.
+//
+
+const (
+	scimUserSchema       = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimEnterpriseSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	scimListSchema       = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema      = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimContentType = "application/scim+json"
+	scimUsersPath   = "/scim/v2/Users"
+	scimMaxResults  = 1000
+)
+
+// SCIM error response, also used as an error value inside endpoints and decoders
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	code     int
+}
+
+func newScimError(code int, scimType, detail string) *scimError {
+	return &scimError{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(code),
+		ScimType: scimType,
+		Detail:   detail,
+		code:     code,
+	}
+}
+
+func (e *scimError) Error() string {
+	return e.Detail
+}
+
+type scimManager struct {
+	Value       string `json:"value"`
+	Ref         string `json:"$ref,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type scimEnterpriseUser struct {
+	Manager *scimManager `json:"manager,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+	Version      string `json:"version,omitempty"`
+}
+
+type scimUser struct {
+	Schemas     []string            `json:"schemas"`
+	ID          string              `json:"id,omitempty"`
+	UserName    string              `json:"userName"`
+	DisplayName string              `json:"displayName,omitempty"`
+	Title       string              `json:"title,omitempty"`
+	Emails      []scimEmail         `json:"emails,omitempty"`
+	Enterprise  *scimEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *scimMeta           `json:"meta,omitempty"`
+}
+
+type scimListRequest struct {
+	Filter     string
+	StartIndex int
+	Count      int
+}
+
+type scimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    []*scimUser `json:"Resources"`
+}
+
+type scimUserRequest struct {
+	ID   int
+	User *scimUser
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimPatchRequest struct {
+	ID         int
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimIdRequest struct {
+	ID int
+}
+
+// Created resources are returned with 201 and their location
+type scimCreatedResponse struct {
+	*scimUser
+}
+
+func (scimCreatedResponse) StatusCode() int {
+	return http.StatusCreated
+}
+
+func (r scimCreatedResponse) Headers() http.Header {
+	return http.Header{"Location": []string{r.Meta.Location}}
+}
+
+type scimNoContentResponse struct{}
+
+func (scimNoContentResponse) StatusCode() int {
+	return http.StatusNoContent
+}
+
+var scimServiceProviderConfig = map[string]interface{}{
+	"schemas":               []string{scimConfigSchema},
+	"patch":                 map[string]interface{}{"supported": true},
+	"bulk":                  map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+	"filter":                map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+	"changePassword":        map[string]interface{}{"supported": false},
+	"sort":                  map[string]interface{}{"supported": false},
+	"etag":                  map[string]interface{}{"supported": true},
+	"authenticationSchemes": []interface{}{},
+	"meta": scimMeta{
+		ResourceType: "ServiceProviderConfig",
+		Location:     "/scim/v2/ServiceProviderConfig",
+	},
+}
+
+// Convert employee into SCIM representation, manager's name is resolved for convenience of SCIM clients. Employees
+// not provisioned over SCIM have no userName of their own, so their name is used instead
+func toScimUser(ctx context.Context, svc service.CorporateDirectory, employee *service.Employee) *scimUser {
+	id := strconv.Itoa(employee.ID)
+	userName := employee.UserName
+	if userName == "" {
+		userName = employee.Name
+	}
+	user := &scimUser{
+		Schemas:     []string{scimUserSchema, scimEnterpriseSchema},
+		ID:          id,
+		UserName:    userName,
+		DisplayName: employee.Name,
+		Title:       employee.Title,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Location:     scimUsersPath + "/" + id,
+		},
+	}
+	if employee.Mail != "" {
+		user.Emails = []scimEmail{{Value: employee.Mail, Type: "work", Primary: true}}
+	}
+	if employee.ManagerID != nil {
+		managerId := strconv.Itoa(*employee.ManagerID)
+		manager := &scimManager{Value: managerId, Ref: "../Users/" + managerId}
+		if managerEmployee, err := svc.GetEmployee(ctx, *employee.ManagerID); err == nil {
+			manager.DisplayName = managerEmployee.Name
+		}
+		user.Enterprise = &scimEnterpriseUser{Manager: manager}
+	}
+	return user
+}
+
+// Apply SCIM attributes to the employee, attributes that SCIM doesn't know about (e.g. dn) are left as is. Users
+// without displayName are named after their userName
+func applyScimUser(employee *service.Employee, user *scimUser) error {
+	if user.UserName == "" {
+		return newScimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	employee.UserName = user.UserName
+	employee.Name = user.UserName
+	if user.DisplayName != "" {
+		employee.Name = user.DisplayName
+	}
+	employee.Title = user.Title
+
+	employee.Mail = ""
+	for _, email := range user.Emails {
+		if employee.Mail == "" || email.Primary {
+			employee.Mail = email.Value
+		}
+	}
+
+	employee.ManagerID = nil
+	if user.Enterprise != nil && user.Enterprise.Manager != nil && user.Enterprise.Manager.Value != "" {
+		managerId, err := strconv.Atoi(user.Enterprise.Manager.Value)
+		if err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "manager value must be a user id")
+		}
+		employee.ManagerID = &managerId
+	}
+	return nil
+}
+
+// Map service and solver errors to SCIM errors
+func toScimError(err error) *scimError {
+	switch err {
+	case service.ErrInvalidEmployee:
+		return newScimError(http.StatusNotFound, "", err.Error())
+	case service.ErrEmployeeExists:
+		return newScimError(http.StatusConflict, "uniqueness", err.Error())
+	case service.ErrRemoveBoss:
+		return newScimError(http.StatusBadRequest, "mutability", err.Error())
+	case service.ErrInvalidEdge, service.ErrManagerConflict, service.ErrBossNotFound, lca.ErrInvalidTree:
+		return newScimError(http.StatusBadRequest, "invalidValue", err.Error())
+	case service.ErrVersionMismatch:
+		return newScimError(http.StatusPreconditionFailed, "", err.Error())
+	case auth.ErrUnauthenticated:
+		return newScimError(http.StatusUnauthorized, "", err.Error())
+	case auth.ErrForbidden:
+		return newScimError(http.StatusForbidden, "", err.Error())
+	}
+	if scimErr, ok := err.(*scimError); ok {
+		return scimErr
+	}
+	return newScimError(http.StatusInternalServerError, "", err.Error())
+}
+
+func makeScimListEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scimListRequest)
+		filter, err := parseScimFilter(req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		employees, err := svc.GetEmployees(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var matched []*scimUser
+		for _, employee := range employees {
+			user := toScimUser(ctx, svc, employee)
+			if filter(user) {
+				matched = append(matched, user)
+			}
+		}
+
+		// startIndex is 1-based, as defined in RFC 7644 section 3.4.2.4
+		res := scimListResponse{
+			Schemas:      []string{scimListSchema},
+			TotalResults: len(matched),
+			StartIndex:   req.StartIndex,
+			Resources:    []*scimUser{},
+		}
+		if req.StartIndex <= len(matched) {
+			page := matched[req.StartIndex-1:]
+			if len(page) > req.Count {
+				page = page[:req.Count]
+			}
+			res.Resources = page
+		}
+		res.ItemsPerPage = len(res.Resources)
+		return res, nil
+	}
+}
+
+func makeScimGetEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scimIdRequest)
+		employee, err := svc.GetEmployee(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return toScimUser(ctx, svc, employee), nil
+	}
+}
+
+func makeScimCreateEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scimUserRequest)
+		employee := &service.Employee{}
+		if err := applyScimUser(employee, req.User); err != nil {
+			return nil, err
+		}
+		added, err := svc.AddEmployee(ctx, employee)
+		if err != nil {
+			return nil, err
+		}
+		return scimCreatedResponse{toScimUser(ctx, svc, added)}, nil
+	}
+}
+
+// Attempts of a read-modify-write that keeps losing to concurrent writes
+const scimUpdateAttempts = 3
+
+// Change a copy of the employee as read and update it only if the directory is still at the version it was read at,
+// so concurrent writes in between are never overwritten. Writes given If-Match fail on such a conflict, others read
+// the employee again
+func updateScimEmployee(ctx context.Context, svc service.CorporateDirectory, id int,
+	change func(*service.Employee) error) (*service.Employee, error) {
+	_, pinned := service.ExpectedVersionFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		writeCtx := ctx
+		if !pinned {
+			writeCtx = service.NewExpectedVersionContext(ctx, svc.Version(ctx))
+		}
+		current, err := svc.GetEmployee(writeCtx, id)
+		if err != nil {
+			return nil, err
+		}
+		employee := *current
+		if err := change(&employee); err != nil {
+			return nil, err
+		}
+		updated, err := svc.UpdateEmployee(writeCtx, &employee)
+		if err == service.ErrVersionMismatch && !pinned && attempt < scimUpdateAttempts {
+			continue
+		}
+		return updated, err
+	}
+}
+
+func makeScimReplaceEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scimUserRequest)
+		updated, err := updateScimEmployee(ctx, svc, req.ID, func(employee *service.Employee) error {
+			return applyScimUser(employee, req.User)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return toScimUser(ctx, svc, updated), nil
+	}
+}
+
+func makeScimPatchEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scimPatchRequest)
+		updated, err := updateScimEmployee(ctx, svc, req.ID, func(employee *service.Employee) error {
+			user := toScimUser(ctx, svc, employee)
+			for _, operation := range req.Operations {
+				if err := applyScimPatch(user, operation); err != nil {
+					return err
+				}
+			}
+			return applyScimUser(employee, user)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return toScimUser(ctx, svc, updated), nil
+	}
+}
+
+func makeScimDeleteEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scimIdRequest)
+		if err := svc.RemoveEmployee(ctx, req.ID); err != nil {
+			return nil, err
+		}
+		return scimNoContentResponse{}, nil
+	}
+}
+
+func makeScimServiceProviderConfigEndpoint() endpoint.Endpoint {
+	return func(_ context.Context, _ interface{}) (interface{}, error) {
+		return scimServiceProviderConfig, nil
+	}
+}
+
+// Apply single PATCH operation (RFC 7644 section 3.5.2) to the SCIM representation of a user
+func applyScimPatch(user *scimUser, operation scimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("unsupported patch op %q", operation.Op))
+	}
+
+	// Without path value is an object with attributes to be set
+	if operation.Path == "" {
+		if op == "remove" {
+			return newScimError(http.StatusBadRequest, "noTarget", "remove requires a path")
+		}
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "value must be an object")
+		}
+		for path, value := range attributes {
+			if err := applyScimPatchPath(user, op, path, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return applyScimPatchPath(user, op, operation.Path, operation.Value)
+}
+
+func applyScimPatchPath(user *scimUser, op, path string, value json.RawMessage) error {
+	var str string
+	decodeString := func() error {
+		if op == "remove" {
+			str = ""
+			return nil
+		}
+		if err := json.Unmarshal(value, &str); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", path+" must be a string")
+		}
+		return nil
+	}
+
+	lowerPath := strings.ToLower(path)
+	switch {
+	case lowerPath == "username":
+		if err := decodeString(); err != nil {
+			return err
+		}
+		if str == "" {
+			return newScimError(http.StatusBadRequest, "mutability", "userName can not be removed")
+		}
+		user.UserName = str
+	case lowerPath == "displayname":
+		if err := decodeString(); err != nil {
+			return err
+		}
+		user.DisplayName = str
+	case lowerPath == "title":
+		if err := decodeString(); err != nil {
+			return err
+		}
+		user.Title = str
+	case lowerPath == "emails":
+		var emails []scimEmail
+		if op != "remove" {
+			if err := json.Unmarshal(value, &emails); err != nil {
+				return newScimError(http.StatusBadRequest, "invalidValue", "emails must be an array")
+			}
+		}
+		if op == "add" {
+			emails = append(user.Emails, emails...)
+		}
+		user.Emails = emails
+	case strings.HasPrefix(lowerPath, "emails[") && strings.HasSuffix(lowerPath, "].value"):
+		// Only one email is stored, so any value filter addresses the primary one
+		if err := decodeString(); err != nil {
+			return err
+		}
+		user.Emails = nil
+		if str != "" {
+			user.Emails = []scimEmail{{Value: str, Type: "work", Primary: true}}
+		}
+	case lowerPath == strings.ToLower(scimEnterpriseSchema):
+		var enterprise scimEnterpriseUser
+		if op != "remove" {
+			if err := json.Unmarshal(value, &enterprise); err != nil {
+				return newScimError(http.StatusBadRequest, "invalidValue", "enterprise extension must be an object")
+			}
+		}
+		user.Enterprise = &enterprise
+	case lowerPath == "manager" || lowerPath == "manager.value" ||
+		lowerPath == strings.ToLower(scimEnterpriseSchema)+":manager" ||
+		lowerPath == strings.ToLower(scimEnterpriseSchema)+":manager.value":
+		// Manager may be given as an object or as a plain id, different clients do it differently
+		manager := &scimManager{}
+		if op != "remove" {
+			if err := json.Unmarshal(value, manager); err != nil {
+				if err := json.Unmarshal(value, &manager.Value); err != nil {
+					return newScimError(http.StatusBadRequest, "invalidValue", "manager must be an object or an id")
+				}
+			}
+		}
+		user.Enterprise = &scimEnterpriseUser{Manager: manager}
+	default:
+		return newScimError(http.StatusBadRequest, "invalidPath", fmt.Sprintf("unsupported path %q", path))
+	}
+	return nil
+}
+
+func decodeScimListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	request := scimListRequest{
+		Filter:     query.Get("filter"),
+		StartIndex: 1,
+		Count:      scimMaxResults,
+	}
+	if str := query.Get("startIndex"); str != "" {
+		startIndex, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, newScimError(http.StatusBadRequest, "invalidValue", "startIndex must be an integer")
+		}
+		if startIndex > 1 {
+			request.StartIndex = startIndex
+		}
+	}
+	if str := query.Get("count"); str != "" {
+		count, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, newScimError(http.StatusBadRequest, "invalidValue", "count must be an integer")
+		}
+		if count < 0 {
+			count = 0
+		}
+		if count < request.Count {
+			request.Count = count
+		}
+	}
+	return request, nil
+}
+
+// SCIM ids which are not employee IDs can't point to an existing resource
+func decodeScimId(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return 0, newScimError(http.StatusNotFound, "", service.ErrInvalidEmployee.Error())
+	}
+	return id, nil
+}
+
+func decodeScimIdRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeScimId(r)
+	if err != nil {
+		return nil, err
+	}
+	return scimIdRequest{ID: id}, nil
+}
+
+func decodeScimCreateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var user scimUser
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		return nil, newScimError(http.StatusBadRequest, "invalidSyntax", err.Error())
+	}
+	return scimUserRequest{User: &user}, nil
+}
+
+func decodeScimReplaceRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeScimId(r)
+	if err != nil {
+		return nil, err
+	}
+	request, err := decodeScimCreateRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := request.(scimUserRequest)
+	req.ID = id
+	return req, nil
+}
+
+func decodeScimPatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeScimId(r)
+	if err != nil {
+		return nil, err
+	}
+	var request scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, newScimError(http.StatusBadRequest, "invalidSyntax", err.Error())
+	}
+	if len(request.Schemas) != 1 || request.Schemas[0] != scimPatchSchema {
+		return nil, newScimError(http.StatusBadRequest, "invalidSyntax", "schemas must be ["+scimPatchSchema+"]")
+	}
+	request.ID = id
+	return request, nil
+}
+
+func decodeScimEmptyRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+func encodeScimResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if _, ok := response.(notModifiedResponse); ok {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if c, ok := ctx.Value(conditionsKey{}).(*conditions); ok && c.known {
+		setScimVersion(response, etag(c.version))
+	}
+	if headerer, ok := response.(httptransport.Headerer); ok {
+		for key, values := range headerer.Headers() {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
+	code := http.StatusOK
+	if sc, ok := response.(httptransport.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return nil
+	}
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(response)
+}
+
+// Resources carry the version of the directory they were read from, the same as the ETag of the response
+func setScimVersion(response interface{}, version string) {
+	switch res := response.(type) {
+	case *scimUser:
+		res.Meta.Version = version
+	case scimCreatedResponse:
+		res.Meta.Version = version
+	case scimListResponse:
+		for _, user := range res.Resources {
+			user.Meta.Version = version
+		}
+	}
+}
+
+func encodeScimError(_ context.Context, err error, w http.ResponseWriter) {
+	scimErr := toScimError(err)
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(scimErr.code)
+	_ = json.NewEncoder(w).Encode(scimErr)
+}
+
+// Register SCIM endpoints on the router used by the HTTP transport
+func registerScimRoutes(router *httprouter.Router, svc service.CorporateDirectory, middlewares []Middleware) {
+	options := []httptransport.ServerOption{
+		httptransport.ServerBefore(httpCredentials, httpSource, httpConditions),
+		httptransport.ServerAfter(httpVersionHeaders),
+		httptransport.ServerErrorEncoder(encodeScimError),
+	}
+	newServer := func(name string, e endpoint.Endpoint, dec httptransport.DecodeRequestFunc) http.Handler {
+		return newHttpServer(chainMiddlewares(name, e, middlewares), dec, encodeScimResponse, options...)
+	}
+
+	router.Handler("GET", scimUsersPath,
+		newServer("scim_list_users", versionedRead(svc, makeScimListEndpoint(svc)), decodeScimListRequest))
+	router.Handler("POST", scimUsersPath,
+		newServer("scim_create_user", versionedWrite(svc, makeScimCreateEndpoint(svc)), decodeScimCreateRequest))
+	router.Handler("GET", scimUsersPath+"/:id",
+		newServer("scim_get_user", versionedRead(svc, makeScimGetEndpoint(svc)), decodeScimIdRequest))
+	router.Handler("PUT", scimUsersPath+"/:id",
+		newServer("scim_replace_user", versionedWrite(svc, makeScimReplaceEndpoint(svc)), decodeScimReplaceRequest))
+	router.Handler("PATCH", scimUsersPath+"/:id",
+		newServer("scim_patch_user", versionedWrite(svc, makeScimPatchEndpoint(svc)), decodeScimPatchRequest))
+	router.Handler("DELETE", scimUsersPath+"/:id",
+		newServer("scim_delete_user", versionedWrite(svc, makeScimDeleteEndpoint(svc)), decodeScimIdRequest))
+	router.Handler("GET", "/scim/v2/ServiceProviderConfig",
+		newServer("scim_service_provider_config", makeScimServiceProviderConfigEndpoint(), decodeScimEmptyRequest))
+}
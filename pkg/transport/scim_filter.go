@@ -0,0 +1,292 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//
+// Parser for SCIM filter expressions (RFC 7644 section 3.4.2.2). Supports attribute operators, logical and/or/not
+// and grouping. Value path filters like emails[type eq "work"] are not supported.
+//
+
+type scimFilter func(user *scimUser) bool
+
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+// Parse filter into a predicate, empty filter matches everything
+func parseScimFilter(filter string) (scimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return func(*scimUser) bool { return true }, nil
+	}
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	parser := &scimFilterParser{tokens: tokens}
+	result, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos != len(parser.tokens) {
+		return nil, invalidScimFilter("unexpected %q", parser.tokens[parser.pos])
+	}
+	return result, nil
+}
+
+func invalidScimFilter(format string, args ...interface{}) *scimError {
+	return newScimError(http.StatusBadRequest, "invalidFilter", fmt.Sprintf(format, args...))
+}
+
+// Split filter into words, parentheses and quoted strings. Quoted strings keep their quotes so values can be told
+// apart from keywords
+func tokenizeScimFilter(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(filter) && filter[j] != '"'; j++ {
+				if filter[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(filter) {
+				return nil, invalidScimFilter("unterminated string")
+			}
+			tokens = append(tokens, filter[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(filter) && filter[j] != ' ' && filter[j] != '(' && filter[j] != ')'; j++ {
+			}
+			tokens = append(tokens, filter[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *scimFilterParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", invalidScimFilter("unexpected end of filter")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(user *scimUser) bool { return l(user) || right(user) }
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(user *scimUser) bool { return l(user) && right(user) }
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseFactor() (scimFilter, error) {
+	token, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case token == "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, err := p.next(); err != nil || closing != ")" {
+			return nil, invalidScimFilter("missing closing parenthesis")
+		}
+		return inner, nil
+	case strings.EqualFold(token, "not"):
+		if opening, err := p.next(); err != nil || opening != "(" {
+			return nil, invalidScimFilter("not must be followed by parenthesis")
+		}
+		p.pos--
+		inner, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return func(user *scimUser) bool { return !inner(user) }, nil
+	}
+
+	return p.parseComparison(token)
+}
+
+func (p *scimFilterParser) parseComparison(attribute string) (scimFilter, error) {
+	getter, err := scimAttributeGetter(attribute)
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op = strings.ToLower(op)
+
+	if op == "pr" {
+		return func(user *scimUser) bool {
+			for _, value := range getter(user) {
+				if value != "" {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	rawValue, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseScimFilterValue(rawValue)
+	if err != nil {
+		return nil, err
+	}
+
+	var compare func(actual string) bool
+	switch op {
+	case "eq":
+		compare = func(actual string) bool { return actual == value }
+	case "ne":
+		compare = func(actual string) bool { return actual != value }
+	case "co":
+		compare = func(actual string) bool { return strings.Contains(actual, value) }
+	case "sw":
+		compare = func(actual string) bool { return strings.HasPrefix(actual, value) }
+	case "ew":
+		compare = func(actual string) bool { return strings.HasSuffix(actual, value) }
+	case "gt":
+		compare = func(actual string) bool { return actual > value }
+	case "ge":
+		compare = func(actual string) bool { return actual >= value }
+	case "lt":
+		compare = func(actual string) bool { return actual < value }
+	case "le":
+		compare = func(actual string) bool { return actual <= value }
+	default:
+		return nil, invalidScimFilter("unknown operator %q", op)
+	}
+
+	// Multi-valued attributes match if any of their values does, ne requires all of them to differ
+	return func(user *scimUser) bool {
+		values := getter(user)
+		if op == "ne" {
+			for _, actual := range values {
+				if !compare(strings.ToLower(actual)) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, actual := range values {
+			if compare(strings.ToLower(actual)) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// All supported attributes are case insensitive strings, so values are lowercased for comparison
+func parseScimFilterValue(raw string) (string, error) {
+	if strings.HasPrefix(raw, `"`) {
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", invalidScimFilter("invalid string %s", raw)
+		}
+		return strings.ToLower(value), nil
+	}
+	switch strings.ToLower(raw) {
+	case "true", "false", "null":
+		return strings.ToLower(raw), nil
+	}
+	if len(raw) > 0 && (unicode.IsDigit(rune(raw[0])) || raw[0] == '-') {
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return raw, nil
+		}
+	}
+	return "", invalidScimFilter("invalid value %q", raw)
+}
+
+func scimAttributeGetter(attribute string) (func(user *scimUser) []string, error) {
+	path := strings.ToLower(attribute)
+	// Attributes may be prefixed with their schema URN
+	path = strings.TrimPrefix(path, strings.ToLower(scimUserSchema)+":")
+	path = strings.TrimPrefix(path, strings.ToLower(scimEnterpriseSchema)+":")
+
+	switch path {
+	case "id":
+		return func(user *scimUser) []string { return []string{user.ID} }, nil
+	case "username":
+		return func(user *scimUser) []string { return []string{user.UserName} }, nil
+	case "displayname":
+		return func(user *scimUser) []string { return []string{user.DisplayName} }, nil
+	case "title":
+		return func(user *scimUser) []string { return []string{user.Title} }, nil
+	case "emails", "emails.value":
+		return func(user *scimUser) []string {
+			values := make([]string, 0, len(user.Emails))
+			for _, email := range user.Emails {
+				values = append(values, email.Value)
+			}
+			return values
+		}, nil
+	case "manager", "manager.value":
+		return func(user *scimUser) []string {
+			if user.Enterprise == nil || user.Enterprise.Manager == nil {
+				return nil
+			}
+			return []string{user.Enterprise.Manager.Value}
+		}, nil
+	case "meta.resourcetype":
+		return func(user *scimUser) []string { return []string{user.Meta.ResourceType} }, nil
+	}
+	return nil, invalidScimFilter("unsupported attribute %q", attribute)
+}
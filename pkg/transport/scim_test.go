@@ -0,0 +1,262 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func doScimRequest(t *testing.T, method, url string, body interface{}, result interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", scimContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestScimFilter(t *testing.T) {
+	user := &scimUser{
+		ID:          "4",
+		UserName:    "Carol",
+		DisplayName: "Carol",
+		Title:       "Engineer",
+		Emails:      []scimEmail{{Value: "carol@bureaucr.at"}},
+		Enterprise:  &scimEnterpriseUser{Manager: &scimManager{Value: "2"}},
+		Meta:        &scimMeta{ResourceType: "User"},
+	}
+	tests := []struct {
+		filter string
+		match  bool
+	}{
+		{``, true},
+		{`userName eq "carol"`, true},
+		{`userName eq "alice"`, false},
+		{`title sw "Eng" and emails co "bureaucr"`, true},
+		{`title sw "Eng" and not (emails co "bureaucr")`, false},
+		{`userName eq "alice" or manager.value eq "2"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "2"`, true},
+		{`(userName eq "alice" or userName eq "bob") and title pr`, false},
+		{`displayName ne "Carol"`, false},
+	}
+	for _, test := range tests {
+		filter, err := parseScimFilter(test.filter)
+		if err != nil {
+			t.Errorf("filter %q failed to parse: %v", test.filter, err)
+			continue
+		}
+		if filter(user) != test.match {
+			t.Errorf("filter %q: expected %v", test.filter, test.match)
+		}
+	}
+
+	for _, invalid := range []string{`userName eq`, `userName xx "a"`, `phone eq "1"`, `(userName pr`, `userName eq "a`} {
+		if _, err := parseScimFilter(invalid); err == nil {
+			t.Errorf("filter %q must be invalid", invalid)
+		}
+	}
+}
+
+func TestScimListUsers(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	var list scimListResponse
+	code := doScimRequest(t, "GET", server.URL+`/scim/v2/Users?filter=title+eq+"engineer"&startIndex=2&count=5`, nil, &list)
+	if code != http.StatusOK || list.TotalResults != 2 || list.ItemsPerPage != 1 || list.Resources[0].ID != "4" {
+		t.Errorf("unexpected list response %d %+v", code, list)
+	}
+
+	var scimErr scimError
+	code = doScimRequest(t, "GET", server.URL+`/scim/v2/Users?filter=title+eq`, nil, &scimErr)
+	if code != http.StatusBadRequest || scimErr.ScimType != "invalidFilter" {
+		t.Errorf("unexpected error response %d %+v", code, scimErr)
+	}
+}
+
+func TestScimUserLifecycle(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	created := &scimUser{
+		Schemas:    []string{scimUserSchema, scimEnterpriseSchema},
+		UserName:   "Dave",
+		Emails:     []scimEmail{{Value: "dave@bureaucr.at", Primary: true}},
+		Enterprise: &scimEnterpriseUser{Manager: &scimManager{Value: "3"}},
+	}
+	var user scimUser
+	if code := doScimRequest(t, "POST", server.URL+scimUsersPath, created, &user); code != http.StatusCreated {
+		t.Fatalf("create failed with %d", code)
+	}
+	if user.ID != "5" || user.Enterprise.Manager.DisplayName != "Bob" {
+		t.Errorf("unexpected created user %+v", user)
+	}
+
+	patch := map[string]interface{}{
+		"schemas": []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "path": "title", "value": "Engineer"},
+			{"op": "replace", "path": scimEnterpriseSchema + ":manager", "value": "2"},
+		},
+	}
+	if code := doScimRequest(t, "PATCH", server.URL+scimUsersPath+"/5", patch, &user); code != http.StatusOK {
+		t.Fatalf("patch failed with %d", code)
+	}
+	if user.Title != "Engineer" || user.Enterprise.Manager.Value != "2" || user.Emails[0].Value != "dave@bureaucr.at" {
+		t.Errorf("unexpected patched user %+v", user)
+	}
+
+	// Moving a manager under his/her own report must be rejected
+	replaced := &scimUser{UserName: "Alice", Enterprise: &scimEnterpriseUser{Manager: &scimManager{Value: "5"}}}
+	var scimErr scimError
+	if code := doScimRequest(t, "PUT", server.URL+scimUsersPath+"/2", replaced, &scimErr); code != http.StatusBadRequest {
+		t.Errorf("cycle was not rejected, status %d", code)
+	}
+
+	if code := doScimRequest(t, "DELETE", server.URL+scimUsersPath+"/5", nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete failed with %d", code)
+	}
+	if code := doScimRequest(t, "GET", server.URL+scimUsersPath+"/5", nil, &scimErr); code != http.StatusNotFound {
+		t.Errorf("deleted user is still present, status %d", code)
+	}
+}
+
+func TestScimUserNameIsKept(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	created := &scimUser{
+		Schemas:     []string{scimUserSchema, scimEnterpriseSchema},
+		UserName:    "jdoe",
+		DisplayName: "Jane Doe",
+		Enterprise:  &scimEnterpriseUser{Manager: &scimManager{Value: "3"}},
+	}
+	var user scimUser
+	if code := doScimRequest(t, "POST", server.URL+scimUsersPath, created, &user); code != http.StatusCreated {
+		t.Fatalf("create failed with %d", code)
+	}
+	if user.UserName != "jdoe" || user.DisplayName != "Jane Doe" || user.Meta.Version != etag(2) {
+		t.Errorf("unexpected created user %+v %+v", user, user.Meta)
+	}
+
+	var list scimListResponse
+	doScimRequest(t, "GET", server.URL+scimUsersPath+`?filter=userName+eq+"jdoe"`, nil, &list)
+	if list.TotalResults != 1 || list.Resources[0].ID != user.ID || list.Resources[0].Meta.Version != etag(2) {
+		t.Errorf("user was not found by userName: %+v", list)
+	}
+
+	// userName is an attribute of its own, not a custom one
+	var res GetEmployeeResponse
+	resp, err := http.Get(server.URL + "/employees/" + user.ID)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if res.Employee == nil || res.Employee.UserName != "jdoe" || res.Employee.Custom != nil {
+		t.Errorf("unexpected employee %+v", res.Employee)
+	}
+
+	// Renaming keeps userName and the other way round
+	patch := map[string]interface{}{
+		"schemas":    []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "displayName", "value": "Jane Smith"}},
+	}
+	doScimRequest(t, "PATCH", server.URL+scimUsersPath+"/"+user.ID, patch, &user)
+	if user.UserName != "jdoe" || user.DisplayName != "Jane Smith" {
+		t.Errorf("unexpected patched user %+v", user)
+	}
+	patch["Operations"] = []map[string]interface{}{{"op": "replace", "path": "userName", "value": "jsmith"}}
+	doScimRequest(t, "PATCH", server.URL+scimUsersPath+"/"+user.ID, patch, &user)
+	if user.UserName != "jsmith" || user.DisplayName != "Jane Smith" {
+		t.Errorf("unexpected patched user %+v", user)
+	}
+}
+
+func TestScimServiceProviderConfig(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	var config map[string]interface{}
+	if code := doScimRequest(t, "GET", server.URL+"/scim/v2/ServiceProviderConfig", nil, &config); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	patch, _ := config["patch"].(map[string]interface{})
+	etags, _ := config["etag"].(map[string]interface{})
+	if patch["supported"] != true || etags["supported"] != true {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestScimConditionalUpdates(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	do := func(method, path, ifMatch string, body interface{}) *http.Response {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", scimContentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := do("GET", scimUsersPath+"/4", "", nil)
+	first := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || first == "" {
+		t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	patch := map[string]interface{}{
+		"schemas":    []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "title", "value": "Engineer"}},
+	}
+	resp = do("PATCH", scimUsersPath+"/4", first, patch)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag(2) {
+		t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Lost update of a client still at the first version
+	replaced := &scimUser{UserName: "Carol", Enterprise: &scimEnterpriseUser{Manager: &scimManager{Value: "3"}}}
+	if resp := do("PUT", scimUsersPath+"/4", first, replaced); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale PUT was not rejected, status %d", resp.StatusCode)
+	}
+	if resp := do("DELETE", scimUsersPath+"/4", first, nil); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale DELETE was not rejected, status %d", resp.StatusCode)
+	}
+	if resp := do("PUT", scimUsersPath+"/4", etag(2), replaced); resp.StatusCode != http.StatusOK {
+		t.Errorf("PUT failed with %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+scimUsersPath+"/4", nil)
+	req.Header.Set("If-None-Match", etag(3))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,231 @@
+package transport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"corporate-directory/pkg/pb"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+//
+// Setup bodies are decoded while they are read, so the raw body is never held in memory. The usual {"employees": [...]}
+// document and NDJSON with one employee per line are accepted, as well as the document in MessagePack and
+// pb.SetupRequest in protobuf, which is read as a whole. Any of them may be gzip compressed, the size limit applies to
+// the decompressed body, so a small compressed one can't expand unbounded.
+//
+
+const ndjsonContentType = "application/x-ndjson"
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// Reader failing with errBodyTooLarge once more than n bytes are read
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// Setup bodies are read up to maxBytes, so a huge org can't exhaust memory before it's even parsed
+func makeDecodeSetupRequest(maxBytes int64) httptransport.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var body io.Reader = r.Body
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			compressed, err := gzip.NewReader(r.Body)
+			if err != nil {
+				return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+			}
+			defer compressed.Close()
+			body = compressed
+		default:
+			return nil, newApiError(http.StatusUnsupportedMediaType, codeUnknownEncoding,
+				fmt.Sprintf("content encoding %q is not supported, use gzip or none", encoding), nil)
+		}
+		body = &limitedBody{r: body, n: maxBytes}
+
+		var employees []*service.Employee
+		var err error
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if alias, ok := contentTypeAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		switch mediaType {
+		case ndjsonContentType:
+			employees, err = decodeEmployeeLines(body)
+		case msgpackContentType:
+			employees, err = decodeMsgpackEmployees(body)
+		case protobufContentType:
+			employees, err = decodePbEmployees(body)
+		default:
+			employees, err = decodeEmployeesDocument(body)
+		}
+		if err == errBodyTooLarge {
+			return nil, newApiError(http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", maxBytes), nil)
+		}
+		if err != nil {
+			return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+		}
+		return SetupRequest{Employees: employees}, nil
+	}
+}
+
+// Employees of the {"employees": [...]} document in MessagePack
+func decodeMsgpackEmployees(body io.Reader) ([]*service.Employee, error) {
+	reader := bufio.NewReader(body)
+	var request SetupRequest
+	if err := msgpack.NewDecoder(reader).UseJSONTag(true).Decode(&request); err != nil {
+		return nil, err
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return nil, trailingDataError(err)
+	}
+	for idx, employee := range request.Employees {
+		if employee == nil {
+			return nil, fmt.Errorf("employee %d: nil is not an employee", idx+1)
+		}
+	}
+	return request.Employees, nil
+}
+
+// Employees of a pb.SetupRequest, protobuf can't be decoded incrementally so the body is read first
+func decodePbEmployees(body io.Reader) ([]*service.Employee, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var request pb.SetupRequest
+	if err := proto.Unmarshal(data, &request); err != nil {
+		return nil, err
+	}
+	employees := make([]*service.Employee, len(request.Employees))
+	for idx, employee := range request.Employees {
+		employees[idx] = fromPbEmployee(employee)
+	}
+	return employees, nil
+}
+
+// Employees of NDJSON, blank lines are skipped
+func decodeEmployeeLines(body io.Reader) ([]*service.Employee, error) {
+	var employees []*service.Employee
+	decoder := json.NewDecoder(body)
+	for {
+		var employee *service.Employee
+		if err := decoder.Decode(&employee); err == io.EOF {
+			return employees, nil
+		} else if err != nil {
+			return nil, annotateEmployeeError(err, len(employees)+1)
+		}
+		if employee == nil {
+			return nil, fmt.Errorf("employee %d: null is not an employee", len(employees)+1)
+		}
+		employees = append(employees, employee)
+	}
+}
+
+// Employees of {"employees": [...]}, decoded element by element. Other members are skipped as by json.Unmarshal
+func decodeEmployeesDocument(body io.Reader) ([]*service.Employee, error) {
+	var employees []*service.Employee
+	decoder := json.NewDecoder(body)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := token.(string); !strings.EqualFold(key, "employees") {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		employees = employees[:0]
+		if token, err := decoder.Token(); err != nil {
+			return nil, err
+		} else if token == nil {
+			continue
+		} else if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, errors.New("employees must be an array")
+		}
+		for decoder.More() {
+			var employee *service.Employee
+			if err := decoder.Decode(&employee); err != nil {
+				return nil, annotateEmployeeError(err, len(employees)+1)
+			}
+			if employee == nil {
+				return nil, fmt.Errorf("employee %d: null is not an employee", len(employees)+1)
+			}
+			employees = append(employees, employee)
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, trailingDataError(err)
+	}
+	return employees, nil
+}
+
+// Error of reading past the end of a document, which should have failed with io.EOF
+func trailingDataError(err error) error {
+	if err == nil {
+		return errors.New("unexpected data after the document")
+	}
+	return err
+}
+
+func expectDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %q, got %v", expected, token)
+	}
+	return nil
+}
+
+// Number the employee that failed to decode, unless the body was too large
+func annotateEmployeeError(err error, number int) error {
+	if err == errBodyTooLarge {
+		return err
+	}
+	return fmt.Errorf("employee %d: %v", number, err)
+}
@@ -0,0 +1,214 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"corporate-directory/pkg/audit"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/pb"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gzipped(data string) string {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, _ = writer.Write([]byte(data))
+	_ = writer.Close()
+	return buf.String()
+}
+
+func TestSetupFormats(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxSetupBodyBytes = 256
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := httptest.NewServer(SetupHttpTransport(svc, cfg).Handler)
+	defer server.Close()
+
+	// Alice's attributes must survive every format
+	alice := `{"id": 2, "name": "Alice", "manager_id": 1, "phone": "555-0102", "custom": {"department": "eng"}}`
+	lines := "{\"id\": 1, \"name\": \"Claire\"}\n\n" + alice + "\n"
+	document := `{"version": 1, "employees": [{"id": 1, "name": "Claire"}, ` + alice + `]}`
+	var packed bytes.Buffer
+	_ = msgpack.NewEncoder(&packed).UseJSONTag(true).Encode(SetupRequest{Employees: []*service.Employee{
+		{ID: 1, Name: "Claire"},
+		{ID: 2, Name: "Alice", ManagerID: intPtr(1), Phone: "555-0102", Custom: map[string]string{"department": "eng"}},
+	}})
+	var nilPacked bytes.Buffer
+	_ = msgpack.NewEncoder(&nilPacked).UseJSONTag(true).Encode(SetupRequest{Employees: []*service.Employee{nil}})
+	message, _ := proto.Marshal(&pb.SetupRequest{Employees: []*pb.Employee{
+		{Id: 1, Name: "Claire"},
+		{Id: 2, Name: "Alice", Manager: &pb.Employee_ManagerId{ManagerId: 1}, Phone: "555-0102",
+			Custom: map[string]string{"department": "eng"}},
+	}})
+	large := strings.Repeat(`{"id": 1, "name": "Claire"}`+"\n", 10)
+	for _, test := range []struct {
+		contentType string
+		encoding    string
+		body        string
+		status      int
+		code        string
+	}{
+		{ndjsonContentType, "", lines, http.StatusOK, ""},
+		{ndjsonContentType + "; charset=utf-8", "gzip", gzipped(lines), http.StatusOK, ""},
+		{"application/json", "", document, http.StatusOK, ""},
+		{"application/json", "gzip", gzipped(document), http.StatusOK, ""},
+		{"application/x-msgpack", "", packed.String(), http.StatusOK, ""},
+		{protobufContentType, "gzip", gzipped(string(message)), http.StatusOK, ""},
+		{protobufContentType, "", "not protobuf", http.StatusBadRequest, codeMalformedBody},
+		{ndjsonContentType, "", "{\"id\": 1}\n{\"id\": \"x\"}\n", http.StatusBadRequest, codeMalformedBody},
+		{ndjsonContentType, "", "{\"id\": 1}\nnull\n", http.StatusBadRequest, codeMalformedBody},
+		{"application/json", "", `{"employees": {}}`, http.StatusBadRequest, codeMalformedBody},
+		{"application/json", "", `{"employees": [{"id": 1, "name": "Claire"}, null]}`, http.StatusBadRequest,
+			codeMalformedBody},
+		{msgpackContentType, "", nilPacked.String(), http.StatusBadRequest, codeMalformedBody},
+		{"application/json", "", `{"employees": [`, http.StatusBadRequest, codeMalformedBody},
+		{"application/json", "", document + `{}`, http.StatusBadRequest, codeMalformedBody},
+		{"application/json", "gzip", document, http.StatusBadRequest, codeMalformedBody},
+		{"application/json", "br", document, http.StatusUnsupportedMediaType, codeUnknownEncoding},
+		// The limit applies to the decompressed body
+		{ndjsonContentType, "gzip", gzipped(large), http.StatusRequestEntityTooLarge, codeBodyTooLarge},
+		{msgpackContentType, "", packed.String() + "trailing", http.StatusBadRequest, codeMalformedBody},
+	} {
+		req, _ := http.NewRequest("POST", server.URL+"/setup", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		if test.encoding != "" {
+			req.Header.Set("Content-Encoding", test.encoding)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var response ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if resp.StatusCode != test.status ||
+			(test.code != "" && (response.Error == nil || response.Error.Code != test.code)) {
+			t.Errorf("%s %s %q: expected %d %s, got %d %+v", test.contentType, test.encoding, test.body,
+				test.status, test.code, resp.StatusCode, response.Error)
+		}
+		if test.status == http.StatusOK {
+			employee, err := svc.GetEmployee(context.Background(), 2)
+			if err != nil || *employee.ManagerID != 1 || employee.Phone != "555-0102" ||
+				employee.Custom["department"] != "eng" {
+				t.Errorf("%s %s: unexpected employee %+v %v", test.contentType, test.encoding, employee, err)
+			}
+		}
+	}
+
+	// And protobuf responses
+	req, _ := http.NewRequest("GET", server.URL+"/employees/2", nil)
+	req.Header.Set("Accept", protobufContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	var response pb.GetEmployeeResponse
+	if err := proto.Unmarshal(data, &response); err != nil || response.Employee.Phone != "555-0102" ||
+		response.Employee.Custom["department"] != "eng" {
+		t.Errorf("unexpected protobuf response %+v %v", response.Employee, err)
+	}
+}
+
+// Org of Claire and employees reporting to her, each manager has ten reports
+func generateOrg(size int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"id":1,"name":"Claire"}` + "\n")
+	for id := 2; id <= size; id++ {
+		buf.WriteString(`{"id":` + strconv.Itoa(id) + `,"name":"Employee ` + strconv.Itoa(id) +
+			`","manager_id":` + strconv.Itoa((id-2)/10+1) + "}\n")
+	}
+	return buf.Bytes()
+}
+
+// Largest heap in use while run is running, sampled every few milliseconds
+func peakHeap(run func()) uint64 {
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var max uint64
+		var stats runtime.MemStats
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > max {
+				max = stats.HeapInuse
+			}
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	run()
+	close(done)
+	return <-peak
+}
+
+// Setup of a large org through the handler and the service decorators the server runs with, reporting the peak heap
+func BenchmarkSetupNdjson(b *testing.B) {
+	dir, err := ioutil.TempDir("", "setup")
+	if err != nil {
+		b.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"), 0)
+	if err != nil {
+		b.Fatalf("failed to open log: %v", err)
+	}
+	defer auditLog.Close()
+
+	var svc service.CorporateDirectory = service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	svc = service.InstrumentingMiddleware(discard.NewHistogram())(svc)
+	svc = service.LoggingMiddleware(log.NewNopLogger())(svc)
+	svc = audit.Middleware(auditLog, log.NewNopLogger())(svc)
+	svc = events.Middleware(events.NewStream(16))(svc)
+	svc = service.TracingMiddleware()(svc)
+	middlewares := []Middleware{
+		LoggingMiddleware(log.NewNopLogger()),
+		InstrumentingMiddleware(discard.NewCounter(), discard.NewCounter(), discard.NewHistogram()),
+	}
+	body := generateOrg(1000000)
+	cfg := config.Default()
+	cfg.MaxSetupBodyBytes = int64(len(body))
+	handler := SetupHttpTransport(svc, cfg, WithMiddlewares(middlewares...)).Handler
+
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	runtime.GC()
+	b.ResetTimer()
+	peak := peakHeap(func() {
+		for i := 0; i < b.N; i++ {
+			req := httptest.NewRequest("POST", "/setup", bytes.NewReader(body))
+			req.Header.Set("Content-Type", ndjsonContentType)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Fatalf("setup failed with %d: %s", w.Code, w.Body)
+			}
+		}
+	})
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+}
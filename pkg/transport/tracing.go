@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/trace"
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+//
+// Tracing of requests. Every HTTP request gets a span continuing the trace of the caller's traceparent header, with
+// decoding, the endpoint and encoding traced as its children. gRPC calls read traceparent from metadata.
+//
+
+// Probes and metrics are scraped periodically and would only drown real requests
+var untracedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// Response writer remembering status code for the request span
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if untracedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if parent, ok := trace.ParseTraceparent(r.Header.Get(trace.TraceparentHeader)); ok {
+			ctx = trace.ContextWithRemoteParent(ctx, parent)
+		}
+		ctx, span := trace.Start(ctx, "http.request")
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.path", r.URL.Path)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", recorder.status)
+	})
+}
+
+// Unary interceptor continuing the trace of the caller's traceparent metadata, the counterpart of withTracing
+func grpcTracing(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(trace.TraceparentHeader); len(values) > 0 {
+			if parent, ok := trace.ParseTraceparent(values[0]); ok {
+				ctx = trace.ContextWithRemoteParent(ctx, parent)
+			}
+		}
+	}
+	ctx, span := trace.Start(ctx, "grpc.request")
+	defer span.End()
+	span.SetAttribute("grpc.method", info.FullMethod)
+	res, err := handler(ctx, req)
+	span.SetError(err)
+	return res, err
+}
+
+// Endpoint span, innermost so it measures the endpoint itself and not other middlewares
+func traceEndpoint(method string, next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := trace.Start(ctx, "endpoint."+method)
+		defer span.End()
+		response, err := next(ctx, request)
+		span.SetError(err)
+		return response, err
+	}
+}
+
+// HTTP server with traced decoder and encoder
+func newHttpServer(e endpoint.Endpoint, dec httptransport.DecodeRequestFunc, enc httptransport.EncodeResponseFunc,
+	options ...httptransport.ServerOption) *httptransport.Server {
+	tracedDec := func(ctx context.Context, r *http.Request) (interface{}, error) {
+		ctx, span := trace.Start(ctx, "http.decode")
+		defer span.End()
+		request, err := dec(ctx, r)
+		span.SetError(err)
+		return request, err
+	}
+	tracedEnc := func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		ctx, span := trace.Start(ctx, "http.encode")
+		defer span.End()
+		err := enc(ctx, w, response)
+		span.SetError(err)
+		return err
+	}
+	return httptransport.NewServer(e, tracedDec, tracedEnc, options...)
+}
+
+// gRPC handler with traced decoder and encoder
+func newGrpcServer(e endpoint.Endpoint, dec grpctransport.DecodeRequestFunc, enc grpctransport.EncodeResponseFunc,
+	options ...grpctransport.ServerOption) *grpctransport.Server {
+	tracedDec := func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, span := trace.Start(ctx, "grpc.decode")
+		defer span.End()
+		decoded, err := dec(ctx, request)
+		span.SetError(err)
+		return decoded, err
+	}
+	tracedEnc := func(ctx context.Context, response interface{}) (interface{}, error) {
+		ctx, span := trace.Start(ctx, "grpc.encode")
+		defer span.End()
+		encoded, err := enc(ctx, response)
+		span.SetError(err)
+		return encoded, err
+	}
+	return grpctransport.NewServer(e, tracedDec, tracedEnc, options...)
+}
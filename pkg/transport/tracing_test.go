@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/trace"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	trace.SetExporter(exporter)
+	defer trace.SetExporter(nil)
+
+	svc := service.TracingMiddleware()(service.NewCorporateDirectoryService(lca.NewOnlineLCASolver))
+	server := httptest.NewServer(SetupHttpTransport(svc, config.Default()).Handler)
+	defer server.Close()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	remote, _ := trace.ParseTraceparent(traceparent)
+	body := `{"employees": [{"id": 1, "name": "Claire"}, {"id": 2, "name": "Alice", "manager_id": 1}]}`
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", server.URL+"/setup", strings.NewReader(body)),
+		httptest.NewRequest("GET", server.URL+"/common?first=1&second=2", nil),
+		httptest.NewRequest("GET", server.URL+"/healthz", nil),
+	} {
+		req.RequestURI = ""
+		req.Header.Set(trace.TraceparentHeader, traceparent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	spans := make(map[string]trace.SpanData)
+	for _, span := range exporter.Spans() {
+		if span.TraceID != remote.TraceID {
+			t.Errorf("span %s doesn't continue the caller's trace", span.Name)
+		}
+		if _, ok := spans[span.Name]; !ok {
+			spans[span.Name] = span
+		}
+	}
+	parents := map[string]string{
+		"http.decode":              "http.request",
+		"endpoint.setup":           "http.request",
+		"http.encode":              "http.request",
+		"service.Setup":            "endpoint.setup",
+		"service.setupMutex.wait":  "service.Setup",
+		"solver.Setup":             "service.Setup",
+		"service.GetCommonManager": "endpoint.common_manager",
+		"solver.SolveLCA":          "service.GetCommonManager",
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("span %s is missing", name)
+			continue
+		}
+		if span.ParentID != spans[parent].SpanID {
+			t.Errorf("span %s is not a child of %s", name, parent)
+		}
+	}
+	request := spans["http.request"]
+	if request.ParentID != remote.SpanID || request.Attributes["http.status_code"] != 200 {
+		t.Errorf("unexpected request span %+v", request)
+	}
+	if len(exporter.Spans()) != 7+6 {
+		t.Errorf("expected spans of setup and common manager only, got %d", len(exporter.Spans()))
+	}
+}
@@ -2,121 +2,169 @@ package transport
 
 import (
 	"context"
+	"corporate-directory/pkg/audit"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/policy"
 	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/webhook"
 	"encoding/json"
-	"errors"
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
 	"strconv"
-	"time"
 )
 
 //
 // Transport structures and functions responsible for request / response serialization
 //
 
-type setupRequest struct {
+type SetupRequest struct {
 	Employees []*service.Employee `json:"employees"`
 }
 
-type setupResponse struct {
-	Error string `json:"error,omitempty"`
-}
+type SetupResponse struct{}
 
-type commonManagerRequest struct {
+type CommonManagerRequest struct {
 	First  int `json:"first"`
 	Second int `json:"second"`
 }
 
-type commonManagerResponse struct {
+type CommonManagerResponse struct {
 	Common *service.Employee `json:"common,omitempty"`
-	Error  string            `json:"error,omitempty"`
 }
 
-type getEmployeeRequest struct {
-	Id int `json:"first"`
+type GetEmployeeRequest struct {
+	Id int `json:"id"`
 }
 
-type getEmployeeResponse struct {
+type GetEmployeeResponse struct {
 	Employee *service.Employee `json:"employee,omitempty"`
-	Error    string            `json:"error,omitempty"`
 }
 
-type getEmployeesResponse struct {
+type GetEmployeesResponse struct {
 	Employees []*service.Employee `json:"employees"`
-	Error     string              `json:"error,omitempty"`
+	// Cursor of the next page, empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Body of add and update requests is the employee itself, for updates ID is taken from the path
+type AddEmployeeRequest struct {
+	Employee *service.Employee
+}
+
+type UpdateEmployeeRequest struct {
+	Employee *service.Employee
+}
+
+type RemoveEmployeeRequest struct {
+	Id int `json:"id"`
 }
 
+type RemoveEmployeeResponse struct{}
+
 func makeSetupEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		req := request.(setupRequest)
-		err := svc.Setup(req.Employees)
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SetupRequest)
+		// Employees were decoded for this request alone
+		err := svc.Setup(service.NewHandOverContext(ctx), req.Employees)
 		if err != nil {
-			return setupResponse{err.Error()}, nil
+			return nil, err
 		}
-		return setupResponse{""}, nil
+		return SetupResponse{}, nil
 	}
 }
 
 func makeCommonManagerEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		req := request.(commonManagerRequest)
-		res, err := svc.GetCommonManager(req.First, req.Second)
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(CommonManagerRequest)
+		res, err := svc.GetCommonManager(ctx, req.First, req.Second)
 		if err != nil {
-			return commonManagerResponse{Common: nil, Error: err.Error()}, nil
+			return nil, err
 		}
-		return commonManagerResponse{Common: res, Error: ""}, nil
+		return CommonManagerResponse{Common: res}, nil
 	}
 }
 
 func makeGetEmployeeEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		req := request.(getEmployeeRequest)
-		res, err := svc.GetEmployee(req.Id)
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(GetEmployeeRequest)
+		res, err := svc.GetEmployee(ctx, req.Id)
 		if err != nil {
-			return getEmployeeResponse{Employee: nil, Error: err.Error()}, nil
+			return nil, err
 		}
-		return getEmployeeResponse{Employee: res, Error: ""}, nil
+		return GetEmployeeResponse{Employee: res}, nil
 	}
 }
 
 func makeGetEmployeesEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		res, err := svc.GetEmployees()
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if req, ok := request.(GetEmployeesRequest); ok {
+			page, err := svc.ListEmployees(ctx, req.query())
+			if err != nil {
+				return nil, err
+			}
+			return listResponse(req, page), nil
+		}
+		res, err := svc.GetEmployees(ctx)
 		if err != nil {
-			return getEmployeesResponse{Employees: nil, Error: err.Error()}, nil
+			return nil, err
 		}
-		return getEmployeesResponse{Employees: res, Error: ""}, nil
+		return GetEmployeesResponse{Employees: res}, nil
 	}
 }
 
-func decodeSetupRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var request setupRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		return nil, err
+func makeAddEmployeeEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(AddEmployeeRequest)
+		res, err := svc.AddEmployee(ctx, req.Employee)
+		if err != nil {
+			return nil, err
+		}
+		return GetEmployeeResponse{Employee: res}, nil
+	}
+}
+
+func makeUpdateEmployeeEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(UpdateEmployeeRequest)
+		res, err := svc.UpdateEmployee(ctx, req.Employee)
+		if err != nil {
+			return nil, err
+		}
+		return GetEmployeeResponse{Employee: res}, nil
+	}
+}
+
+func makeRemoveEmployeeEndpoint(svc service.CorporateDirectory) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RemoveEmployeeRequest)
+		if err := svc.RemoveEmployee(ctx, req.Id); err != nil {
+			return nil, err
+		}
+		return RemoveEmployeeResponse{}, nil
 	}
-	return request, nil
 }
 
 func decodeCommonManagerRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var request commonManagerRequest
+	var request CommonManagerRequest
 	firstStr, ok := r.URL.Query()["first"]
 	if !ok {
-		return nil, errors.New(`'first' query param is missing`)
+		return nil, newParameterError(codeMissingParameter, "first", `'first' query param is missing`)
 	}
 	secondStr, ok := r.URL.Query()["second"]
 	if !ok {
-		return nil, errors.New(`'second' query param is missing`)
+		return nil, newParameterError(codeMissingParameter, "second", `'second' query param is missing`)
 	}
 	first, err := strconv.Atoi(firstStr[0])
 	if err != nil {
-		return nil, errors.New(`first must be an integer`)
+		return nil, newParameterError(codeInvalidParameter, "first", `first must be an integer`)
 	}
 	second, err := strconv.Atoi(secondStr[0])
 	if err != nil {
-		return nil, errors.New(`second must be an integer`)
+		return nil, newParameterError(codeInvalidParameter, "second", `second must be an integer`)
 	}
 	request.First = first
 	request.Second = second
@@ -125,49 +173,173 @@ func decodeCommonManagerRequest(_ context.Context, r *http.Request) (interface{}
 }
 
 func decodeGetEmployeeRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var request getEmployeeRequest
-	params := httprouter.ParamsFromContext(r.Context())
-	idStr := params.ByName("id")
-	id, err := strconv.Atoi(idStr)
+	var request GetEmployeeRequest
+	id, err := decodeIdParam(r)
 	if err != nil {
-		return nil, errors.New(`id must be an integer`)
+		return nil, err
 	}
 	request.Id = id
 	return request, nil
 }
 
-func decodeGetEmployeesRequest(_ context.Context, _ *http.Request) (interface{}, error) {
-	return nil, nil
+func decodeAddEmployeeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var employee service.Employee
+	if err := json.NewDecoder(r.Body).Decode(&employee); err != nil {
+		return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+	}
+	return AddEmployeeRequest{Employee: &employee}, nil
 }
 
-func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
-	return json.NewEncoder(w).Encode(response)
+func decodeUpdateEmployeeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeIdParam(r)
+	if err != nil {
+		return nil, err
+	}
+	var employee service.Employee
+	if err := json.NewDecoder(r.Body).Decode(&employee); err != nil {
+		return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+	}
+	employee.ID = id
+	return UpdateEmployeeRequest{Employee: &employee}, nil
 }
 
-// Function to set up all endpoints, encoders, router and HTTP server to serve requests.
-func SetupHttpTransport(svc service.CorporateDirectory) *http.Server {
-	setup := makeSetupEndpoint(svc)
-	setupHandler := httptransport.NewServer(setup, decodeSetupRequest, encodeResponse)
+func decodeRemoveEmployeeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeIdParam(r)
+	if err != nil {
+		return nil, err
+	}
+	return RemoveEmployeeRequest{Id: id}, nil
+}
+
+// Employee ID from the :id path segment
+func decodeIdParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		return 0, newParameterError(codeInvalidParameter, "id", `id must be an integer`)
+	}
+	return id, nil
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if _, ok := response.(notModifiedResponse); ok {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return writeResponse(ctx, w, http.StatusOK, response)
+}
+
+type httpOptions struct {
+	middlewares []Middleware
+	auditLog    *audit.Log
+	webhooks    *webhook.Dispatcher
+	eventStream *events.Stream
+	visibility  *policy.Policy
+}
+
+type Option func(*httpOptions)
 
-	common := makeCommonManagerEndpoint(svc)
-	commonHandler := httptransport.NewServer(common, decodeCommonManagerRequest, encodeResponse)
+// Middlewares applied to every endpoint except health probes, the first one being the outermost
+func WithMiddlewares(middlewares ...Middleware) Option {
+	return func(o *httpOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
 
-	one := makeGetEmployeeEndpoint(svc)
-	oneHandler := httptransport.NewServer(one, decodeGetEmployeeRequest, encodeResponse)
+// Function to set up all endpoints, encoders, router and HTTP server to serve requests
+func SetupHttpTransport(svc service.CorporateDirectory, cfg *config.Config, opts ...Option) *http.Server {
+	var o httpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	middlewares := o.middlewares
 
-	all := makeGetEmployeesEndpoint(svc)
-	allHandler := httptransport.NewServer(all, decodeGetEmployeesRequest, encodeResponse)
+	options := []httptransport.ServerOption{
+		httptransport.ServerBefore(httpCredentials, httpSource, httpConditions, httpNegotiation),
+		httptransport.ServerAfter(httpVersionHeaders),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	setup := chainMiddlewares("setup", versionedWrite(svc, makeSetupEndpoint(svc)), middlewares)
+	setupHandler := newHttpServer(setup, makeDecodeSetupRequest(cfg.MaxSetupBodyBytes), encodeResponse,
+		options...)
+
+	common := chainMiddlewares("common_manager", versionedRead(svc, makeCommonManagerEndpoint(svc)), middlewares)
+	commonHandler := newHttpServer(common, decodeCommonManagerRequest, encodeResponse, options...)
+
+	batch := chainMiddlewares("common_manager_batch", versionedRead(svc, makeCommonManagerBatchEndpoint(svc)),
+		middlewares)
+	batchHandler := newHttpServer(batch, makeDecodeCommonManagerBatchRequest(cfg.MaxBatchSize), encodeResponse,
+		options...)
+
+	one := chainMiddlewares("get_employee", versionedRead(svc, makeGetEmployeeEndpoint(svc)), middlewares)
+	oneHandler := newHttpServer(one, decodeGetEmployeeRequest, encodeResponse, options...)
+
+	all := chainMiddlewares("get_employees", versionedRead(svc, makeGetEmployeesEndpoint(svc)), middlewares)
+	allHandler := newHttpServer(all, decodeGetEmployeesRequest, encodeResponse, options...)
+
+	add := chainMiddlewares("add_employee", versionedWrite(svc, makeAddEmployeeEndpoint(svc)), middlewares)
+	addHandler := newHttpServer(add, decodeAddEmployeeRequest, encodeResponse, options...)
+
+	update := chainMiddlewares("update_employee", versionedWrite(svc, makeUpdateEmployeeEndpoint(svc)), middlewares)
+	updateHandler := newHttpServer(update, decodeUpdateEmployeeRequest, encodeResponse, options...)
+
+	remove := chainMiddlewares("remove_employee", versionedWrite(svc, makeRemoveEmployeeEndpoint(svc)), middlewares)
+	removeHandler := newHttpServer(remove, decodeRemoveEmployeeRequest, encodeResponse, options...)
+
+	healthHandler := httptransport.NewServer(makeHealthEndpoint(), decodeHealthRequest, encodeResponse, options...)
+	readyHandler := httptransport.NewServer(makeReadyEndpoint(svc), decodeHealthRequest, encodeResponse, options...)
+
+	// Schema is static, so failure to build it is a programming error
+	schema, err := newGraphqlSchema(svc)
+	if err != nil {
+		panic(err)
+	}
+	// Resolvers read the directory one by one, so answers are not attributed to a single version
+	graphql := chainMiddlewares("graphql", makeGraphqlEndpoint(schema), middlewares)
+	graphqlHandler := newHttpServer(graphql, decodeGraphqlRequest, encodeGraphqlResponse, options...)
 
 	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(notFoundHandler)
+	router.MethodNotAllowed = http.HandlerFunc(methodNotAllowedHandler)
 	router.Handler("POST", "/setup", setupHandler)
 	router.Handler("GET", "/common", commonHandler)
+	router.Handler("POST", "/common/batch", batchHandler)
 	router.Handler("GET", "/employees/:id", oneHandler)
 	router.Handler("GET", "/employees", allHandler)
-	return &http.Server{
-		Addr:           ":80",
-		Handler:        router,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+	router.Handler("POST", "/employees", addHandler)
+	router.Handler("PUT", "/employees/:id", updateHandler)
+	router.Handler("DELETE", "/employees/:id", removeHandler)
+	router.Handler("GET", "/healthz", healthHandler)
+	router.Handler("GET", "/readyz", readyHandler)
+	router.Handler("GET", "/metrics", promhttp.Handler())
+	router.Handler("GET", "/graphql", graphqlHandler)
+	router.Handler("POST", "/graphql", graphqlHandler)
+	registerScimRoutes(router, svc, middlewares)
+	if o.auditLog != nil {
+		auditEndpoint := chainMiddlewares("audit", makeAuditEndpoint(o.auditLog), middlewares)
+		router.Handler("GET", "/audit", newHttpServer(auditEndpoint, decodeAuditRequest, encodeResponse, options...))
+	}
+	if o.webhooks != nil {
+		registerWebhookRoutes(router, o.webhooks, middlewares, options)
+	}
+	server := &http.Server{
+		Addr:           cfg.HttpAddr,
+		Handler:        withRequestId(withTracing(router)),
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+	if o.eventStream != nil {
+		// Streams outlive the write timeout, which only bounds their single writes, and end on shutdown, which doesn't
+		// wait for them then
+		eventsEndpoint := chainMiddlewares("events", makeEventsEndpoint(svc, o.eventStream, o.visibility), middlewares)
+		encodeEvents := makeEncodeEventStream(cfg.WriteTimeout)
+		conns := &connections{}
+		server.ConnState = conns.track
+		router.Handler("GET", "/events",
+			conns.withWriteDeadline(newHttpServer(eventsEndpoint, decodeEventsRequest, encodeEvents, options...)))
+		server.RegisterOnShutdown(o.eventStream.Close)
 	}
+	return server
 }
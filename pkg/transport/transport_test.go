@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// Server with a small org, where Carol reports to Alice and Alice and Bob report to Claire
+func setupOrgServer(t *testing.T) *httptest.Server {
+	employees := []*service.Employee{
+		{ID: 1, Name: "Claire", Title: "CEO", Mail: "claire@bureaucr.at"},
+		{ID: 2, Name: "Alice", Title: "Engineer", ManagerID: intPtr(1)},
+		{ID: 3, Name: "Bob", Title: "Sales", ManagerID: intPtr(1)},
+		{ID: 4, Name: "Carol", Title: "Engineer", ManagerID: intPtr(2)},
+	}
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	if err := svc.Setup(context.Background(), employees); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return httptest.NewServer(SetupHttpTransport(svc, config.Default()).Handler)
+}
+
+func TestHttpTransportErrors(t *testing.T) {
+	server := setupOrgServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		method    string
+		path      string
+		body      string
+		status    int
+		code      string
+		parameter string
+	}{
+		{"GET", "/common?first=2&second=3", "", http.StatusOK, "", ""},
+		{"GET", "/common?first=2&second=7", "", http.StatusNotFound, codeEmployeeNotFound, ""},
+		{"GET", "/common?first=2", "", http.StatusBadRequest, codeMissingParameter, "second"},
+		{"GET", "/common?first=x&second=3", "", http.StatusBadRequest, codeInvalidParameter, "first"},
+		{"GET", "/employees/x", "", http.StatusBadRequest, codeInvalidParameter, "id"},
+		{"GET", "/employees/7", "", http.StatusNotFound, codeEmployeeNotFound, ""},
+		{"POST", "/setup", `{"employees": [`, http.StatusBadRequest, codeMalformedBody, ""},
+		{"POST", "/setup", `{"employees": [{"id": 1, "name": "A"}]}`, http.StatusUnprocessableEntity, codeBossNotFound, ""},
+		{"POST", "/setup", `{"employees": [{"id": 1, "name": "Claire", "subordinates": [2]}]}`,
+			http.StatusUnprocessableEntity, codeInvalidEdge, ""},
+		{"POST", "/employees", `{"id": 2, "name": "Dan"}`, http.StatusUnprocessableEntity, codeDuplicateEmployee, ""},
+		{"PUT", "/employees/7", `{"name": "Dan", "manager_id": 1}`, http.StatusNotFound, codeEmployeeNotFound, ""},
+		{"PUT", "/employees/2", `{"name": "Alice", "manager_id": 9}`, http.StatusUnprocessableEntity, codeInvalidEdge, ""},
+		{"DELETE", "/employees/1", "", http.StatusUnprocessableEntity, codeRemoveBoss, ""},
+		{"DELETE", "/employees/x", "", http.StatusBadRequest, codeInvalidParameter, "id"},
+		{"GET", "/unknown", "", http.StatusNotFound, codeRouteNotFound, ""},
+		{"DELETE", "/setup", "", http.StatusMethodNotAllowed, codeMethodNotAllowed, ""},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var body struct {
+			Error *ApiError `json:"error"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("%s %s: response is not json: %v", test.method, test.path, err)
+			continue
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.path, test.status, resp.StatusCode)
+		}
+		if test.code == "" {
+			if body.Error != nil {
+				t.Errorf("%s %s: unexpected error %+v", test.method, test.path, body.Error)
+			}
+			continue
+		}
+		if body.Error == nil || body.Error.Code != test.code || body.Error.Message == "" {
+			t.Errorf("%s %s: unexpected error %+v", test.method, test.path, body.Error)
+			continue
+		}
+		if test.parameter != "" && body.Error.Details["parameter"] != test.parameter {
+			t.Errorf("%s %s: unexpected details %+v", test.method, test.path, body.Error.Details)
+		}
+	}
+}
+
+func TestSetupBodyLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxSetupBodyBytes = 64
+	svc := service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	server := httptest.NewServer(SetupHttpTransport(svc, cfg).Handler)
+	defer server.Close()
+
+	body := `{"employees": [{"id": 1, "name": "Claire"}]}`
+	resp, err := http.Post(server.URL+"/setup", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected small setup to succeed, got %d", resp.StatusCode)
+	}
+
+	body = `{"employees": [{"id": 1, "name": "Claire", "subordinates": [2]}, {"id": 2, "name": "Alice"}]}`
+	resp, err = http.Post(server.URL+"/setup", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var response ErrorResponse
+	_ = json.NewDecoder(resp.Body).Decode(&response)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || response.Error == nil ||
+		response.Error.Code != codeBodyTooLarge {
+		t.Errorf("expected 413 with %s, got %d %+v", codeBodyTooLarge, resp.StatusCode, response.Error)
+	}
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/webhook"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type CreateWebhookRequest struct {
+	URL    string        `json:"url"`
+	Events []events.Type `json:"events,omitempty"`
+	Secret string        `json:"secret,omitempty"`
+}
+
+type WebhookResponse struct {
+	Webhook webhook.Subscription `json:"webhook"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []webhook.Subscription `json:"webhooks"`
+}
+
+type DeleteWebhookRequest struct {
+	Id string
+}
+
+type DeleteWebhookResponse struct{}
+
+type DeadLettersResponse struct {
+	DeadLetters []webhook.DeadLetter `json:"dead_letters"`
+}
+
+// Serve webhook subscriptions from the given dispatcher, admins only as subscriptions see every change
+func WithWebhooks(dispatcher *webhook.Dispatcher) Option {
+	return func(o *httpOptions) {
+		o.webhooks = dispatcher
+	}
+}
+
+func registerWebhookRoutes(router *httprouter.Router, dispatcher *webhook.Dispatcher, middlewares []Middleware,
+	options []httptransport.ServerOption) {
+	create := chainMiddlewares("create_webhook", makeCreateWebhookEndpoint(dispatcher), middlewares)
+	list := chainMiddlewares("list_webhooks", makeListWebhooksEndpoint(dispatcher), middlewares)
+	remove := chainMiddlewares("delete_webhook", makeDeleteWebhookEndpoint(dispatcher), middlewares)
+	deadLetters := chainMiddlewares("webhook_dead_letters", makeDeadLettersEndpoint(dispatcher), middlewares)
+
+	router.Handler("POST", "/webhooks", newHttpServer(create, decodeCreateWebhookRequest, encodeCreated, options...))
+	router.Handler("GET", "/webhooks", newHttpServer(list, decodeNoRequest, encodeResponse, options...))
+	router.Handler("DELETE", "/webhooks/:id",
+		newHttpServer(remove, decodeDeleteWebhookRequest, encodeResponse, options...))
+	router.Handler("GET", "/webhooks/dead-letters",
+		newHttpServer(deadLetters, decodeNoRequest, encodeResponse, options...))
+}
+
+func makeCreateWebhookEndpoint(dispatcher *webhook.Dispatcher) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		req := request.(CreateWebhookRequest)
+		subscription, err := dispatcher.Subscribe(webhook.Subscription{URL: req.URL, Events: req.Events,
+			Secret: req.Secret})
+		if err != nil {
+			return nil, err
+		}
+		return WebhookResponse{Webhook: subscription}, nil
+	}
+}
+
+func makeListWebhooksEndpoint(dispatcher *webhook.Dispatcher) endpoint.Endpoint {
+	return func(_ context.Context, _ interface{}) (interface{}, error) {
+		return WebhooksResponse{Webhooks: dispatcher.Subscriptions()}, nil
+	}
+}
+
+func makeDeleteWebhookEndpoint(dispatcher *webhook.Dispatcher) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		req := request.(DeleteWebhookRequest)
+		if err := dispatcher.Unsubscribe(req.Id); err != nil {
+			return nil, err
+		}
+		return DeleteWebhookResponse{}, nil
+	}
+}
+
+func makeDeadLettersEndpoint(dispatcher *webhook.Dispatcher) endpoint.Endpoint {
+	return func(_ context.Context, _ interface{}) (interface{}, error) {
+		return DeadLettersResponse{DeadLetters: dispatcher.DeadLetters()}, nil
+	}
+}
+
+func decodeCreateWebhookRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, newApiError(http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+	}
+	return request, nil
+}
+
+func decodeDeleteWebhookRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	return DeleteWebhookRequest{Id: params.ByName("id")}, nil
+}
+
+func decodeNoRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+// Same as encodeResponse, with status 201
+func encodeCreated(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	return writeResponse(ctx, w, http.StatusCreated, response)
+}
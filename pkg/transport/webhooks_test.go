@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"corporate-directory/pkg/config"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/lca"
+	"corporate-directory/pkg/service"
+	"corporate-directory/pkg/webhook"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	received := make(chan events.Event, 10)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !webhook.Verify(secret, r.Header.Get(webhook.TimestampHeader), body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Errorf("invalid signature of %s", body)
+		}
+		var event events.Event
+		_ = json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer receiver.Close()
+
+	dispatcher, _ := webhook.NewDispatcher()
+	defer dispatcher.Close()
+	var svc service.CorporateDirectory = service.NewCorporateDirectoryService(lca.NewOnlineLCASolver)
+	svc = events.Middleware(dispatcher)(svc)
+	handler := SetupHttpTransport(svc, config.Default(), WithWebhooks(dispatcher),
+		WithMiddlewares(AuthMiddleware(testAuthenticator()))).Handler
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	do := func(method, path, key, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set(apiKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+	do("POST", "/setup", "admin-key", `{"employees": [{"id": 1, "name": "Claire", "subordinates": [2, 3]},
+		{"id": 2, "name": "Bob"}, {"id": 3, "name": "Alice"}]}`).Body.Close()
+
+	resp := do("POST", "/webhooks", "admin-key", `{"url": "`+receiver.URL+`", "events": ["employee.moved"]}`)
+	var created WebhookResponse
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Webhook.Secret == "" {
+		t.Fatalf("unexpected response %d %+v", resp.StatusCode, created)
+	}
+	secret = created.Webhook.Secret
+
+	do("PUT", "/employees/3", "admin-key", `{"name": "Alice", "manager_id": 2}`).Body.Close()
+	select {
+	case event := <-received:
+		if event.Type != events.EmployeeMoved || event.Employee.ID != 3 || *event.PreviousManagerID != 1 {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event was not delivered")
+	}
+
+	resp = do("GET", "/webhooks", "admin-key", "")
+	var listed WebhooksResponse
+	_ = json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if len(listed.Webhooks) != 1 || listed.Webhooks[0].Secret != "" {
+		t.Errorf("unexpected webhooks %+v", listed)
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		key    string
+		body   string
+		status int
+	}{
+		{"POST", "/webhooks", "admin-key", `{"url": "localhost"}`, http.StatusBadRequest},
+		{"POST", "/webhooks", "admin-key", `{"url": "http://localhost", "events": ["x"]}`, http.StatusBadRequest},
+		{"POST", "/webhooks", "reader-key", `{"url": "http://localhost"}`, http.StatusForbidden},
+		{"GET", "/webhooks/dead-letters", "admin-key", "", http.StatusOK},
+		{"DELETE", "/webhooks/" + created.Webhook.ID, "admin-key", "", http.StatusOK},
+		{"DELETE", "/webhooks/" + created.Webhook.ID, "admin-key", "", http.StatusNotFound},
+	} {
+		resp := do(test.method, test.path, test.key, test.body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"corporate-directory/pkg/events"
+	"corporate-directory/pkg/util"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//
+// Webhook subscriptions receiving change events. Every event is POSTed as JSON to each subscription interested in
+// its type, signed with the subscription's secret. Each subscription has its own queue, so a slow receiver delays
+// only itself and sees events in the order they happened. Failed deliveries are retried with jittered exponential
+// backoff and end up in the dead-letter list once attempts are exhausted.
+//
+
+var (
+	ErrSubscriptionNotFound = errors.New(`webhook subscription with given id was not found`)
+	ErrInvalidUrl           = errors.New(`webhook url must be an absolute http or https url`)
+	ErrUnknownEvent         = errors.New(`unknown event type`)
+)
+
+// Headers of deliveries
+const (
+	EventHeader    = "X-Directory-Event"
+	DeliveryHeader = "X-Directory-Delivery"
+	// Unix time of the attempt, covered by the signature so captured deliveries can't be replayed later
+	TimestampHeader = "X-Directory-Timestamp"
+	// sha256=<hex HMAC-SHA256 of timestamp, a dot and the body>
+	SignatureHeader = "X-Directory-Signature"
+)
+
+const (
+	// Events waiting for a single subscription, more are dead-lettered right away
+	queueSize = 1000
+	// Dead letters kept, oldest are dropped first
+	maxDeadLetters = 1000
+)
+
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Types of events delivered, all when empty
+	Events []events.Type `json:"events,omitempty"`
+	// Key of signatures, generated when not given. Only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event which could not be delivered
+type DeadLetter struct {
+	SubscriptionID string       `json:"subscription_id"`
+	URL            string       `json:"url"`
+	Event          events.Event `json:"event"`
+	Attempts       int          `json:"attempts"`
+	Error          string       `json:"error"`
+	Time           time.Time    `json:"time"`
+}
+
+type Dispatcher struct {
+	mutex       sync.Mutex
+	subscribers map[string]*subscriber
+	deadLetters []DeadLetter
+	// Subscriptions are saved there when not empty
+	path   string
+	client *http.Client
+	// Attempts per event, and bound of the random delay before the second one, doubled for every next one up to
+	// maxBackoff
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	logger     log.Logger
+	workers    sync.WaitGroup
+}
+
+type subscriber struct {
+	Subscription
+	queue chan events.Event
+	// Closed when the subscription is removed or the dispatcher is closed, aborts pending deliveries
+	done chan struct{}
+}
+
+type Option func(*Dispatcher)
+
+// Where subscriptions are saved, so they survive restarts. The file contains secrets and is only readable by owner
+func WithFile(path string) Option {
+	return func(d *Dispatcher) {
+		d.path = path
+	}
+}
+
+// Attempts per event, including the first one
+func WithAttempts(attempts int) Option {
+	return func(d *Dispatcher) {
+		d.attempts = attempts
+	}
+}
+
+// Delay before the first retry, doubled for each next one up to max
+func WithBackoff(initial, max time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff, d.maxBackoff = initial, max
+	}
+}
+
+// Timeout of a single delivery attempt
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.client.Timeout = timeout
+	}
+}
+
+// Logger of failed attempts
+func WithLogger(logger log.Logger) Option {
+	return func(d *Dispatcher) {
+		d.logger = logger
+	}
+}
+
+// NewDispatcher loads saved subscriptions, if any, and starts delivering to them
+func NewDispatcher(options ...Option) (*Dispatcher, error) {
+	d := &Dispatcher{
+		subscribers: make(map[string]*subscriber),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		attempts:    5,
+		backoff:     time.Second,
+		maxBackoff:  5 * time.Minute,
+		logger:      log.NewNopLogger(),
+	}
+	for _, option := range options {
+		option(d)
+	}
+	subscriptions, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, subscription := range subscriptions {
+		d.start(subscription)
+	}
+	return d, nil
+}
+
+// Subscribe validates the subscription, fills in its ID, secret and creation time and starts delivering to it
+func (d *Dispatcher) Subscribe(subscription Subscription) (Subscription, error) {
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || !parsed.IsAbs() || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Subscription{}, ErrInvalidUrl
+	}
+	for _, eventType := range subscription.Events {
+		if !knownType(eventType) {
+			return Subscription{}, ErrUnknownEvent
+		}
+	}
+	subscription.ID = randomHex(8)
+	if subscription.Secret == "" {
+		subscription.Secret = randomHex(32)
+	}
+	subscription.CreatedAt = time.Now().UTC()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.start(subscription)
+	if err := d.save(); err != nil {
+		d.stop(subscription.ID)
+		return Subscription{}, err
+	}
+	return subscription, nil
+}
+
+// Unsubscribe removes the subscription, events still queued for it are dropped
+func (d *Dispatcher) Unsubscribe(id string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.subscribers[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+	d.stop(id)
+	return d.save()
+}
+
+// Subscriptions ordered by creation, without secrets
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	subscriptions := d.subscriptions()
+	for idx := range subscriptions {
+		subscriptions[idx].Secret = ""
+	}
+	return subscriptions
+}
+
+// Events which could not be delivered, oldest first
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]DeadLetter{}, d.deadLetters...)
+}
+
+// Publish queues events for every subscription interested in them
+func (d *Dispatcher) Publish(published []events.Event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, sub := range d.subscribers {
+		for _, event := range published {
+			if !sub.wants(event.Type) {
+				continue
+			}
+			select {
+			case sub.queue <- event:
+			default:
+				d.deadLetter(sub, event, 0, errors.New("delivery queue is full"))
+			}
+		}
+	}
+}
+
+// Close stops deliveries and waits for workers to finish, queued events are dropped
+func (d *Dispatcher) Close() {
+	d.mutex.Lock()
+	for id := range d.subscribers {
+		d.stop(id)
+	}
+	d.mutex.Unlock()
+	d.workers.Wait()
+}
+
+// Sign returns the signature of a delivery, receivers compute the same with their copy of the secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = io.WriteString(mac, timestamp+".")
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks signature of a delivery in constant time
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Start worker of subscription. Must be called with mutex held, except when loading
+func (d *Dispatcher) start(subscription Subscription) {
+	sub := &subscriber{
+		Subscription: subscription,
+		queue:        make(chan events.Event, queueSize),
+		done:         make(chan struct{}),
+	}
+	d.subscribers[subscription.ID] = sub
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		for {
+			select {
+			case event := <-sub.queue:
+				d.deliver(sub, event)
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop worker of subscription. Must be called with mutex held
+func (d *Dispatcher) stop(id string) {
+	close(d.subscribers[id].done)
+	delete(d.subscribers, id)
+}
+
+// Deliver event, retrying until it is accepted, attempts are exhausted or the subscription is stopped
+func (d *Dispatcher) deliver(sub *subscriber, event events.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		d.record(sub, event, 0, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sub.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	delay := d.backoff
+	for attempt := 1; ; attempt++ {
+		err = d.attempt(ctx, sub, event, body)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		_ = d.logger.Log("msg", "webhook delivery failed", "subscription", sub.ID, "event", event.ID,
+			"attempt", attempt, "err", err)
+		if attempt >= d.attempts {
+			d.record(sub, event, attempt, err)
+			return
+		}
+		select {
+		case <-time.After(jitter(delay)):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > d.maxBackoff {
+			delay = d.maxBackoff
+		}
+	}
+}
+
+// Random delay up to bound, so deliveries failing at once, e.g. during an outage of the receiver, don't all retry
+// at once either
+func jitter(bound time.Duration) time.Duration {
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(mrand.Int63n(int64(bound) + 1))
+}
+
+// Single delivery attempt, any 2xx response accepts the event
+func (d *Dispatcher) attempt(ctx context.Context, sub *subscriber, event events.Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event.Type))
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, timestamp, body))
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (d *Dispatcher) record(sub *subscriber, event events.Event, attempts int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.deadLetter(sub, event, attempts, err)
+}
+
+// Must be called with mutex held
+func (d *Dispatcher) deadLetter(sub *subscriber, event events.Event, attempts int, err error) {
+	d.deadLetters = append(d.deadLetters, DeadLetter{
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Event:          event,
+		Attempts:       attempts,
+		Error:          err.Error(),
+		Time:           time.Now().UTC(),
+	})
+	if len(d.deadLetters) > maxDeadLetters {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-maxDeadLetters:]
+	}
+}
+
+// Must be called with mutex held
+func (d *Dispatcher) subscriptions() []Subscription {
+	subscriptions := make([]Subscription, 0, len(d.subscribers))
+	for _, sub := range d.subscribers {
+		subscriptions = append(subscriptions, sub.Subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].ID < subscriptions[j].ID
+		}
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+	return subscriptions
+}
+
+func (d *Dispatcher) load() ([]Subscription, error) {
+	if d.path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subscriptions []Subscription
+	if err := json.Unmarshal(data, &subscriptions); err != nil {
+		return nil, fmt.Errorf("%s: %v", d.path, err)
+	}
+	return subscriptions, nil
+}
+
+// Write subscriptions atomically, so neither a crash nor a power loss leaves a torn file behind. Must be called with
+// mutex held
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(d.subscriptions(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(d.path, data, 0600)
+}
+
+func (sub *subscriber) wants(eventType events.Type) bool {
+	if len(sub.Events) == 0 {
+		return true
+	}
+	for _, wanted := range sub.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func knownType(eventType events.Type) bool {
+	for _, known := range events.Types {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func randomHex(size int) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"corporate-directory/pkg/events"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Receiver recording deliveries, failing the first failures of them
+type receiver struct {
+	mutex      sync.Mutex
+	failures   int
+	deliveries []*http.Request
+	bodies     [][]byte
+	received   chan struct{}
+}
+
+func newReceiver(failures int) (*receiver, *httptest.Server) {
+	r := &receiver{failures: failures, received: make(chan struct{}, 100)}
+	return r, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.mutex.Lock()
+		r.deliveries = append(r.deliveries, req)
+		r.bodies = append(r.bodies, body)
+		fail := len(r.deliveries) <= r.failures
+		r.mutex.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		r.received <- struct{}{}
+	}))
+}
+
+func (r *receiver) wait(t *testing.T, count int) {
+	for i := 0; i < count; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d deliveries, got %d", count, i)
+		}
+	}
+}
+
+func testEvent(eventType events.Type) events.Event {
+	return events.Event{ID: string(eventType) + "-1", Type: eventType, Time: time.Now().UTC()}
+}
+
+func TestDelivery(t *testing.T) {
+	r, server := newReceiver(0)
+	defer server.Close()
+	d, err := NewDispatcher()
+	if err != nil {
+		t.Fatalf("failed to create dispatcher: %v", err)
+	}
+	defer d.Close()
+	sub, err := d.Subscribe(Subscription{URL: server.URL, Events: []events.Type{events.EmployeeMoved}})
+	if err != nil || sub.ID == "" || sub.Secret == "" {
+		t.Fatalf("unexpected subscription %+v %v", sub, err)
+	}
+
+	d.Publish([]events.Event{testEvent(events.EmployeeAdded), testEvent(events.EmployeeMoved)})
+	r.wait(t, 1)
+	req, body := r.deliveries[0], r.bodies[0]
+	if req.Header.Get(EventHeader) != string(events.EmployeeMoved) ||
+		req.Header.Get(DeliveryHeader) != "employee.moved-1" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if !Verify(sub.Secret, req.Header.Get(TimestampHeader), body, req.Header.Get(SignatureHeader)) {
+		t.Errorf("invalid signature %s", req.Header.Get(SignatureHeader))
+	}
+	if Verify("other", req.Header.Get(TimestampHeader), body, req.Header.Get(SignatureHeader)) {
+		t.Errorf("signature verified with wrong secret")
+	}
+	var event events.Event
+	if err := json.Unmarshal(body, &event); err != nil || event.Type != events.EmployeeMoved {
+		t.Errorf("unexpected body %s", body)
+	}
+	if listed := d.Subscriptions(); len(listed) != 1 || listed[0].Secret != "" {
+		t.Errorf("unexpected subscriptions %+v", listed)
+	}
+}
+
+func TestRetryAndDeadLetters(t *testing.T) {
+	r, server := newReceiver(4)
+	defer server.Close()
+	d, _ := NewDispatcher(WithAttempts(3), WithBackoff(time.Millisecond, 2*time.Millisecond))
+	defer d.Close()
+	sub, _ := d.Subscribe(Subscription{URL: server.URL})
+
+	// First event fails three times and is dead-lettered, second one succeeds on its second attempt
+	d.Publish([]events.Event{testEvent(events.EmployeeAdded), testEvent(events.EmployeeRemoved)})
+	r.wait(t, 5)
+	deadLetters := d.DeadLetters()
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected single dead letter, got %+v", deadLetters)
+	}
+	dead := deadLetters[0]
+	if dead.SubscriptionID != sub.ID || dead.Event.Type != events.EmployeeAdded || dead.Attempts != 3 ||
+		dead.Error == "" {
+		t.Errorf("unexpected dead letter %+v", dead)
+	}
+	if r.deliveries[3].Header.Get(DeliveryHeader) != "employee.removed-1" {
+		t.Errorf("events delivered out of order")
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	d, _ := NewDispatcher()
+	defer d.Close()
+	for _, test := range []struct {
+		subscription Subscription
+		err          error
+	}{
+		{Subscription{URL: "/relative"}, ErrInvalidUrl},
+		{Subscription{URL: "ftp://example.com"}, ErrInvalidUrl},
+		{Subscription{URL: "http://example.com", Events: []events.Type{"employee.promoted"}}, ErrUnknownEvent},
+	} {
+		if _, err := d.Subscribe(test.subscription); err != test.err {
+			t.Errorf("%+v: expected %v, got %v", test.subscription, test.err, err)
+		}
+	}
+	if err := d.Unsubscribe("missing"); err != ErrSubscriptionNotFound {
+		t.Errorf("expected %v, got %v", ErrSubscriptionNotFound, err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "webhooks.json")
+
+	d, _ := NewDispatcher(WithFile(path))
+	kept, _ := d.Subscribe(Subscription{URL: "http://example.com/kept", Secret: "secret"})
+	removed, _ := d.Subscribe(Subscription{URL: "http://example.com/removed"})
+	_ = d.Unsubscribe(removed.ID)
+	d.Close()
+
+	restored, err := NewDispatcher(WithFile(path))
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	defer restored.Close()
+	subscriptions := restored.subscriptions()
+	if len(subscriptions) != 1 || subscriptions[0].ID != kept.ID || subscriptions[0].Secret != "secret" {
+		t.Errorf("unexpected subscriptions %+v", subscriptions)
+	}
+}